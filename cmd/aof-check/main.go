@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chenjiayao/goredistraning/parser"
+)
+
+// aof 文件检查和修复工具
+// go run cmd/aof-check/main.go [--fix] appendonly.aof
+func main() {
+	fix := flag.Bool("fix", false, "truncate the file to the last valid command")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--fix] <file.aof>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	filename := flag.Arg(0)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		fmt.Printf("Cannot open file: %s\n", err.Error())
+		os.Exit(1)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Printf("Cannot stat file: %s\n", err.Error())
+		os.Exit(1)
+	}
+	result := checkAof(file)
+	file.Close()
+
+	printResult(result, info.Size())
+	if result.err == nil {
+		fmt.Println("AOF is valid")
+		return
+	}
+
+	if !*fix {
+		fmt.Println("AOF is not valid. Use the --fix option to try fixing it.")
+		os.Exit(1)
+	}
+
+	fmt.Printf("This will shrink the AOF from %d bytes, with %d bytes, to %d bytes\n",
+		info.Size(), info.Size()-result.validOffset, result.validOffset)
+	fmt.Print("Continue? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		fmt.Println("Aborting...")
+		os.Exit(1)
+	}
+
+	err = os.Truncate(filename, result.validOffset)
+	if err != nil {
+		fmt.Printf("Failed to truncate AOF: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("Successfully truncated AOF")
+}
+
+type checkResult struct {
+	validOffset   int64          // 最后一条完整命令的结束位置，修复时截断到这里
+	validCmdCount int            // 完整命令的个数
+	errOffset     int64          // 第一条错误命令的起始位置
+	err           error          // 第一条错误命令的错误信息，nil 表示文件没有问题
+	stats         map[string]int // 每个命令出现的次数
+}
+
+// 依次解析 aof 文件中的命令，遇到第一条错误的命令时停止
+// multi 之后如果没有 exec 就到了文件末尾，那么整个事务都是不完整的，validOffset 为 multi 的起始位置
+func checkAof(reader io.Reader) *checkResult {
+	result := &checkResult{
+		stats: make(map[string]int),
+	}
+	decoder := parser.MakeDecoder(reader)
+
+	multiOffset := int64(-1)
+	multiCmdCount := 0
+	for {
+		offset := decoder.Offset()
+		cmd, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			result.errOffset = offset
+			if err == io.ErrUnexpectedEOF {
+				result.err = fmt.Errorf("unexpected end of file, command %d is truncated", result.validCmdCount+1)
+			} else {
+				result.err = fmt.Errorf("command %d is malformed: %s", result.validCmdCount+1, err.Error())
+			}
+			break
+		}
+
+		if len(cmd) == 0 {
+			result.errOffset = offset
+			result.err = fmt.Errorf("command %d is empty", result.validCmdCount+1)
+			break
+		}
+
+		cmdName := strings.ToLower(string(cmd[0]))
+		switch cmdName {
+		case "multi":
+			multiOffset = offset
+			multiCmdCount = result.validCmdCount
+		case "exec", "discard":
+			multiOffset = -1
+		}
+
+		result.validCmdCount++
+		result.validOffset = decoder.Offset()
+		result.stats[cmdName]++
+	}
+
+	if multiOffset != -1 {
+		if result.err == nil {
+			result.errOffset = multiOffset
+			result.err = fmt.Errorf("reached EOF before reading EXEC for MULTI (command %d)", multiCmdCount+1)
+		}
+		result.validOffset = multiOffset
+		result.validCmdCount = multiCmdCount
+	}
+	return result
+}
+
+func printResult(result *checkResult, size int64) {
+	fmt.Printf("AOF analyzed: size=%d, ok_up_to=%d, ok_commands=%d, diff=%d\n",
+		size, result.validOffset, result.validCmdCount, size-result.validOffset)
+	if result.err != nil {
+		fmt.Printf("Bad file format at offset %d: %s\n", result.errOffset, result.err.Error())
+	}
+
+	names := make([]string, 0, len(result.stats))
+	for name := range result.stats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if result.stats[names[i]] != result.stats[names[j]] {
+			return result.stats[names[i]] > result.stats[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Println("Command statistics:")
+	for _, name := range names {
+		fmt.Printf("  %-16s %d\n", name, result.stats[name])
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	setCmd   = "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	multiCmd = "*1\r\n$5\r\nMULTI\r\n"
+	execCmd  = "*1\r\n$4\r\nEXEC\r\n"
+)
+
+func Test_checkAof(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		wantErr       bool
+		wantOffset    int64
+		wantCmdCount  int
+		wantErrOffset int64
+	}{
+		{
+			name:         "valid",
+			content:      setCmd + multiCmd + setCmd + execCmd,
+			wantErr:      false,
+			wantOffset:   int64(len(setCmd + multiCmd + setCmd + execCmd)),
+			wantCmdCount: 4,
+		},
+		{
+			name:          "truncated",
+			content:       setCmd + setCmd[:10],
+			wantErr:       true,
+			wantOffset:    int64(len(setCmd)),
+			wantCmdCount:  1,
+			wantErrOffset: int64(len(setCmd)),
+		},
+		{
+			name:          "malformed",
+			content:       setCmd + "+OK\r\n" + setCmd,
+			wantErr:       true,
+			wantOffset:    int64(len(setCmd)),
+			wantCmdCount:  1,
+			wantErrOffset: int64(len(setCmd)),
+		},
+		{
+			name:          "multi without exec",
+			content:       setCmd + multiCmd + setCmd,
+			wantErr:       true,
+			wantOffset:    int64(len(setCmd)),
+			wantCmdCount:  1,
+			wantErrOffset: int64(len(setCmd)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkAof(bytes.NewBufferString(tt.content))
+			if (got.err != nil) != tt.wantErr {
+				t.Fatalf("checkAof() err = %v, wantErr %v", got.err, tt.wantErr)
+			}
+			if got.validOffset != tt.wantOffset {
+				t.Errorf("checkAof() validOffset = %d, want %d", got.validOffset, tt.wantOffset)
+			}
+			if got.validCmdCount != tt.wantCmdCount {
+				t.Errorf("checkAof() validCmdCount = %d, want %d", got.validCmdCount, tt.wantCmdCount)
+			}
+			if tt.wantErr && got.errOffset != tt.wantErrOffset {
+				t.Errorf("checkAof() errOffset = %d, want %d", got.errOffset, tt.wantErrOffset)
+			}
+		})
+	}
+}
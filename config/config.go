@@ -16,8 +16,49 @@ type ServerConfig struct {
 	RequirePass    string `config:"require_pass"`
 	Appendonly     bool   `config:"appendonly"`      //是否开启 aof
 	AppendFilename string `config:"append_filename"` //aof 文件名称
+	Appendfsync    string `config:"appendfsync"`     //aof 刷盘策略：always、everysec、no
+
+	AofLoadTruncated bool `config:"aof-load-truncated"` //aof 文件最后一条命令不完整时，是否丢弃这条命令继续启动
+
+	AutoAofRewritePercentage int   `config:"auto-aof-rewrite-percentage"` //aof 文件比上次重写之后增长了多少百分比时自动重写，0 表示不自动重写
+	AutoAofRewriteMinSize    int64 `config:"auto-aof-rewrite-min-size"`   //aof 文件至少达到多大才会自动重写，支持 kb、mb、gb 单位
+
+	Dir        string `config:"dir"`        //rdb 文件所在目录
+	Dbfilename string `config:"dbfilename"` //rdb 文件名称
+	Save       string `config:"save"`       //rdb 自动保存规则：save <seconds> <changes> [<seconds> <changes> ...]，为空表示不自动保存
+
+	ProtoMaxBulkLen        int64 `config:"proto-max-bulk-len"`        //请求中单个字符串参数的最大长度，支持 kb、mb、gb 单位
+	ProtoMaxMultibulkLen   int   `config:"proto-max-multibulk-len"`   //请求中参数个数的上限
+	ClientQueryBufferLimit int64 `config:"client-query-buffer-limit"` //单条请求的最大长度，超过之后关闭连接，支持 kb、mb、gb 单位
+
+	HashMaxListpackEntries int `config:"hash-max-listpack-entries"` //hash 的 field 个数不超过它时使用 listpack 编码
+	HashMaxListpackValue   int `config:"hash-max-listpack-value"`   //hash 的 field 和 value 长度都不超过它时使用 listpack 编码
+	SetMaxIntsetEntries    int `config:"set-max-intset-entries"`    //set 的 member 都是整数并且个数不超过它时使用 intset 编码
+
+	Hz int `config:"hz"` //每秒执行多少次定期删除过期 key，范围 1~500
+
+	Maxmemory        int64  `config:"maxmemory"`         //内存上限，0 表示不限制，支持 kb、mb、gb 单位
+	MaxmemoryPolicy  string `config:"maxmemory-policy"`  //超过内存上限时淘汰 key 的策略
+	MaxmemorySamples int    `config:"maxmemory-samples"` //每次淘汰时从每个 db 中抽样的 key 个数
 }
 
+const (
+	AppendfsyncAlways   = "always"   //每条命令都 fsync 之后再返回给客户端
+	AppendfsyncEverysec = "everysec" //每秒 fsync 一次
+	AppendfsyncNo       = "no"       //由操作系统决定什么时候刷盘
+)
+
+const (
+	MaxmemoryPolicyNoeviction     = "noeviction"      //不淘汰 key，可能增加内存的命令直接返回错误
+	MaxmemoryPolicyAllkeysLRU     = "allkeys-lru"     //所有 key 中淘汰最久没有访问的
+	MaxmemoryPolicyVolatileLRU    = "volatile-lru"    //设置了过期时间的 key 中淘汰最久没有访问的
+	MaxmemoryPolicyAllkeysLFU     = "allkeys-lfu"     //所有 key 中淘汰访问频率最低的
+	MaxmemoryPolicyVolatileLFU    = "volatile-lfu"    //设置了过期时间的 key 中淘汰访问频率最低的
+	MaxmemoryPolicyAllkeysRandom  = "allkeys-random"  //所有 key 中随机淘汰
+	MaxmemoryPolicyVolatileRandom = "volatile-random" //设置了过期时间的 key 中随机淘汰
+	MaxmemoryPolicyVolatileTTL    = "volatile-ttl"    //设置了过期时间的 key 中淘汰最早过期的
+)
+
 // golang 的 code style：如果一个变量是全局单例，直接设为全局变量
 var Config *ServerConfig
 
@@ -31,18 +72,85 @@ func LoadConfig(filename string) {
 }
 
 func LoadDefaultConfig() {
-	Config = &ServerConfig{
+	Config = defaultConfig()
+}
+
+// 默认配置，配置文件中没有出现的配置项也使用这里的值
+func defaultConfig() *ServerConfig {
+	return &ServerConfig{
 		Bind:           "127.0.0.1",
 		Port:           3101,
 		Databases:      16,
 		RequirePass:    "",
 		Appendonly:     false,
 		AppendFilename: "",
+		Appendfsync:    AppendfsyncEverysec,
+
+		AofLoadTruncated: true,
+
+		AutoAofRewritePercentage: 100,
+		AutoAofRewriteMinSize:    64 * 1024 * 1024,
+
+		Dir:        ".",
+		Dbfilename: "dump.rdb",
+		Save:       "3600 1 300 100 60 10000",
+
+		ProtoMaxBulkLen:        512 * 1024 * 1024,
+		ProtoMaxMultibulkLen:   1024 * 1024,
+		ClientQueryBufferLimit: 1024 * 1024 * 1024,
+
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue:   64,
+		SetMaxIntsetEntries:    512,
+
+		Hz: 10,
+
+		Maxmemory:        0,
+		MaxmemoryPolicy:  MaxmemoryPolicyNoeviction,
+		MaxmemorySamples: 5,
+	}
+}
+
+// 所有配置项的名称和当前的值，config get 命令使用
+func Items() ([]string, []string) {
+	names := make([]string, 0)
+	values := make([]string, 0)
+
+	t := reflect.TypeOf(Config).Elem()
+	v := reflect.ValueOf(Config).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldVal := v.Field(i)
+
+		configName, ok := field.Tag.Lookup("config")
+		if !ok {
+			configName = strings.ToLower(field.Name)
+		}
+
+		value := ""
+		switch field.Type.Kind() {
+		case reflect.String:
+			value = fieldVal.String()
+		case reflect.Int, reflect.Int64:
+			value = strconv.FormatInt(fieldVal.Int(), 10)
+		case reflect.Bool:
+			value = "no"
+			if fieldVal.Bool() {
+				value = "yes"
+			}
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.String {
+				value = strings.Join(fieldVal.Interface().([]string), ",")
+			}
+		}
+		names = append(names, configName)
+		values = append(values, value)
 	}
+	return names, values
 }
 
 func parseConfig(reader io.Reader) *ServerConfig {
-	c := &ServerConfig{}
+	c := defaultConfig()
 	configMap := loadConfig(reader)
 
 	//使用反射来解析 ServerConfig
@@ -68,6 +176,12 @@ func parseConfig(reader io.Reader) *ServerConfig {
 				if err == nil {
 					fieldVal.SetInt(intValue)
 				}
+			case reflect.Int64:
+				//int64 用来表示内存大小，比如 64mb
+				memoryValue, err := parseMemory(configValue)
+				if err == nil {
+					fieldVal.SetInt(memoryValue)
+				}
 			case reflect.Bool:
 				boolValue := "yes" == configValue
 				fieldVal.SetBool(boolValue)
@@ -103,3 +217,37 @@ func loadConfig(reader io.Reader) map[string]string {
 	}
 	return m
 }
+
+// 解析内存大小，单位和 redis 一致（不区分大小写）：
+// 1k => 1000 bytes, 1kb => 1024 bytes
+// 1m => 1000000 bytes, 1mb => 1024*1024 bytes
+// 1g => 1000000000 bytes, 1gb => 1024*1024*1024 bytes
+func parseMemory(value string) (int64, error) {
+	value = strings.ToLower(value)
+	units := []struct {
+		suffix string
+		unit   int64
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"gb", 1024 * 1024 * 1024},
+		{"k", 1000},
+		{"m", 1000 * 1000},
+		{"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	unit := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			unit = u.unit
+			value = strings.TrimSuffix(value, u.suffix)
+			break
+		}
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return number * unit, nil
+}
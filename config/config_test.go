@@ -13,6 +13,8 @@ port 3101
 
 appendonly yes
 appendfilename appendonly.aof 
+maxmemory 100mb
+maxmemory-policy allkeys-lru
 `
 	var buf bytes.Buffer
 	buf.Write([]byte(config))
@@ -29,6 +31,46 @@ appendfilename appendonly.aof
 	if !gotAppendonly {
 		t.Errorf("loadConfig bind = %t, want = %t", gotAppendonly, true)
 	}
+
+	if c.Maxmemory != 100*1024*1024 {
+		t.Errorf("loadConfig maxmemory = %d, want = %d", c.Maxmemory, 100*1024*1024)
+	}
+	if c.MaxmemoryPolicy != MaxmemoryPolicyAllkeysLRU {
+		t.Errorf("loadConfig maxmemory-policy = %s, want = %s", c.MaxmemoryPolicy, MaxmemoryPolicyAllkeysLRU)
+	}
+}
+
+// 配置文件中没有出现的配置项使用默认值
+func Test_parseConfig_Defaults(t *testing.T) {
+	c := parseConfig(bytes.NewBufferString("port 6399\n"))
+	if c.Port != 6399 {
+		t.Errorf("parseConfig port = %d, want = %d", c.Port, 6399)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"aof-load-truncated", c.AofLoadTruncated, true},
+		{"dir", c.Dir, "."},
+		{"dbfilename", c.Dbfilename, "dump.rdb"},
+		{"save", c.Save, "3600 1 300 100 60 10000"},
+		{"proto-max-bulk-len", c.ProtoMaxBulkLen, int64(512 * 1024 * 1024)},
+		{"proto-max-multibulk-len", c.ProtoMaxMultibulkLen, 1024 * 1024},
+		{"client-query-buffer-limit", c.ClientQueryBufferLimit, int64(1024 * 1024 * 1024)},
+		{"hash-max-listpack-entries", c.HashMaxListpackEntries, 128},
+		{"hash-max-listpack-value", c.HashMaxListpackValue, 64},
+		{"set-max-intset-entries", c.SetMaxIntsetEntries, 512},
+		{"hz", c.Hz, 10},
+		{"maxmemory-policy", c.MaxmemoryPolicy, MaxmemoryPolicyNoeviction},
+		{"maxmemory-samples", c.MaxmemorySamples, 5},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("parseConfig %s = %v, want = %v", tt.name, tt.got, tt.want)
+		}
+	}
 }
 
 func Test_loadConfig(t *testing.T) {
@@ -64,3 +106,54 @@ appendfilename appendonly.aof
 		t.Errorf("loadConfig bind = %s, want = %s", gotAppendonly, wantAppendonly)
 	}
 }
+
+func Test_parseMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "100", value: "100", want: 100},
+		{name: "1k", value: "1k", want: 1000},
+		{name: "1kb", value: "1kb", want: 1024},
+		{name: "64mb", value: "64mb", want: 64 * 1024 * 1024},
+		{name: "2GB", value: "2GB", want: 2 * 1024 * 1024 * 1024},
+		{name: "1m", value: "1m", want: 1000 * 1000},
+		{name: "abc", value: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMemory(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseMemory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseMemory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItems(t *testing.T) {
+	LoadDefaultConfig()
+	names, values := Items()
+	if len(names) != len(values) {
+		t.Fatalf("len(names) = %d, len(values) = %d", len(names), len(values))
+	}
+
+	items := make(map[string]string)
+	for i := range names {
+		items[names[i]] = values[i]
+	}
+	if items["port"] != "3101" {
+		t.Errorf("Items() port = %s, want 3101", items["port"])
+	}
+	if items["appendonly"] != "no" {
+		t.Errorf("Items() appendonly = %s, want no", items["appendonly"])
+	}
+	if items["bind"] != "127.0.0.1" {
+		t.Errorf("Items() bind = %s, want 127.0.0.1", items["bind"])
+	}
+}
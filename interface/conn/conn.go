@@ -4,6 +4,7 @@ type Conn interface {
 	Close()
 	RemoteAddress() string
 	Write(data []byte) error
+	Flush() error
 
 	GetSelectedDBIndex() int
 	SetSelectedDBIndex(index int)
@@ -22,4 +23,14 @@ type Conn interface {
 
 	DirtyCAS(flag bool)
 	GetDirtyCAS() bool
+	Unwatch() //取消 watch 的所有 key
+
+	GetID() int64
+	GetName() string
+	SetName(name string)
+
+	GetProtocol() int //RESP 协议版本：2 或者 3
+	SetProtocol(protocol int)
+
+	Propagate(cmds ...[][]byte) //正在执行的命令写入 aof 时替换成 cmds，不传参数表示不写入 aof
 }
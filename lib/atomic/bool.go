@@ -15,3 +15,15 @@ func (b *Boolean) Set(v bool) {
 		atomic.StoreInt32((*int32)(b), 0)
 	}
 }
+
+// 当前值等于 old 时设置为 new，返回是否设置成功
+func (b *Boolean) CompareAndSwap(old, new bool) bool {
+	var o, n int32
+	if old {
+		o = 1
+	}
+	if new {
+		n = 1
+	}
+	return atomic.CompareAndSwapInt32((*int32)(b), o, n)
+}
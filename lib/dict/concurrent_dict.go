@@ -1,6 +1,7 @@
 package dict
 
 import (
+	"math/rand"
 	"sync"
 	"sync/atomic"
 )
@@ -16,8 +17,9 @@ type ConcurrentDict struct {
 }
 
 type Fragment struct {
-	data map[string]interface{}
-	lock sync.RWMutex
+	data  map[string]interface{}
+	index *ScanIndex // 按照 scan 的顺序保存分段中所有的 key
+	lock  sync.RWMutex
 }
 
 func (d *ConcurrentDict) Get(key string) (interface{}, bool) {
@@ -63,6 +65,7 @@ func (d *ConcurrentDict) Put(key string, val interface{}) bool {
 
 	if _, ok := fragment.data[key]; !ok {
 		d.increaseCount()
+		fragment.index.Add(key)
 	}
 	fragment.data[key] = val
 	return true
@@ -92,6 +95,7 @@ func (d *ConcurrentDict) PutIfNotExist(key string, val interface{}) bool {
 
 	if _, ok := fragment.data[key]; !ok {
 		fragment.data[key] = val
+		fragment.index.Add(key)
 	}
 	return true
 }
@@ -108,7 +112,12 @@ func (d *ConcurrentDict) Del(key string) bool {
 	fragment.lock.Lock()
 	defer fragment.lock.Unlock()
 
+	//key 不存在时不能减少 count
+	if _, ok := fragment.data[key]; !ok {
+		return false
+	}
 	delete(fragment.data, key)
+	fragment.index.Remove(key)
 	d.decreaseCount()
 	return true
 }
@@ -125,6 +134,93 @@ func (d *ConcurrentDict) decreaseCount() {
 	atomic.AddInt32(&d.count, -1)
 }
 
+// 遍历 dict 中所有的元素，consumer 返回 false 时停止遍历
+// 遍历某个分段时会持有这个分段的读锁，所以 consumer 中不能对 dict 进行写操作
+func (d *ConcurrentDict) ForEach(consumer func(key string, val interface{}) bool) {
+	if d == nil {
+		panic("dict is null")
+	}
+
+	for _, fragment := range d.fragments {
+		fragment.lock.RLock()
+		for key, val := range fragment.data {
+			if !consumer(key, val) {
+				fragment.lock.RUnlock()
+				return
+			}
+		}
+		fragment.lock.RUnlock()
+	}
+}
+
+// 返回所有的 key，遍历期间写入的 key 可能不会返回
+func (d *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, d.Len())
+	d.ForEach(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// 随机返回 limit 个 key，可能重复，dict 为空时返回空 slice
+// 先随机选择一个分段，再取分段中的一个 key，go 的 map 每次遍历的起始位置是随机的
+func (d *ConcurrentDict) RandomKeys(limit int) []string {
+	if d == nil {
+		panic("dict is null")
+	}
+
+	keys := make([]string, 0, limit)
+	for len(keys) < limit && d.Len() > 0 {
+		fragment := d.fragments[rand.Intn(d.fragmentCount)]
+		if key, ok := fragment.randomKey(); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 随机返回 limit 个不重复的 key，limit 不小于 key 的个数时返回所有 key
+func (d *ConcurrentDict) RandomDistinctKeys(limit int) []string {
+	//需要的 key 比较多的时候，随机抽取很容易抽到重复的 key，直接打乱所有的 key
+	if limit*2 >= int(d.Len()) {
+		keys := d.Keys()
+		if limit >= len(keys) {
+			return keys
+		}
+		//只需要打乱前 limit 个位置
+		for i := 0; i < limit; i++ {
+			j := i + rand.Intn(len(keys)-i)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+		return keys[:limit]
+	}
+
+	selected := make(map[string]struct{}, limit)
+	keys := make([]string, 0, limit)
+	//并发删除之后 key 可能不够 limit 个
+	for len(keys) < limit && len(keys) < int(d.Len()) {
+		for _, key := range d.RandomKeys(limit - len(keys)) {
+			if _, ok := selected[key]; ok {
+				continue
+			}
+			selected[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (f *Fragment) randomKey() (string, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	for key := range f.data {
+		return key, true
+	}
+	return "", false
+}
+
 func (d *ConcurrentDict) Clear() {
 	*d = *NewDict(d.fragmentCount)
 }
@@ -138,7 +234,8 @@ func NewDict(fragmentCount int) *ConcurrentDict {
 	}
 	for i := 0; i < fragmentCount; i++ {
 		d.fragments[i] = &Fragment{
-			data: make(map[string]interface{}),
+			data:  make(map[string]interface{}),
+			index: MakeScanIndex(),
 		}
 	}
 	return d
@@ -1,9 +1,7 @@
 package dict
 
 import (
-	"crypto/rand"
 	"fmt"
-	"math/big"
 	"testing"
 )
 
@@ -36,10 +34,11 @@ func TestConcurrentDict_Del(t *testing.T) {
 	}
 
 	for i := 0; i < 20; i++ {
-		val, _ := rand.Int(rand.Reader, big.NewInt(100))
-		key := fmt.Sprintf("test_%d", val)
+		key := fmt.Sprintf("test_%d", i*5)
 
-		d.Del(key)
+		if !d.Del(key) {
+			t.Errorf("d.Del(%s) = false, want true", key)
+		}
 
 		_, ok := d.Get(key)
 		if ok {
@@ -47,6 +46,11 @@ func TestConcurrentDict_Del(t *testing.T) {
 		}
 	}
 
+	//删除不存在的 key
+	if d.Del("test_0") {
+		t.Errorf("d.Del(test_0) = true, want false")
+	}
+
 	got := d.Len()
 	if got != 80 {
 		t.Errorf("d len want 80. but got = %d", got)
@@ -85,3 +89,73 @@ func TestConcurrentDict_Put(t *testing.T) {
 		}
 	}
 }
+
+func TestConcurrentDict_ForEach(t *testing.T) {
+	d := NewDict(6)
+	for i := 0; i < 100; i++ {
+		d.Put(fmt.Sprintf("test_%d", i), i)
+	}
+
+	sum := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		sum += val.(int)
+		return true
+	})
+	if sum != 4950 {
+		t.Errorf("d.ForEach sum = %d, want %d", sum, 4950)
+	}
+
+	count := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Errorf("d.ForEach should stop when consumer return false, count = %d", count)
+	}
+}
+
+func TestConcurrentDict_RandomKeys(t *testing.T) {
+	d := NewDict(6)
+	if keys := d.RandomKeys(10); len(keys) != 0 {
+		t.Errorf("d.RandomKeys on empty dict = %v, want empty", keys)
+	}
+
+	for i := 0; i < 3; i++ {
+		d.Put(fmt.Sprintf("test_%d", i), i)
+	}
+	keys := d.RandomKeys(10)
+	if len(keys) != 10 {
+		t.Fatalf("len(d.RandomKeys(10)) = %d, want 10", len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := d.Get(key); !ok {
+			t.Errorf("d.RandomKeys returned %s which is not in dict", key)
+		}
+	}
+}
+
+func TestConcurrentDict_RandomDistinctKeys(t *testing.T) {
+	d := NewDict(6)
+	for i := 0; i < 100; i++ {
+		d.Put(fmt.Sprintf("test_%d", i), i)
+	}
+	if keys := d.Keys(); len(keys) != 100 {
+		t.Errorf("len(d.Keys()) = %d, want 100", len(keys))
+	}
+
+	for _, limit := range []int{5, 60, 200} {
+		keys := d.RandomDistinctKeys(limit)
+		want := limit
+		if want > 100 {
+			want = 100
+		}
+		unique := make(map[string]struct{})
+		for _, key := range keys {
+			unique[key] = struct{}{}
+		}
+		if len(keys) != want || len(unique) != want {
+			t.Errorf("d.RandomDistinctKeys(%d) returned %d keys, %d unique, want %d", limit, len(keys), len(unique), want)
+		}
+	}
+}
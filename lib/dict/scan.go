@@ -0,0 +1,97 @@
+package dict
+
+import (
+	"math"
+
+	"github.com/chenjiayao/goredistraning/lib/skiplist"
+)
+
+// scan 的遍历顺序：按照 key 的 fnv32 hash 从小到大，hash 相同时按照 key 的字典序
+// 这个顺序只和 key 本身有关，和 map 的内部结构以及元素的增删都没有关系，游标记录下一次从哪个 hash 开始遍历
+// 同一个 hash 的 key 总是在同一次调用中返回，所以遍历期间一直存在的 key 一定会返回，并且只会返回一次
+// hash、set、sorted set 的 scan 命令也使用这个顺序
+
+// 按照 scan 的顺序保存所有 key 的索引，用跳表实现，score 是 key 的 fnv32 hash，跳表本身就是按照 (score, member) 排序的
+// scan 时先用 O(log(n)) 找到游标的位置，之后只访问需要返回的 key
+// 索引不是并发安全的，调用方需要加锁
+type ScanIndex struct {
+	list *skiplist.SkipList
+}
+
+func MakeScanIndex() *ScanIndex {
+	return &ScanIndex{
+		list: skiplist.MakeSkipList(),
+	}
+}
+
+// 调用方需要保证 key 不在索引中
+func (idx *ScanIndex) Add(key string) {
+	idx.list.Insert(key, float64(fnv32(key)))
+}
+
+func (idx *ScanIndex) Remove(key string) {
+	idx.list.Delete(key, float64(fnv32(key)))
+}
+
+func (idx *ScanIndex) Len() int {
+	return int(idx.list.Len())
+}
+
+// 从 hash 不小于 cursor 的 key 开始，按照 scan 的顺序返回至少 count 个 key，hash 相同的 key 一起返回
+// next 是下一次调用的游标，遍历结束时返回 0，复杂度是 O(log(n) + count)
+func (idx *ScanIndex) Scan(cursor uint64, count int) ([]string, uint64) {
+	if count < 1 {
+		count = 1
+	}
+
+	keys := make([]string, 0, count)
+	if cursor > math.MaxUint32 {
+		return keys, 0
+	}
+	node := idx.list.FirstInRange(
+		skiplist.ScoreBorder{Value: float64(cursor)},
+		skiplist.ScoreBorder{Value: math.MaxUint32},
+	)
+	//和最后一个 key 的 hash 相同的 key 也需要在这次返回
+	last := float64(0)
+	for node != nil && (len(keys) < count || node.Score == last) {
+		keys = append(keys, node.Member)
+		last = node.Score
+		node = node.Next()
+	}
+	if node == nil {
+		return keys, 0
+	}
+	//还有 key 没有返回，说明 last 不是最大的 hash，+1 不会溢出
+	return keys, uint64(last) + 1
+}
+
+// 按照分段的下标依次 scan 每个分段，游标的高 32 位是分段的下标，低 32 位是分段中下一个 key 的 hash
+// 分段的个数不会改变，所以游标在并发写入之后仍然有效
+// 每次最少返回 count 个 key，游标为 0 时遍历结束
+// 每个分段都有自己的 ScanIndex，复杂度是 O(分段数 + log(n) + count)
+func (d *ConcurrentDict) Scan(cursor uint64, count int) ([]string, uint64) {
+	if d == nil {
+		panic("dict is null")
+	}
+
+	keys := make([]string, 0)
+	index := int(cursor >> 32)
+	hashCursor := cursor & math.MaxUint32
+	for ; index < d.fragmentCount && len(keys) < count; index++ {
+		fragment := d.fragments[index]
+		fragment.lock.RLock()
+		scanned, next := fragment.index.Scan(hashCursor, count-len(keys))
+		fragment.lock.RUnlock()
+
+		keys = append(keys, scanned...)
+		if next != 0 {
+			return keys, uint64(index)<<32 | next
+		}
+		hashCursor = 0
+	}
+	if index >= d.fragmentCount {
+		return keys, 0
+	}
+	return keys, uint64(index) << 32
+}
@@ -0,0 +1,106 @@
+package dict
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConcurrentDict_Scan(t *testing.T) {
+	d := NewDict(8)
+	for i := 0; i < 100; i++ {
+		d.Put(fmt.Sprintf("test_%d", i), i)
+	}
+
+	//遍历期间增删其他的 key，一直存在的 key 都需要返回，并且只返回一次
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	for round := 0; ; round++ {
+		keys, next := d.Scan(cursor, 3)
+		if next != 0 && len(keys) < 3 {
+			t.Fatalf("d.Scan(%d, 3) returned %d keys before the end", cursor, len(keys))
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		d.Put(fmt.Sprintf("new_%d", round), round)
+		d.Del(fmt.Sprintf("new_%d", round-1))
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("test_%d", i)
+		if seen[key] != 1 {
+			t.Errorf("key %s returned %d times, want 1", key, seen[key])
+		}
+	}
+
+	if keys, next := d.Scan(uint64(100)<<32, 10); len(keys) != 0 || next != 0 {
+		t.Errorf("d.Scan with out of range cursor = %v, %d", keys, next)
+	}
+}
+
+func TestScanIndex_Scan(t *testing.T) {
+	idx := MakeScanIndex()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		idx.Add(member)
+	}
+
+	all, next := idx.Scan(0, 10)
+	if len(all) != idx.Len() || next != 0 {
+		t.Fatalf("idx.Scan(0, 10) = %v, %d", all, next)
+	}
+
+	//分多次返回的顺序和一次返回的顺序一致
+	if got := scanAll(idx, 2); fmt.Sprint(got) != fmt.Sprint(all) {
+		t.Errorf("idx.Scan with count 2 = %v, want %v", got, all)
+	}
+
+	idx.Remove("c")
+	if got := scanAll(idx, 2); len(got) != 4 {
+		t.Errorf("idx.Scan after remove = %v", got)
+	}
+
+	if keys, next := idx.Scan(uint64(1)<<32, 10); len(keys) != 0 || next != 0 {
+		t.Errorf("idx.Scan with out of range cursor = %v, %d", keys, next)
+	}
+}
+
+func TestScanIndex_SameHash(t *testing.T) {
+	//key_592254 和 key_1040240 的 fnv32 hash 相同
+	if fnv32("key_592254") != fnv32("key_1040240") {
+		t.Fatal("key_592254 and key_1040240 should have the same hash")
+	}
+	idx := MakeScanIndex()
+	idx.Add("key_592254")
+	idx.Add("key_1040240")
+	for i := 0; i < 50; i++ {
+		idx.Add(fmt.Sprintf("member_%d", i))
+	}
+
+	all, _ := idx.Scan(0, idx.Len())
+	for count := 1; count <= idx.Len(); count++ {
+		if got := scanAll(idx, count); fmt.Sprint(got) != fmt.Sprint(all) {
+			t.Fatalf("idx.Scan with count %d = %v, want %v", count, got, all)
+		}
+	}
+}
+
+// 从游标 0 开始遍历到结束，每次最少返回 count 个 key
+func scanAll(idx *ScanIndex, count int) []string {
+	got := make([]string, 0)
+	cursor := uint64(0)
+	for {
+		keys, next := idx.Scan(cursor, count)
+		if len(keys) < count && next != 0 {
+			panic(fmt.Sprintf("idx.Scan(%d, %d) returned %d keys before the end", cursor, count, len(keys)))
+		}
+		got = append(got, keys...)
+		if next == 0 {
+			return got
+		}
+		cursor = next
+	}
+}
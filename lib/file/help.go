@@ -22,3 +22,9 @@ func DirExists(dir string) bool {
 	_, err := os.Stat(dir)
 	return !os.IsNotExist(err)
 }
+
+// 文件或者目录是否存在
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package glob
+
+// redis 的 glob 风格匹配，逐字节比较，实现和 redis 的 stringmatchlen 一致：
+// 1. * 匹配任意个字节，? 匹配一个字节
+// 2. [abc] 匹配其中一个字节，[^abc] 匹配不在其中的字节，[a-z] 匹配范围内的字节，范围的两端可以颠倒
+// 3. \ 转义下一个字节，在 [] 中同样可以使用
+// 4. 没有闭合的 [ 当作到 pattern 结尾为止的字符集合
+// 用于 keys、scan 的 MATCH 以及 config get 这类按照 pattern 过滤的地方
+
+// 递归的最大深度，防止 pattern 中有大量 * 时栈溢出
+const maxNesting = 1000
+
+// pattern 是否匹配 str，区分大小写
+func Match(pattern, str string) bool {
+	skipLongerMatches := false
+	return match(pattern, str, false, &skipLongerMatches, 0)
+}
+
+// pattern 是否匹配 str，不区分大小写
+func MatchNoCase(pattern, str string) bool {
+	skipLongerMatches := false
+	return match(pattern, str, true, &skipLongerMatches, 0)
+}
+
+// skipLongerMatches：* 后面的 pattern 从 str 的任何位置开始都不能匹配时，前面的 * 匹配更长的子串也不可能匹配
+// 设置之后直接返回，避免 "a*a*a*a*b" 这类 pattern 的指数级回溯
+func match(pattern, str string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p == len(pattern)-1 {
+				return true
+			}
+			for s < len(str) {
+				if match(pattern[p+1:], str[s:], nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s++
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			matched := false
+			for {
+				if p >= len(pattern) {
+					//没有闭合的 [，回退一个字节，下面的 p++ 之后正好是 pattern 的结尾
+					p--
+					break
+				}
+				if pattern[p] == '\\' && len(pattern)-p >= 2 {
+					p++
+					if pattern[p] == str[s] {
+						matched = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if len(pattern)-p >= 3 && pattern[p+1] == '-' {
+					start, end, c := pattern[p], pattern[p+2], str[s]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					p += 2
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[p], str[s], nocase) {
+					matched = true
+				}
+				p++
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s++
+		case '\\':
+			if len(pattern)-p >= 2 {
+				p++
+			}
+			if !equal(pattern[p], str[s], nocase) {
+				return false
+			}
+			s++
+		default:
+			if !equal(pattern[p], str[s], nocase) {
+				return false
+			}
+			s++
+		}
+		p++
+		if s == len(str) {
+			//str 已经匹配完了，pattern 剩下的 * 可以匹配空串
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			break
+		}
+	}
+	return p == len(pattern) && s == len(str)
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+// 只转换 ASCII 字母，和 C 的 tolower 在默认 locale 下一致
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
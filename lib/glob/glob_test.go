@@ -0,0 +1,188 @@
+package glob
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"a", "", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"ab", "abc", false},
+
+		// *
+		{"*", "", false}, // 和 redis 一致，空字符串不能匹配 *
+		{"*", "a", true},
+		{"*", "abc", true},
+		{"**", "abc", true},
+		{"a*", "a", true},
+		{"a**", "a", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"*c", "abd", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"a*b*c", "a-b-c", true},
+		{"a*b*c", "a-c-b", false},
+		{"*a*", "bab", true},
+		{"*a*", "bbb", false},
+		{"foo*", "foo_a", true},
+		{"*foo*bar", "xfooybar", true},
+		{"*foo*bar", "xfooybarz", false},
+
+		// ?
+		{"?", "", false},
+		{"?", "a", true},
+		{"?", "ab", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"???", "abc", true},
+		{"?*", "a", true},
+		{"*?", "", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+
+		// []
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hallo", true},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true}, // 范围的两端可以颠倒
+		{"[a-cx-z]", "y", true},
+		{"[a-cx-z]", "m", false},
+		{"[^a-c]", "d", true},
+		{"[^a-c]", "b", false},
+		{"[]", "a", false},
+		{"[^]", "a", true},
+		{"[abc", "a", true}, // 没有闭合的 [
+		{"[abc", "c", true},
+		{"[abc", "d", false},
+		{"[abc", "ab", false},
+		{"[a-]", "-", false}, // a-] 被当作范围 ]-a
+		{"[a-]", "_", true},
+		{"[*]", "*", true},
+		{"[*]", "a", false},
+		{"[?]", "?", true},
+		{"[[]", "[", true},
+
+		// 转义
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"\\?", "?", true},
+		{"\\?", "a", false},
+		{"\\[a]", "[a]", true},
+		{"\\[a]", "a", false},
+		{"\\a", "a", true},
+		{"\\\\", "\\", true},
+		{"\\", "\\", true}, // 结尾的 \ 按照普通字符匹配
+		{"a\\", "a\\", true},
+		{"[\\]]", "]", true},
+		{"[\\]]", "\\", false},
+		{"[\\-]", "-", true},
+		{"[\\^]", "^", true},
+		{"[^\\]]", "]", false},
+		{"*\\*", "abc*", true},
+		{"*\\*", "abc", false},
+
+		// 逐字节匹配
+		{"?", "é", false},
+		{"??", "é", true},
+		{"\xff?", "\xff\x00", true},
+		{"[\x00-\x10]", "\x05", true},
+		{"a\x00b", "a\x00b", true},
+		{"a\x00b", "a\x00c", false},
+
+		// 区分大小写
+		{"HELLO", "hello", false},
+		{"[A-Z]", "q", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestMatchNoCase(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{"HELLO", "hello", true},
+		{"hello", "HeLLo", true},
+		{"HELLO*", "hello world", true},
+		{"h?LLO", "HELLO", true},
+		{"[A-Z]", "q", true},
+		{"[a-z]", "Q", true},
+		{"[^A-Z]", "q", false},
+		{"[ABC]", "b", true},
+		{"[\\A]", "a", false}, // [] 中转义的字符区分大小写，和 redis 一致
+		{"\\A", "a", true},
+		{"hello", "hellp", false},
+		{"É", "é", false}, // 只转换 ASCII 字母
+	}
+	for _, tt := range tests {
+		if got := MatchNoCase(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("MatchNoCase(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+// redis 的回归测试：大量 * 不能导致指数级的回溯
+func TestMatch_ManyStars(t *testing.T) {
+	pattern := strings.Repeat("a*", 50) + "b"
+	str := strings.Repeat("a", 100)
+
+	done := make(chan bool)
+	go func() {
+		done <- Match(pattern, str)
+	}()
+	select {
+	case got := <-done:
+		if got {
+			t.Errorf("Match(%q, %q) = true, want false", pattern, str)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Match with many stars does not finish in time")
+	}
+
+	//递归深度超过上限时不匹配
+	if Match(strings.Repeat("a*", 2000), strings.Repeat("a", 2000)) {
+		t.Errorf("Match with nesting over %d should be false", maxNesting)
+	}
+}
+
+// 移植自 redis 的 stringmatchlen_fuzz_test：随机的 pattern 和字符串不能导致越界
+func TestMatch_Fuzz(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomBytes := func() string {
+		b := make([]byte, r.Intn(32))
+		for i := range b {
+			b[i] = byte(r.Intn(128))
+		}
+		return string(b)
+	}
+	for i := 0; i < 100000; i++ {
+		pattern, str := randomBytes(), randomBytes()
+		Match(pattern, str)
+		MatchNoCase(pattern, str)
+	}
+}
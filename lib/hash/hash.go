@@ -0,0 +1,220 @@
+package hash
+
+import (
+	"math/rand"
+
+	"github.com/chenjiayao/goredistraning/lib/dict"
+)
+
+// hash 有两种编码：
+// 1. listpack：field 个数和 field/value 的长度都不超过阈值时，按插入顺序把 field 和 value 保存在一个 slice 中，
+//    元素很少的时候顺序查找并不比 map 慢，而且没有 map 的桶和指针的内存开销
+// 2. hashtable：超过阈值之后增加一个 field 到 slice 下标的 map，不会再转换回 listpack
+//    删除时把最后一个元素移到被删除的位置，slice 始终是紧凑的，随机抽取 field 只需要随机一个下标
+//    另外用 dict.ScanIndex 按照 scan 的顺序保存所有 field，hscan 只访问返回的 field
+// hash 不是并发安全的，调用方需要对 key 加锁
+
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+type entry struct {
+	field string
+	value string
+}
+
+type Hash struct {
+	entries []entry
+	table   map[string]int // field 在 entries 中的下标，为 nil 时使用 listpack 编码
+	index   *dict.ScanIndex
+
+	maxListpackEntries int // listpack 编码最多保存的 field 个数
+	maxListpackValue   int // listpack 编码中 field 和 value 的最大长度
+}
+
+func MakeHash(maxListpackEntries, maxListpackValue int) *Hash {
+	return &Hash{
+		maxListpackEntries: maxListpackEntries,
+		maxListpackValue:   maxListpackValue,
+	}
+}
+
+func (h *Hash) Encoding() string {
+	if h.table != nil {
+		return EncodingHashtable
+	}
+	return EncodingListpack
+}
+
+func (h *Hash) Len() int {
+	return len(h.entries)
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	i := h.indexOf(field)
+	if i < 0 {
+		return "", false
+	}
+	return h.entries[i].value, true
+}
+
+func (h *Hash) Exists(field string) bool {
+	_, ok := h.Get(field)
+	return ok
+}
+
+// 设置 field 的值，field 是新增的时候返回 true
+func (h *Hash) Set(field, value string) bool {
+	if h.table == nil && (len(field) > h.maxListpackValue || len(value) > h.maxListpackValue) {
+		h.convertToHashtable()
+	}
+
+	if i := h.indexOf(field); i >= 0 {
+		h.entries[i].value = value
+		return false
+	}
+	h.entries = append(h.entries, entry{field: field, value: value})
+	if h.table != nil {
+		h.table[field] = len(h.entries) - 1
+		h.index.Add(field)
+	} else if len(h.entries) > h.maxListpackEntries {
+		h.convertToHashtable()
+	}
+	return true
+}
+
+// 删除 field，field 存在时返回 true
+func (h *Hash) Delete(field string) bool {
+	i := h.indexOf(field)
+	if i < 0 {
+		return false
+	}
+	if h.table == nil {
+		h.entries = append(h.entries[:i], h.entries[i+1:]...)
+		return true
+	}
+	//hashtable 编码不需要保持顺序，把最后一个元素移到被删除的位置
+	last := len(h.entries) - 1
+	if i != last {
+		h.entries[i] = h.entries[last]
+		h.table[h.entries[i].field] = i
+	}
+	h.entries[last] = entry{}
+	h.entries = h.entries[:last]
+	delete(h.table, field)
+	h.index.Remove(field)
+	return true
+}
+
+// 遍历所有 field，consumer 返回 false 时停止遍历
+func (h *Hash) ForEach(consumer func(field, value string) bool) {
+	for _, e := range h.entries {
+		if !consumer(e.field, e.value) {
+			return
+		}
+	}
+}
+
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, h.Len())
+	h.ForEach(func(field, value string) bool {
+		fields = append(fields, field)
+		return true
+	})
+	return fields
+}
+
+// 按照 scan 的顺序从 cursor 开始返回至少 count 个 field，next 为 0 时遍历结束
+// listpack 编码的 hash 元素很少，和 redis 一样一次返回所有的 field
+func (h *Hash) Scan(cursor uint64, count int) ([]string, uint64) {
+	if h.table != nil {
+		return h.index.Scan(cursor, count)
+	}
+	return h.Fields(), 0
+}
+
+// 随机返回 count 个 field，可能重复，每次抽取的复杂度是 O(1)，不会遍历所有的 field
+func (h *Hash) RandomFields(count int) []string {
+	if h.Len() == 0 {
+		return []string{}
+	}
+	res := make([]string, count)
+	for i := range res {
+		res[i] = h.randomField()
+	}
+	return res
+}
+
+// 随机返回 count 个不重复的 field，count 大于 field 个数时返回所有 field
+func (h *Hash) RandomDistinctFields(count int) []string {
+	//需要的 field 比较多的时候，随机抽取很容易抽到重复的 field，直接打乱所有的 field
+	if count*2 >= h.Len() {
+		fields := h.Fields()
+		if count >= len(fields) {
+			return fields
+		}
+		//只需要打乱前 count 个位置
+		for i := 0; i < count; i++ {
+			j := i + rand.Intn(len(fields)-i)
+			fields[i], fields[j] = fields[j], fields[i]
+		}
+		return fields[:count]
+	}
+
+	selected := make(map[string]struct{}, count)
+	fields := make([]string, 0, count)
+	for len(fields) < count {
+		field := h.randomField()
+		if _, ok := selected[field]; ok {
+			continue
+		}
+		selected[field] = struct{}{}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// 随机返回一个 field，调用方需要保证 hash 不为空，两种编码的 entries 都是紧凑的，直接随机下标
+func (h *Hash) randomField() string {
+	return h.entries[rand.Intn(len(h.entries))].field
+}
+
+func (h *Hash) Copy() *Hash {
+	res := MakeHash(h.maxListpackEntries, h.maxListpackValue)
+	res.entries = make([]entry, len(h.entries))
+	copy(res.entries, h.entries)
+	if h.table != nil {
+		res.table = make(map[string]int, len(h.table))
+		res.index = dict.MakeScanIndex()
+		for field, i := range h.table {
+			res.table[field] = i
+			res.index.Add(field)
+		}
+	}
+	return res
+}
+
+func (h *Hash) indexOf(field string) int {
+	if h.table != nil {
+		if i, ok := h.table[field]; ok {
+			return i
+		}
+		return -1
+	}
+	for i, e := range h.entries {
+		if e.field == field {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *Hash) convertToHashtable() {
+	h.table = make(map[string]int, len(h.entries))
+	h.index = dict.MakeScanIndex()
+	for i, e := range h.entries {
+		h.table[e.field] = i
+		h.index.Add(e.field)
+	}
+}
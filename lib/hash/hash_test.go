@@ -0,0 +1,137 @@
+package hash
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHash_Encoding(t *testing.T) {
+	h := MakeHash(4, 8)
+	for i := 0; i < 4; i++ {
+		h.Set(strconv.Itoa(i), "v")
+	}
+	if h.Encoding() != EncodingListpack {
+		t.Fatalf("h.Encoding() = %s, want %s", h.Encoding(), EncodingListpack)
+	}
+	if !h.Set("4", "v") || h.Encoding() != EncodingHashtable || h.Len() != 5 {
+		t.Fatalf("hash should be converted to hashtable after too many fields")
+	}
+
+	h = MakeHash(4, 8)
+	h.Set("field", "v")
+	h.Set("field", strings.Repeat("v", 9))
+	if h.Encoding() != EncodingHashtable || h.Len() != 1 {
+		t.Fatalf("hash should be converted to hashtable after a long value")
+	}
+	if v, _ := h.Get("field"); v != strings.Repeat("v", 9) {
+		t.Errorf("h.Get() = %s", v)
+	}
+}
+
+func TestHash_SetDelete(t *testing.T) {
+	for _, maxEntries := range []int{128, 2} {
+		h := MakeHash(maxEntries, 64)
+		if !h.Set("a", "1") || !h.Set("b", "2") || !h.Set("c", "3") || h.Set("a", "4") {
+			t.Fatalf("h.Set() should return whether the field is new")
+		}
+		if v, ok := h.Get("a"); !ok || v != "4" {
+			t.Errorf("h.Get(a) = %s, %v", v, ok)
+		}
+		if !h.Delete("b") || h.Delete("b") || h.Exists("b") || h.Len() != 2 {
+			t.Errorf("h.Delete(b) failed")
+		}
+
+		fields := h.Fields()
+		sort.Strings(fields)
+		if strings.Join(fields, ",") != "a,c" {
+			t.Errorf("h.Fields() = %v", fields)
+		}
+
+		c := h.Copy()
+		c.Set("d", "5")
+		if h.Exists("d") || c.Len() != 3 {
+			t.Errorf("h.Copy() should not share data")
+		}
+
+		//listpack 编码一次返回所有的 field，hashtable 编码每次至少返回 count 个
+		for _, tt := range []struct {
+			h    *Hash
+			want string
+		}{{h, "a,c"}, {c, "a,c,d"}} {
+			fields := make([]string, 0)
+			cursor := uint64(0)
+			for {
+				scanned, next := tt.h.Scan(cursor, 1)
+				fields = append(fields, scanned...)
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+			sort.Strings(fields)
+			if strings.Join(fields, ",") != tt.want {
+				t.Errorf("h.Scan() = %v, want %s", fields, tt.want)
+			}
+		}
+	}
+}
+
+func TestHash_Random(t *testing.T) {
+	h := MakeHash(128, 64)
+	for i := 0; i < 10; i++ {
+		h.Set(strconv.Itoa(i), "v")
+	}
+
+	fields := h.RandomDistinctFields(5)
+	seen := make(map[string]struct{})
+	for _, field := range fields {
+		if !h.Exists(field) {
+			t.Fatalf("unknown field %s", field)
+		}
+		seen[field] = struct{}{}
+	}
+	if len(fields) != 5 || len(seen) != 5 {
+		t.Errorf("h.RandomDistinctFields(5) = %v", fields)
+	}
+	if len(h.RandomDistinctFields(20)) != 10 {
+		t.Errorf("h.RandomDistinctFields(20) should return all fields")
+	}
+	if len(h.RandomFields(20)) != 20 {
+		t.Errorf("h.RandomFields(20) should return 20 fields")
+	}
+	//hashtable 编码删除之后随机抽取的仍然是存在的 field，并且每个 field 都能被抽到
+	h = MakeHash(4, 64)
+	for i := 0; i < 100; i++ {
+		h.Set(strconv.Itoa(i), "v")
+	}
+	for i := 0; i < 100; i += 2 {
+		h.Delete(strconv.Itoa(i))
+	}
+	if h.Encoding() != EncodingHashtable || h.Len() != 50 {
+		t.Fatalf("h.Encoding() = %s, h.Len() = %d", h.Encoding(), h.Len())
+	}
+	counts := make(map[string]int)
+	for _, field := range h.RandomFields(50000) {
+		counts[field]++
+	}
+	for i := 1; i < 100; i += 2 {
+		if c := counts[strconv.Itoa(i)]; c < 500 || c > 1500 {
+			t.Errorf("field %d is sampled %d times, want about 1000", i, c)
+		}
+	}
+	if len(counts) != 50 {
+		t.Errorf("h.RandomFields() returned %d distinct fields, want 50", len(counts))
+	}
+	seen = make(map[string]struct{})
+	for _, field := range h.RandomDistinctFields(3) {
+		if v, ok := h.Get(field); !ok || v != "v" {
+			t.Fatalf("unknown field %s", field)
+		}
+		seen[field] = struct{}{}
+	}
+	if len(seen) != 3 {
+		t.Errorf("h.RandomDistinctFields(3) should return 3 distinct fields")
+	}
+}
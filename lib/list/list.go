@@ -68,6 +68,12 @@ func (l *List) Remove(val interface{}) {
 			} else {
 				currentNode.prev.next = currentNode.next
 			}
+			if currentNode == l.tail {
+				l.tail = currentNode.prev
+			} else {
+				currentNode.next.prev = currentNode.prev
+			}
+			l.size--
 		}
 
 		currentNode = currentNode.next
@@ -56,4 +56,17 @@ func TestList_Remove(t *testing.T) {
 	if exist {
 		t.Errorf("l.Remove(1) = falied")
 	}
+
+	//删除最后一个节点之后还可以继续插入
+	l.Remove(3)
+	if l.Len() != 0 || l.First() != nil {
+		t.Errorf("l.Len() = %d after removing all, but want 0", l.Len())
+	}
+	l.InsertLast(4)
+	l.InsertLast(5)
+	l.Remove(5)
+	l.InsertLast(6)
+	if l.Len() != 2 || !l.Exist(4) || !l.Exist(6) {
+		t.Errorf("l.InsertLast after removing tail falied, len = %d", l.Len())
+	}
 }
@@ -27,7 +27,7 @@ var (
 )
 
 var (
-	logger *log.Logger
+	logger = log.New(os.Stdout, "", log.LstdFlags) //Setting 之前（比如单元测试中）默认输出到 stdout
 	mu     sync.Mutex
 )
 
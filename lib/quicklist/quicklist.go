@@ -0,0 +1,373 @@
+package quicklist
+
+// quicklist：双向链表，链表的每个节点保存一段连续的元素（slice）
+// 1. 两端的 push/pop 只需要操作头尾节点，时间复杂度 O(1)
+// 2. 按下标访问时可以整段地跳过节点，从离下标更近的一端开始查找，时间复杂度 O(n/nodeCapacity)
+// 3. 相比每个元素一个节点的双向链表，指针的内存开销更小，内存也更连续
+// quicklist 不是并发安全的，调用方需要对 key 加锁
+
+// 每个节点最多保存的元素个数
+const nodeCapacity = 128
+
+type node struct {
+	entries []string
+	prev    *node
+	next    *node
+}
+
+type QuickList struct {
+	head *node
+	tail *node
+	size int
+}
+
+func MakeQuickList() *QuickList {
+	return &QuickList{}
+}
+
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+func (ql *QuickList) PushFront(val string) {
+	if ql.head == nil || len(ql.head.entries) >= nodeCapacity {
+		ql.insertNodeBefore(ql.head, &node{entries: make([]string, 0, 1)})
+	}
+	n := ql.head
+	n.entries = append(n.entries, "")
+	copy(n.entries[1:], n.entries)
+	n.entries[0] = val
+	ql.size++
+}
+
+func (ql *QuickList) PushBack(val string) {
+	if ql.tail == nil || len(ql.tail.entries) >= nodeCapacity {
+		ql.insertNodeAfter(ql.tail, &node{entries: make([]string, 0, 1)})
+	}
+	ql.tail.entries = append(ql.tail.entries, val)
+	ql.size++
+}
+
+// 弹出第一个元素，列表为空时返回 false
+func (ql *QuickList) PopFront() (string, bool) {
+	if ql.size == 0 {
+		return "", false
+	}
+	n := ql.head
+	val := n.entries[0]
+	n.entries = n.entries[1:]
+	ql.size--
+	if len(n.entries) == 0 {
+		ql.removeNode(n)
+	}
+	return val, true
+}
+
+// 弹出最后一个元素，列表为空时返回 false
+func (ql *QuickList) PopBack() (string, bool) {
+	if ql.size == 0 {
+		return "", false
+	}
+	n := ql.tail
+	val := n.entries[len(n.entries)-1]
+	n.entries = n.entries[:len(n.entries)-1]
+	ql.size--
+	if len(n.entries) == 0 {
+		ql.removeNode(n)
+	}
+	return val, true
+}
+
+// index 必须在 [0, Len()) 范围内
+func (ql *QuickList) Get(index int) string {
+	n, offset := ql.locate(index)
+	return n.entries[offset]
+}
+
+// index 必须在 [0, Len()) 范围内
+func (ql *QuickList) Set(index int, val string) {
+	n, offset := ql.locate(index)
+	n.entries[offset] = val
+}
+
+// 在 index 之前插入元素，index == Len() 时插入到最后
+func (ql *QuickList) Insert(index int, val string) {
+	if index == ql.size {
+		ql.PushBack(val)
+		return
+	}
+
+	n, offset := ql.locate(index)
+	n.entries = append(n.entries, "")
+	copy(n.entries[offset+1:], n.entries[offset:])
+	n.entries[offset] = val
+	ql.size++
+
+	//节点满了之后分裂成两个节点
+	if len(n.entries) > nodeCapacity {
+		half := len(n.entries) / 2
+		next := &node{entries: make([]string, len(n.entries)-half, nodeCapacity)}
+		copy(next.entries, n.entries[half:])
+		n.entries = n.entries[:half:half]
+		ql.insertNodeAfter(n, next)
+	}
+}
+
+// 删除 index 位置的元素并返回，index 必须在 [0, Len()) 范围内
+func (ql *QuickList) RemoveAt(index int) string {
+	n, offset := ql.locate(index)
+	val := n.entries[offset]
+	n.entries = append(n.entries[:offset], n.entries[offset+1:]...)
+	ql.size--
+	if len(n.entries) == 0 {
+		ql.removeNode(n)
+	}
+	return val
+}
+
+// 删除和 val 相等的元素，返回删除的个数
+// count > 0：从头到尾删除 count 个
+// count < 0：从尾到头删除 -count 个
+// count = 0：删除所有
+func (ql *QuickList) RemoveValue(val string, count int) int {
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	removed := 0
+	if count >= 0 {
+		for n := ql.head; n != nil && (limit == 0 || removed < limit); {
+			next := n.next
+			kept := n.entries[:0]
+			for _, entry := range n.entries {
+				if entry == val && (limit == 0 || removed < limit) {
+					removed++
+					continue
+				}
+				kept = append(kept, entry)
+			}
+			ql.shrinkNode(n, kept)
+			n = next
+		}
+	} else {
+		for n := ql.tail; n != nil && removed < limit; {
+			prev := n.prev
+			//从后往前找到需要删除的元素，再按照原来的顺序保留剩下的元素
+			drop := make(map[int]struct{})
+			for i := len(n.entries) - 1; i >= 0 && removed+len(drop) < limit; i-- {
+				if n.entries[i] == val {
+					drop[i] = struct{}{}
+				}
+			}
+			if len(drop) > 0 {
+				kept := n.entries[:0]
+				for i, entry := range n.entries {
+					if _, ok := drop[i]; !ok {
+						kept = append(kept, entry)
+					}
+				}
+				removed += len(drop)
+				ql.shrinkNode(n, kept)
+			}
+			n = prev
+		}
+	}
+	ql.size -= removed
+	return removed
+}
+
+// 只保留 [start, stop] 范围内的元素，start 和 stop 必须满足 0 <= start <= stop < Len()
+func (ql *QuickList) Trim(start, stop int) {
+	ql.removeFront(start)
+	ql.removeBack(ql.size - (stop - start + 1))
+}
+
+// 删除所有元素
+func (ql *QuickList) Clear() {
+	ql.head = nil
+	ql.tail = nil
+	ql.size = 0
+}
+
+// 返回 [start, stop] 范围内的元素，start 和 stop 必须满足 0 <= start <= stop < Len()
+func (ql *QuickList) Range(start, stop int) []string {
+	res := make([]string, 0, stop-start+1)
+	ql.ForEach(start, func(index int, val string) bool {
+		if index > stop {
+			return false
+		}
+		res = append(res, val)
+		return true
+	})
+	return res
+}
+
+// 从 start 开始从头到尾遍历元素，consumer 返回 false 时停止遍历
+func (ql *QuickList) ForEach(start int, consumer func(index int, val string) bool) {
+	if start < 0 || start >= ql.size {
+		return
+	}
+	n, offset := ql.locate(start)
+	index := start
+	for ; n != nil; n = n.next {
+		for ; offset < len(n.entries); offset++ {
+			if !consumer(index, n.entries[offset]) {
+				return
+			}
+			index++
+		}
+		offset = 0
+	}
+}
+
+// 从 start 开始从尾到头遍历元素，consumer 返回 false 时停止遍历
+func (ql *QuickList) ReverseForEach(start int, consumer func(index int, val string) bool) {
+	if start < 0 || start >= ql.size {
+		return
+	}
+	n, offset := ql.locate(start)
+	index := start
+	for n != nil {
+		for ; offset >= 0; offset-- {
+			if !consumer(index, n.entries[offset]) {
+				return
+			}
+			index--
+		}
+		n = n.prev
+		if n != nil {
+			offset = len(n.entries) - 1
+		}
+	}
+}
+
+// 拷贝整个列表，元素是 string，不需要深拷贝
+func (ql *QuickList) Copy() *QuickList {
+	res := MakeQuickList()
+	for n := ql.head; n != nil; n = n.next {
+		entries := make([]string, len(n.entries), nodeCapacity)
+		copy(entries, n.entries)
+		res.insertNodeAfter(res.tail, &node{entries: entries})
+	}
+	res.size = ql.size
+	return res
+}
+
+// 找到 index 所在的节点以及在节点中的偏移量，从离 index 更近的一端开始查找
+func (ql *QuickList) locate(index int) (*node, int) {
+	if index < ql.size/2 {
+		n := ql.head
+		for index >= len(n.entries) {
+			index -= len(n.entries)
+			n = n.next
+		}
+		return n, index
+	}
+
+	index = ql.size - 1 - index // 从尾部开始的下标
+	n := ql.tail
+	for index >= len(n.entries) {
+		index -= len(n.entries)
+		n = n.prev
+	}
+	return n, len(n.entries) - 1 - index
+}
+
+// 从头部删除 count 个元素，整个节点都要删除时直接删除节点
+func (ql *QuickList) removeFront(count int) {
+	for count > 0 && ql.head != nil {
+		n := ql.head
+		if count >= len(n.entries) {
+			count -= len(n.entries)
+			ql.size -= len(n.entries)
+			ql.removeNode(n)
+			continue
+		}
+		n.entries = n.entries[count:]
+		ql.size -= count
+		count = 0
+	}
+}
+
+// 从尾部删除 count 个元素
+func (ql *QuickList) removeBack(count int) {
+	for count > 0 && ql.tail != nil {
+		n := ql.tail
+		if count >= len(n.entries) {
+			count -= len(n.entries)
+			ql.size -= len(n.entries)
+			ql.removeNode(n)
+			continue
+		}
+		n.entries = n.entries[:len(n.entries)-count]
+		ql.size -= count
+		count = 0
+	}
+}
+
+// 删除元素之后更新节点，节点为空时删除节点，不修改 size
+func (ql *QuickList) shrinkNode(n *node, kept []string) {
+	//清理掉被删除的元素，避免底层数组一直引用它们
+	for i := len(kept); i < len(n.entries); i++ {
+		n.entries[i] = ""
+	}
+	n.entries = kept
+	if len(kept) == 0 {
+		ql.removeNode(n)
+	}
+}
+
+// 在 at 之前插入节点，at 为 nil 时插入到最后
+func (ql *QuickList) insertNodeBefore(at *node, n *node) {
+	if at == nil {
+		ql.insertNodeAfter(ql.tail, n)
+		return
+	}
+	n.next = at
+	n.prev = at.prev
+	if at.prev == nil {
+		ql.head = n
+	} else {
+		at.prev.next = n
+	}
+	at.prev = n
+}
+
+// 在 at 之后插入节点，at 为 nil 时插入到最前
+func (ql *QuickList) insertNodeAfter(at *node, n *node) {
+	if at == nil {
+		n.prev = nil
+		n.next = ql.head
+		if ql.head == nil {
+			ql.tail = n
+		} else {
+			ql.head.prev = n
+		}
+		ql.head = n
+		return
+	}
+	n.prev = at
+	n.next = at.next
+	if at.next == nil {
+		ql.tail = n
+	} else {
+		at.next.prev = n
+	}
+	at.next = n
+}
+
+func (ql *QuickList) removeNode(n *node) {
+	if n.prev == nil {
+		ql.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		ql.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev = nil
+	n.next = nil
+}
@@ -0,0 +1,177 @@
+package quicklist
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func toSlice(ql *QuickList) []string {
+	res := make([]string, 0, ql.Len())
+	ql.ForEach(0, func(index int, val string) bool {
+		res = append(res, val)
+		return true
+	})
+	return res
+}
+
+func TestQuickList_PushPop(t *testing.T) {
+	ql := MakeQuickList()
+	for i := 0; i < 1000; i++ {
+		ql.PushBack(strconv.Itoa(i))
+		ql.PushFront(strconv.Itoa(-i))
+	}
+	if ql.Len() != 2000 {
+		t.Fatalf("ql.Len() = %d, want 2000", ql.Len())
+	}
+	if ql.Get(0) != "-999" || ql.Get(1999) != "999" || ql.Get(1000) != "0" {
+		t.Errorf("ql.Get() = %s %s %s", ql.Get(0), ql.Get(1999), ql.Get(1000))
+	}
+
+	for i := 999; i >= 0; i-- {
+		v, ok := ql.PopBack()
+		if !ok || v != strconv.Itoa(i) {
+			t.Fatalf("ql.PopBack() = %s, want %d", v, i)
+		}
+		v, ok = ql.PopFront()
+		if !ok || v != strconv.Itoa(-i) {
+			t.Fatalf("ql.PopFront() = %s, want %d", v, -i)
+		}
+	}
+	if _, ok := ql.PopFront(); ok || ql.Len() != 0 || ql.head != nil || ql.tail != nil {
+		t.Errorf("quicklist should be empty")
+	}
+}
+
+func TestQuickList_RemoveValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		want    []string
+		removed int
+	}{
+		{name: "from head", count: 2, want: []string{"b", "a", "c", "a"}, removed: 2},
+		{name: "from tail", count: -2, want: []string{"a", "a", "b", "c"}, removed: 2},
+		{name: "all", count: 0, want: []string{"b", "c"}, removed: 4},
+		{name: "more than exists", count: -10, want: []string{"b", "c"}, removed: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ql := MakeQuickList()
+			for _, v := range []string{"a", "a", "b", "a", "c", "a"} {
+				ql.PushBack(v)
+			}
+			removed := ql.RemoveValue("a", tt.count)
+			if removed != tt.removed || !reflect.DeepEqual(toSlice(ql), tt.want) {
+				t.Errorf("ql.RemoveValue() = %d, %v, want %d, %v", removed, toSlice(ql), tt.removed, tt.want)
+			}
+		})
+	}
+}
+
+// 随机操作 quicklist 和 slice，结果要保持一致
+func TestQuickList_Random(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ql := MakeQuickList()
+	model := make([]string, 0)
+
+	for i := 0; i < 20000; i++ {
+		val := strconv.Itoa(rnd.Intn(50))
+		switch op := rnd.Intn(9); {
+		case op == 0:
+			ql.PushFront(val)
+			model = append([]string{val}, model...)
+		case op == 1:
+			ql.PushBack(val)
+			model = append(model, val)
+		case op == 2 && len(model) > 0:
+			ql.PopFront()
+			model = model[1:]
+		case op == 3 && len(model) > 0:
+			ql.PopBack()
+			model = model[:len(model)-1]
+		case op == 4:
+			index := rnd.Intn(len(model) + 1)
+			ql.Insert(index, val)
+			model = append(model[:index], append([]string{val}, model[index:]...)...)
+		case op == 5 && len(model) > 0:
+			index := rnd.Intn(len(model))
+			ql.RemoveAt(index)
+			model = append(model[:index], model[index+1:]...)
+		case op == 6 && len(model) > 0:
+			index := rnd.Intn(len(model))
+			ql.Set(index, val)
+			model[index] = val
+		case op == 7 && len(model) > 0 && rnd.Intn(20) == 0:
+			start := rnd.Intn(len(model))
+			stop := start + rnd.Intn(len(model)-start)
+			ql.Trim(start, stop)
+			model = append([]string{}, model[start:stop+1]...)
+		case op == 8:
+			count := rnd.Intn(5) - 2
+			ql.RemoveValue(val, count)
+			model = removeValue(model, val, count)
+		}
+
+		if ql.Len() != len(model) {
+			t.Fatalf("step %d: ql.Len() = %d, want %d", i, ql.Len(), len(model))
+		}
+		if len(model) > 0 {
+			index := rnd.Intn(len(model))
+			if ql.Get(index) != model[index] {
+				t.Fatalf("step %d: ql.Get(%d) = %s, want %s", i, index, ql.Get(index), model[index])
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(toSlice(ql), model) {
+		t.Fatalf("quicklist = %v, want %v", toSlice(ql), model)
+	}
+	if len(model) > 0 && !reflect.DeepEqual(ql.Range(0, len(model)-1), model) {
+		t.Errorf("ql.Range() is not equal to model")
+	}
+
+	reversed := make([]string, 0, len(model))
+	ql.ReverseForEach(len(model)-1, func(index int, val string) bool {
+		if val != model[index] {
+			t.Fatalf("ql.ReverseForEach() index %d = %s, want %s", index, val, model[index])
+		}
+		reversed = append(reversed, val)
+		return true
+	})
+	if len(reversed) != len(model) {
+		t.Errorf("ql.ReverseForEach() visited %d entries, want %d", len(reversed), len(model))
+	}
+
+	copied := ql.Copy()
+	ql.Clear()
+	if !reflect.DeepEqual(toSlice(copied), model) {
+		t.Errorf("ql.Copy() is not equal to model")
+	}
+}
+
+func removeValue(model []string, val string, count int) []string {
+	res := make([]string, 0, len(model))
+	if count >= 0 {
+		removed := 0
+		for _, v := range model {
+			if v == val && (count == 0 || removed < count) {
+				removed++
+				continue
+			}
+			res = append(res, v)
+		}
+		return res
+	}
+
+	removed := 0
+	for i := len(model) - 1; i >= 0; i-- {
+		if model[i] == val && removed < -count {
+			removed++
+			continue
+		}
+		res = append([]string{model[i]}, res...)
+	}
+	return res
+}
@@ -1,55 +1,329 @@
 package set
 
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/chenjiayao/goredistraning/lib/dict"
+)
+
+// set 有两种编码：
+// 1. intset：所有 member 都是整数并且个数不超过阈值时，用一个有序的 []int64 保存，二分查找
+//    相比 map 没有桶和字符串的内存开销
+// 2. hashtable：加入非整数 member 或者个数超过阈值之后转换成 map，不会再转换回 intset
+//    member 保存在一个紧凑的 slice 中，map 记录 member 在 slice 中的下标，随机抽取 member 只需要随机一个下标
+//    另外用 dict.ScanIndex 按照 scan 的顺序保存所有 member，sscan 只访问返回的 member
+// set 不是并发安全的，调用方需要对 key 加锁
+
+const (
+	EncodingIntset    = "intset"
+	EncodingHashtable = "hashtable"
+)
+
 type Set struct {
+	intset []int64
 
 	//TODO 是否直接使用  []byte 当作 key 会不会更高效，这个需要进行压测试试
-	vals map[string]struct{}
+	vals    map[string]int // member 在 entries 中的下标，为 nil 时使用 intset 编码
+	entries []string       // hashtable 编码的所有 member，删除时把最后一个 member 移到被删除的位置
+	index   *dict.ScanIndex
+
+	maxIntsetEntries int // intset 编码最多保存的 member 个数
+}
+
+func MakeSet(maxIntsetEntries int) *Set {
+	return &Set{
+		intset:           make([]int64, 0),
+		maxIntsetEntries: maxIntsetEntries,
+	}
+}
+
+func (set *Set) Encoding() string {
+	if set.vals != nil {
+		return EncodingHashtable
+	}
+	return EncodingIntset
 }
 
 func (set *Set) Add(v string) int {
-	_, exist := set.vals[v]
+	if set.vals != nil {
+		_, exist := set.vals[v]
+		if exist {
+			return 0
+		}
+
+		set.entries = append(set.entries, v)
+		set.vals[v] = len(set.entries) - 1
+		set.index.Add(v)
+		return 1
+	}
+
+	value, ok := parseInt(v)
+	if !ok {
+		set.convertToHashtable()
+		return set.Add(v)
+	}
+	i, exist := set.search(value)
 	if exist {
 		return 0
 	}
-
-	//unsafe.Sizeof(struct{}{}) == 0
-	set.vals[v] = struct{}{}
+	if len(set.intset) >= set.maxIntsetEntries {
+		set.convertToHashtable()
+		return set.Add(v)
+	}
+	set.intset = append(set.intset, 0)
+	copy(set.intset[i+1:], set.intset[i:])
+	set.intset[i] = value
 	return 1
 }
 
 func (set *Set) Len() int {
-	return len(set.vals)
+	if set.vals != nil {
+		return len(set.vals)
+	}
+	return len(set.intset)
 }
 
 func (set *Set) Exist(key string) bool {
-	_, exist := set.vals[key]
+	if set.vals != nil {
+		_, exist := set.vals[key]
+		return exist
+	}
+	value, ok := parseInt(key)
+	if !ok {
+		return false
+	}
+	_, exist := set.search(value)
 	return exist
 }
 
-func (set *Set) Del(v string) {
-	delete(set.vals, v)
+// 删除成功返回 1，v 不存在返回 0
+func (set *Set) Del(v string) int {
+	if set.vals != nil {
+		i, exist := set.vals[v]
+		if !exist {
+			return 0
+		}
+		last := len(set.entries) - 1
+		if i != last {
+			set.entries[i] = set.entries[last]
+			set.vals[set.entries[i]] = i
+		}
+		set.entries[last] = ""
+		set.entries = set.entries[:last]
+		delete(set.vals, v)
+		set.index.Remove(v)
+		return 1
+	}
+
+	value, ok := parseInt(v)
+	if !ok {
+		return 0
+	}
+	i, exist := set.search(value)
+	if !exist {
+		return 0
+	}
+	set.intset = append(set.intset[:i], set.intset[i+1:]...)
+	return 1
 }
 
+// intset 编码时按照从小到大的顺序返回
 func (set *Set) Members() [][]byte {
-	sl := len(set.vals)
-	keys := make([][]byte, sl)
-	i := 0
-	for key, value := range set.vals {
-		_ = value
+	keys := make([][]byte, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		keys = append(keys, []byte(member))
+		return true
+	})
+	return keys
+}
+
+// 遍历 set，consumer 返回 false 时停止遍历
+func (set *Set) ForEach(consumer func(member string) bool) {
+	if set.vals != nil {
+		for _, member := range set.entries {
+			if !consumer(member) {
+				return
+			}
+		}
+		return
+	}
+	for _, value := range set.intset {
+		if !consumer(strconv.FormatInt(value, 10)) {
+			return
+		}
+	}
+}
+
+// 按照 scan 的顺序从 cursor 开始返回至少 count 个 member，next 为 0 时遍历结束
+// intset 编码的 set 元素很少，和 redis 一样一次返回所有的 member
+func (set *Set) Scan(cursor uint64, count int) ([]string, uint64) {
+	if set.vals != nil {
+		return set.index.Scan(cursor, count)
+	}
+	return set.members(), 0
+}
+
+// 随机返回 count 个 member，可能重复，每次抽取的复杂度是 O(1)，不会遍历所有的 member
+func (set *Set) RandomMembers(count int) []string {
+	if set.Len() == 0 {
+		return []string{}
+	}
+	res := make([]string, count)
+	for i := range res {
+		res[i] = set.randomMember()
+	}
+	return res
+}
+
+// 随机返回 count 个不重复的 member，count 大于 member 个数时返回所有 member
+func (set *Set) RandomDistinctMembers(count int) []string {
+	//需要的 member 比较多的时候，随机抽取很容易抽到重复的 member，直接打乱所有的 member
+	if count*2 >= set.Len() {
+		members := set.members()
+		if count >= len(members) {
+			return members
+		}
+		//只需要打乱前 count 个位置
+		for i := 0; i < count; i++ {
+			j := i + rand.Intn(len(members)-i)
+			members[i], members[j] = members[j], members[i]
+		}
+		return members[:count]
+	}
 
-		if key == "" {
+	selected := make(map[string]struct{}, count)
+	members := make([]string, 0, count)
+	for len(members) < count {
+		member := set.randomMember()
+		if _, ok := selected[member]; ok {
 			continue
 		}
+		selected[member] = struct{}{}
+		members = append(members, member)
+	}
+	return members
+}
 
-		keys[i] = []byte(key)
-		i++
+// 随机返回一个 member，调用方需要保证 set 不为空，两种编码都直接随机下标
+func (set *Set) randomMember() string {
+	if set.vals != nil {
+		return set.entries[rand.Intn(len(set.entries))]
 	}
-	return keys
+	return strconv.FormatInt(set.intset[rand.Intn(len(set.intset))], 10)
 }
 
-func MakeSet(size int64) *Set {
-	s := &Set{
-		vals: make(map[string]struct{}, size),
+func (set *Set) Copy() *Set {
+	res := MakeSet(set.maxIntsetEntries)
+	if set.vals != nil {
+		res.vals = make(map[string]int, len(set.vals))
+		for member, i := range set.vals {
+			res.vals[member] = i
+		}
+		res.entries = make([]string, len(set.entries))
+		copy(res.entries, set.entries)
+		res.index = dict.MakeScanIndex()
+		for _, member := range res.entries {
+			res.index.Add(member)
+		}
+		return res
 	}
-	return s
+	res.intset = make([]int64, len(set.intset))
+	copy(res.intset, set.intset)
+	return res
+}
+
+func (set *Set) members() []string {
+	members := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// 返回 value 在 intset 中的位置，不存在时返回应该插入的位置
+func (set *Set) search(value int64) (int, bool) {
+	i := sort.Search(len(set.intset), func(i int) bool {
+		return set.intset[i] >= value
+	})
+	return i, i < len(set.intset) && set.intset[i] == value
+}
+
+func (set *Set) convertToHashtable() {
+	set.vals = make(map[string]int, len(set.intset))
+	set.entries = make([]string, 0, len(set.intset))
+	set.index = dict.MakeScanIndex()
+	for _, value := range set.intset {
+		member := strconv.FormatInt(value, 10)
+		set.vals[member] = len(set.entries)
+		set.entries = append(set.entries, member)
+		set.index.Add(member)
+	}
+	set.intset = nil
+}
+
+// 只有格式规范的整数才能保存到 intset 中，比如 "01"、"+1" 转换回字符串之后和原来的不一致，只能当作字符串保存
+func parseInt(v string) (int64, bool) {
+	value, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != v {
+		return 0, false
+	}
+	return value, true
+}
+
+// 多个 set 的交集，从元素最少的 set 开始遍历
+func Intersect(sets ...*Set) *Set {
+	if len(sets) == 0 {
+		return MakeSet(0)
+	}
+	smallest := sets[0]
+	for _, s := range sets[1:] {
+		if s.Len() < smallest.Len() {
+			smallest = s
+		}
+	}
+
+	res := MakeSet(sets[0].maxIntsetEntries)
+	smallest.ForEach(func(member string) bool {
+		for _, s := range sets {
+			if !s.Exist(member) {
+				return true
+			}
+		}
+		res.Add(member)
+		return true
+	})
+	return res
+}
+
+// 多个 set 的并集
+func Union(sets ...*Set) *Set {
+	if len(sets) == 0 {
+		return MakeSet(0)
+	}
+	res := MakeSet(sets[0].maxIntsetEntries)
+	for _, s := range sets {
+		s.ForEach(func(member string) bool {
+			res.Add(member)
+			return true
+		})
+	}
+	return res
+}
+
+// 第一个 set 和其他所有 set 的差集
+func Diff(first *Set, others ...*Set) *Set {
+	res := MakeSet(first.maxIntsetEntries)
+	first.ForEach(func(member string) bool {
+		for _, s := range others {
+			if s.Exist(member) {
+				return true
+			}
+		}
+		res.Add(member)
+		return true
+	})
+	return res
 }
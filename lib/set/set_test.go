@@ -1,6 +1,7 @@
 package set
 
 import (
+	"strconv"
 	"testing"
 )
 
@@ -31,3 +32,171 @@ func TestSet_Members(t *testing.T) {
 		t.Errorf("sm[0] = %s, but want = %s", string(sm[0]), "key")
 	}
 }
+
+func TestSet_Del(t *testing.T) {
+	s := MakeSet(0)
+	s.Add("a")
+	if s.Del("a") != 1 || s.Del("a") != 0 || s.Len() != 0 {
+		t.Errorf("s.Del() should return whether the member is removed")
+	}
+}
+
+func TestSet_Random(t *testing.T) {
+	s := MakeSet(0)
+	for _, member := range []string{"a", "b", "c"} {
+		s.Add(member)
+	}
+	distinct := s.RandomDistinctMembers(2)
+	if len(distinct) != 2 || distinct[0] == distinct[1] {
+		t.Errorf("s.RandomDistinctMembers(2) = %v", distinct)
+	}
+	if all := s.RandomDistinctMembers(10); len(all) != 3 {
+		t.Errorf("s.RandomDistinctMembers(10) = %v", all)
+	}
+	for _, member := range s.RandomMembers(10) {
+		if !s.Exist(member) {
+			t.Errorf("s.RandomMembers() returns %s which is not in set", member)
+		}
+	}
+	if len(MakeSet(0).RandomMembers(3)) != 0 {
+		t.Errorf("RandomMembers of empty set should be empty")
+	}
+	//两种编码删除之后随机抽取的仍然是存在的 member，并且每个 member 都能被抽到
+	for _, maxIntsetEntries := range []int{512, 0} {
+		s = MakeSet(maxIntsetEntries)
+		for i := 0; i < 100; i++ {
+			s.Add(strconv.Itoa(i))
+		}
+		for i := 0; i < 100; i += 2 {
+			s.Del(strconv.Itoa(i))
+		}
+		counts := make(map[string]int)
+		for _, member := range s.RandomMembers(50000) {
+			counts[member]++
+		}
+		for i := 1; i < 100; i += 2 {
+			if c := counts[strconv.Itoa(i)]; c < 500 || c > 1500 {
+				t.Errorf("%s: member %d is sampled %d times, want about 1000", s.Encoding(), i, c)
+			}
+		}
+		if len(counts) != 50 {
+			t.Errorf("%s: s.RandomMembers() returned %d distinct members, want 50", s.Encoding(), len(counts))
+		}
+		seen := make(map[string]struct{})
+		for _, member := range s.RandomDistinctMembers(3) {
+			if !s.Exist(member) {
+				t.Fatalf("%s: unknown member %s", s.Encoding(), member)
+			}
+			seen[member] = struct{}{}
+		}
+		if len(seen) != 3 {
+			t.Errorf("%s: s.RandomDistinctMembers(3) should return 3 distinct members", s.Encoding())
+		}
+	}
+}
+
+func TestSet_Operations(t *testing.T) {
+	s1, s2, s3 := MakeSet(0), MakeSet(0), MakeSet(0)
+	for _, member := range []string{"a", "b", "c"} {
+		s1.Add(member)
+	}
+	s2.Add("b")
+	s2.Add("c")
+	s2.Add("d")
+	s3.Add("c")
+
+	if res := Intersect(s1, s2, s3); res.Len() != 1 || !res.Exist("c") {
+		t.Errorf("Intersect() = %v", res.Members())
+	}
+	if res := Union(s1, s2); res.Len() != 4 {
+		t.Errorf("Union() = %v", res.Members())
+	}
+	if res := Diff(s1, s2); res.Len() != 1 || !res.Exist("a") {
+		t.Errorf("Diff() = %v", res.Members())
+	}
+
+	c := s1.Copy()
+	c.Del("a")
+	if !s1.Exist("a") {
+		t.Errorf("s.Copy() should not share members")
+	}
+}
+
+func TestSet_Intset(t *testing.T) {
+	s := MakeSet(3)
+	for _, member := range []string{"3", "-1", "2", "3"} {
+		s.Add(member)
+	}
+	if s.Encoding() != EncodingIntset || s.Len() != 3 {
+		t.Fatalf("s.Encoding() = %s, len = %d", s.Encoding(), s.Len())
+	}
+	members := s.Members()
+	if string(members[0]) != "-1" || string(members[1]) != "2" || string(members[2]) != "3" {
+		t.Errorf("intset members should be sorted, got %q", members)
+	}
+	if !s.Exist("2") || s.Exist("02") || s.Exist("a") || s.Del("a") != 0 {
+		t.Errorf("s.Exist() failed on intset")
+	}
+	if s.Del("2") != 1 || s.Len() != 2 || s.Encoding() != EncodingIntset {
+		t.Errorf("s.Del() failed on intset")
+	}
+
+	//非规范格式的整数需要当作字符串保存
+	s.Add("010")
+	if s.Encoding() != EncodingHashtable || !s.Exist("010") || !s.Exist("-1") || s.Exist("10") {
+		t.Errorf("s.Add(010) should convert to hashtable")
+	}
+
+	s = MakeSet(2)
+	s.Add("1")
+	s.Add("2")
+	c := s.Copy()
+	s.Add("3")
+	if s.Encoding() != EncodingHashtable || s.Len() != 3 {
+		t.Errorf("set with more than max intset entries should convert to hashtable")
+	}
+	if c.Encoding() != EncodingIntset || c.Len() != 2 {
+		t.Errorf("s.Copy() should keep the encoding")
+	}
+}
+
+func TestSet_Scan(t *testing.T) {
+	s := MakeSet(4)
+	for i := 0; i < 4; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	//intset 编码一次返回所有的 member
+	if members, next := s.Scan(0, 1); len(members) != 4 || next != 0 {
+		t.Errorf("s.Scan() on intset = %v, %d", members, next)
+	}
+
+	for i := 4; i < 100; i++ {
+		s.Add(strconv.Itoa(i))
+	}
+	s.Del("50")
+	c := s.Copy()
+	c.Del("60")
+	for _, tt := range []struct {
+		s    *Set
+		want int
+	}{{s, 99}, {c, 98}} {
+		seen := make(map[string]bool)
+		cursor := uint64(0)
+		for {
+			members, next := tt.s.Scan(cursor, 10)
+			for _, member := range members {
+				if seen[member] || !tt.s.Exist(member) {
+					t.Fatalf("s.Scan() returned %s twice or a removed member", member)
+				}
+				seen[member] = true
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+		if len(seen) != tt.want {
+			t.Errorf("s.Scan() returned %d members, want %d", len(seen), tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package skiplist
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// 范围查询的边界，作为下界时使用 lessEqual，作为上界时使用 greaterEqual
+type Border interface {
+	lessEqual(n *Node) bool    // 边界 <= 节点
+	greaterEqual(n *Node) bool // 边界 >= 节点
+}
+
+// score 边界：1.5、(1.5（不包含）、-inf、+inf
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool
+}
+
+func (b ScoreBorder) lessEqual(n *Node) bool {
+	if b.Exclude {
+		return b.Value < n.Score
+	}
+	return b.Value <= n.Score
+}
+
+func (b ScoreBorder) greaterEqual(n *Node) bool {
+	if b.Exclude {
+		return b.Value > n.Score
+	}
+	return b.Value >= n.Score
+}
+
+var errInvalidBorder = errors.New("invalid border")
+
+func ParseScoreBorder(s string) (ScoreBorder, error) {
+	b := ScoreBorder{}
+	if len(s) > 0 && s[0] == '(' {
+		b.Exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return b, errInvalidBorder
+	}
+	b.Value = value
+	return b, nil
+}
+
+// member 的字典序边界：[a（包含）、(a（不包含）、-（负无穷）、+（正无穷）
+// 只有所有元素的 score 都相同时，按字典序的范围查询才有意义
+type LexBorder struct {
+	Value   string
+	Exclude bool
+	Inf     int // -1 表示负无穷，1 表示正无穷
+}
+
+func (b LexBorder) lessEqual(n *Node) bool {
+	switch {
+	case b.Inf < 0:
+		return true
+	case b.Inf > 0:
+		return false
+	case b.Exclude:
+		return b.Value < n.Member
+	default:
+		return b.Value <= n.Member
+	}
+}
+
+func (b LexBorder) greaterEqual(n *Node) bool {
+	switch {
+	case b.Inf > 0:
+		return true
+	case b.Inf < 0:
+		return false
+	case b.Exclude:
+		return b.Value > n.Member
+	default:
+		return b.Value >= n.Member
+	}
+}
+
+func ParseLexBorder(s string) (LexBorder, error) {
+	switch {
+	case s == "-":
+		return LexBorder{Inf: -1}, nil
+	case s == "+":
+		return LexBorder{Inf: 1}, nil
+	case len(s) > 0 && s[0] == '(':
+		return LexBorder{Value: s[1:], Exclude: true}, nil
+	case len(s) > 0 && s[0] == '[':
+		return LexBorder{Value: s[1:]}, nil
+	default:
+		return LexBorder{}, errInvalidBorder
+	}
+}
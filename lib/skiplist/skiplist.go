@@ -0,0 +1,359 @@
+package skiplist
+
+import "math/rand"
+
+// 跳表：节点按照 (score, member) 排序，和 redis 的 zskiplist 一致
+// 1. 每一层的 forward 指针都记录了 span（跨过的节点数），查找时累加 span 就能得到排名，按排名查找和计算排名都是 O(logN)
+// 2. 第 0 层是一个双向链表，可以从任意节点向前或者向后遍历
+// 跳表不是并发安全的，调用方需要对 key 加锁
+
+const (
+	maxLevel    = 32
+	probability = 0.25 // 节点有第 i+1 层的概率
+)
+
+type Element struct {
+	Member string
+	Score  float64
+}
+
+type level struct {
+	forward *Node
+	span    int64 // 到 forward 之间跨过的节点数，forward 为 nil 时是到表尾的节点数
+}
+
+type Node struct {
+	Element
+	backward *Node
+	levels   []level
+}
+
+// 后一个节点，没有时返回 nil
+func (n *Node) Next() *Node {
+	return n.levels[0].forward
+}
+
+// 前一个节点，没有时返回 nil
+func (n *Node) Prev() *Node {
+	return n.backward
+}
+
+type SkipList struct {
+	header *Node // 不保存元素的头节点
+	tail   *Node
+	length int64
+	level  int
+}
+
+func MakeSkipList() *SkipList {
+	return &SkipList{
+		header: makeNode(maxLevel, "", 0),
+		level:  1,
+	}
+}
+
+func makeNode(height int, member string, score float64) *Node {
+	return &Node{
+		Element: Element{Member: member, Score: score},
+		levels:  make([]level, height),
+	}
+}
+
+func randomLevel() int {
+	l := 1
+	for l < maxLevel && rand.Float64() < probability {
+		l++
+	}
+	return l
+}
+
+func (sl *SkipList) Len() int64 {
+	return sl.length
+}
+
+// 第一个节点，跳表为空时返回 nil
+func (sl *SkipList) First() *Node {
+	return sl.header.levels[0].forward
+}
+
+// 最后一个节点，跳表为空时返回 nil
+func (sl *SkipList) Last() *Node {
+	return sl.tail
+}
+
+// n 是否排在 (score, member) 之前
+func lessThan(n *Node, score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+// 插入元素，调用方需要保证 member 不在跳表中
+func (sl *SkipList) Insert(member string, score float64) *Node {
+	var update [maxLevel]*Node
+	var rank [maxLevel]int64
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && lessThan(x.levels[i].forward, score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	l := randomLevel()
+	if l > sl.level {
+		for i := sl.level; i < l; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = l
+	}
+
+	x = makeNode(l, member, score)
+	for i := 0; i < l; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	//更高的层跨过了新节点
+	for i := l; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+// 删除元素，元素不存在时返回 false
+func (sl *SkipList) Delete(member string, score float64) bool {
+	var update [maxLevel]*Node
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && lessThan(x.levels[i].forward, score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.Score != score || x.Member != member {
+		return false
+	}
+	sl.deleteNode(x, update[:])
+	return true
+}
+
+// update[i] 是第 i 层中 x 之前的节点
+func (sl *SkipList) deleteNode(x *Node, update []*Node) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// 元素的排名，从 1 开始，元素不存在时返回 0
+func (sl *SkipList) GetRank(member string, score float64) int64 {
+	var rank int64
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && (lessThan(x.levels[i].forward, score, member) ||
+			x.levels[i].forward.Score == score && x.levels[i].forward.Member == member) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != sl.header && x.Score == score && x.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// 按排名查找节点，排名从 1 开始，超出范围时返回 nil
+func (sl *SkipList) GetByRank(rank int64) *Node {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+	var traversed int64
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// 第一个在 [min, max] 范围内的节点，没有时返回 nil
+func (sl *SkipList) FirstInRange(min, max Border) *Node {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !min.lessEqual(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+	x = x.levels[0].forward
+	if x == nil || !max.greaterEqual(x) {
+		return nil
+	}
+	return x
+}
+
+// 最后一个在 [min, max] 范围内的节点，没有时返回 nil
+func (sl *SkipList) LastInRange(min, max Border) *Node {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && max.greaterEqual(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == sl.header || !min.lessEqual(x) {
+		return nil
+	}
+	return x
+}
+
+// 删除 [min, max] 范围内的节点，返回被删除的元素
+func (sl *SkipList) DeleteRange(min, max Border) []Element {
+	var update [maxLevel]*Node
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !min.lessEqual(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	removed := make([]Element, 0)
+	x = x.levels[0].forward
+	for x != nil && max.greaterEqual(x) {
+		next := x.levels[0].forward
+		sl.deleteNode(x, update[:])
+		removed = append(removed, x.Element)
+		x = next
+	}
+	return removed
+}
+
+// 删除排名在 [start, stop] 范围内的节点，排名从 1 开始，返回被删除的元素
+func (sl *SkipList) DeleteRangeByRank(start, stop int64) []Element {
+	var update [maxLevel]*Node
+	var traversed int64
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span < start {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	removed := make([]Element, 0)
+	traversed++
+	x = x.levels[0].forward
+	for x != nil && traversed <= stop {
+		next := x.levels[0].forward
+		sl.deleteNode(x, update[:])
+		removed = append(removed, x.Element)
+		traversed++
+		x = next
+	}
+	return removed
+}
+
+// 返回排名在 [start, stop] 范围内的元素，排名从 1 开始，reverse 为 true 时排名从尾部开始计算
+func (sl *SkipList) RangeByRank(start, stop int64, reverse bool) []Element {
+	if start < 1 {
+		start = 1
+	}
+	if stop > sl.length {
+		stop = sl.length
+	}
+	if start > stop {
+		return []Element{}
+	}
+
+	res := make([]Element, 0, stop-start+1)
+	var n *Node
+	if reverse {
+		n = sl.GetByRank(sl.length - start + 1)
+	} else {
+		n = sl.GetByRank(start)
+	}
+	for i := start; i <= stop && n != nil; i++ {
+		res = append(res, n.Element)
+		if reverse {
+			n = n.Prev()
+		} else {
+			n = n.Next()
+		}
+	}
+	return res
+}
+
+// 返回 [min, max] 范围内的元素，跳过前 offset 个，最多返回 limit 个，limit 小于 0 时不限制个数
+// reverse 为 true 时从 max 开始向 min 遍历
+func (sl *SkipList) Range(min, max Border, offset, limit int64, reverse bool) []Element {
+	var n *Node
+	if reverse {
+		n = sl.LastInRange(min, max)
+	} else {
+		n = sl.FirstInRange(min, max)
+	}
+	//通过排名直接跳过 offset 个元素
+	if n != nil && offset > 0 {
+		rank := sl.GetRank(n.Member, n.Score)
+		if reverse {
+			n = sl.GetByRank(rank - offset)
+		} else {
+			n = sl.GetByRank(rank + offset)
+		}
+	}
+
+	res := make([]Element, 0)
+	for n != nil && (limit < 0 || int64(len(res)) < limit) {
+		if reverse {
+			if !min.lessEqual(n) {
+				break
+			}
+			res = append(res, n.Element)
+			n = n.Prev()
+		} else {
+			if !max.greaterEqual(n) {
+				break
+			}
+			res = append(res, n.Element)
+			n = n.Next()
+		}
+	}
+	return res
+}
@@ -0,0 +1,144 @@
+package skiplist
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// 用排好序的 slice 作为对照，随机插入、删除之后比较排名和范围查询的结果
+func TestSkipList_Random(t *testing.T) {
+	sl := MakeSkipList()
+	model := make([]Element, 0)
+	sortModel := func() {
+		sort.Slice(model, func(i, j int) bool {
+			if model[i].Score != model[j].Score {
+				return model[i].Score < model[j].Score
+			}
+			return model[i].Member < model[j].Member
+		})
+	}
+	indexOf := func(member string) int {
+		for i, e := range model {
+			if e.Member == member {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for i := 0; i < 2000; i++ {
+		member := strconv.Itoa(rand.Intn(300))
+		score := float64(rand.Intn(50))
+		if index := indexOf(member); index >= 0 {
+			if !sl.Delete(member, model[index].Score) {
+				t.Fatalf("sl.Delete(%s) = false", member)
+			}
+			model = append(model[:index], model[index+1:]...)
+			if rand.Intn(2) == 0 {
+				continue
+			}
+		}
+		sl.Insert(member, score)
+		model = append(model, Element{Member: member, Score: score})
+		sortModel()
+	}
+
+	if sl.Len() != int64(len(model)) {
+		t.Fatalf("sl.Len() = %d, want %d", sl.Len(), len(model))
+	}
+	for i, e := range model {
+		if rank := sl.GetRank(e.Member, e.Score); rank != int64(i+1) {
+			t.Fatalf("sl.GetRank(%s) = %d, want %d", e.Member, rank, i+1)
+		}
+		if n := sl.GetByRank(int64(i + 1)); n == nil || n.Element != e {
+			t.Fatalf("sl.GetByRank(%d) = %v, want %v", i+1, n, e)
+		}
+	}
+	if sl.Last().Element != model[len(model)-1] || sl.First().Prev() != nil {
+		t.Fatalf("backward links are broken")
+	}
+
+	got := sl.RangeByRank(1, sl.Len(), false)
+	if !reflect.DeepEqual(got, model) {
+		t.Fatalf("sl.RangeByRank() mismatch")
+	}
+
+	min := ScoreBorder{Value: 10, Exclude: true}
+	max := ScoreBorder{Value: 20}
+	want := make([]Element, 0)
+	for _, e := range model {
+		if e.Score > 10 && e.Score <= 20 {
+			want = append(want, e)
+		}
+	}
+	if got := sl.Range(min, max, 0, -1, false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sl.Range() = %v, want %v", got, want)
+	}
+	if len(want) > 3 {
+		if got := sl.Range(min, max, 2, 1, false); !reflect.DeepEqual(got, want[2:3]) {
+			t.Fatalf("sl.Range() with limit = %v, want %v", got, want[2:3])
+		}
+		if got := sl.Range(min, max, 1, 1, true); !reflect.DeepEqual(got, want[len(want)-2:len(want)-1]) {
+			t.Fatalf("sl.Range() reverse = %v", got)
+		}
+	}
+
+	removed := sl.DeleteRange(min, max)
+	if !reflect.DeepEqual(removed, want) {
+		t.Fatalf("sl.DeleteRange() = %v, want %v", removed, want)
+	}
+	removed = sl.DeleteRangeByRank(2, 5)
+	if sl.Len() != int64(len(model)-len(want)-4) || len(removed) != 4 {
+		t.Fatalf("sl.DeleteRangeByRank() removed %d elements", len(removed))
+	}
+	prev := Element{Score: math.Inf(-1)}
+	for n := sl.First(); n != nil; n = n.Next() {
+		if n.Score < prev.Score || (n.Score > 10 && n.Score <= 20) {
+			t.Fatalf("unexpected element %v after delete", n.Element)
+		}
+		prev = n.Element
+	}
+}
+
+func TestSkipList_LexRange(t *testing.T) {
+	sl := MakeSkipList()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		sl.Insert(member, 0)
+	}
+
+	tests := []struct {
+		min, max string
+		want     []string
+	}{
+		{"-", "+", []string{"a", "b", "c", "d", "e"}},
+		{"[b", "(d", []string{"b", "c"}},
+		{"(b", "[d", []string{"c", "d"}},
+		{"[z", "+", []string{}},
+		{"+", "-", []string{}},
+	}
+	for _, tt := range tests {
+		min, _ := ParseLexBorder(tt.min)
+		max, _ := ParseLexBorder(tt.max)
+		got := make([]string, 0)
+		for _, e := range sl.Range(min, max, 0, -1, false) {
+			got = append(got, e.Member)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Range(%s, %s) = %v, want %v", tt.min, tt.max, got, tt.want)
+		}
+	}
+
+	if _, err := ParseLexBorder("b"); err == nil {
+		t.Errorf("ParseLexBorder(b) should return error")
+	}
+	if b, err := ParseScoreBorder("(1.5"); err != nil || !b.Exclude || b.Value != 1.5 {
+		t.Errorf("ParseScoreBorder((1.5) = %v, %v", b, err)
+	}
+	if b, err := ParseScoreBorder("-inf"); err != nil || !math.IsInf(b.Value, -1) {
+		t.Errorf("ParseScoreBorder(-inf) = %v, %v", b, err)
+	}
+}
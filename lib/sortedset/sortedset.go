@@ -0,0 +1,137 @@
+package sortedset
+
+import (
+	"github.com/chenjiayao/goredistraning/lib/dict"
+	"github.com/chenjiayao/goredistraning/lib/skiplist"
+)
+
+// 有序集合：map 保存 member ---> score，O(1) 查找 score；跳表按照 (score, member) 排序，支持排名和范围查询
+// 另外用 dict.ScanIndex 按照 scan 的顺序保存所有 member，zscan 只访问返回的 member
+// 排名都从 0 开始
+// 有序集合不是并发安全的，调用方需要对 key 加锁
+type SortedSet struct {
+	dict     map[string]float64
+	skiplist *skiplist.SkipList
+	index    *dict.ScanIndex
+}
+
+func MakeSortedSet() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]float64),
+		skiplist: skiplist.MakeSkipList(),
+		index:    dict.MakeScanIndex(),
+	}
+}
+
+func (z *SortedSet) Len() int64 {
+	return int64(len(z.dict))
+}
+
+// 添加 member 或者更新 member 的 score，member 是新增的时候返回 true
+func (z *SortedSet) Add(member string, score float64) bool {
+	current, exist := z.dict[member]
+	z.dict[member] = score
+	if exist {
+		if current == score {
+			return false
+		}
+		z.skiplist.Delete(member, current)
+	} else {
+		z.index.Add(member)
+	}
+	z.skiplist.Insert(member, score)
+	return !exist
+}
+
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// 删除 member，member 存在时返回 true
+func (z *SortedSet) Remove(member string) bool {
+	score, exist := z.dict[member]
+	if !exist {
+		return false
+	}
+	delete(z.dict, member)
+	z.skiplist.Delete(member, score)
+	z.index.Remove(member)
+	return true
+}
+
+// member 的排名，reverse 为 true 时按照 score 从大到小计算
+func (z *SortedSet) Rank(member string, reverse bool) (int64, bool) {
+	score, exist := z.dict[member]
+	if !exist {
+		return 0, false
+	}
+	rank := z.skiplist.GetRank(member, score) - 1
+	if reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true
+}
+
+// [min, max] 范围内的元素个数
+func (z *SortedSet) Count(min, max skiplist.Border) int64 {
+	first := z.skiplist.FirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := z.skiplist.LastInRange(min, max)
+	return z.skiplist.GetRank(last.Member, last.Score) - z.skiplist.GetRank(first.Member, first.Score) + 1
+}
+
+// 排名在 [start, stop] 范围内的元素，调用方需要保证 0 <= start
+func (z *SortedSet) RangeByRank(start, stop int64, reverse bool) []skiplist.Element {
+	return z.skiplist.RangeByRank(start+1, stop+1, reverse)
+}
+
+// [min, max] 范围内的元素，跳过前 offset 个，最多返回 limit 个，limit 小于 0 时不限制个数
+func (z *SortedSet) Range(min, max skiplist.Border, offset, limit int64, reverse bool) []skiplist.Element {
+	return z.skiplist.Range(min, max, offset, limit, reverse)
+}
+
+// 删除排名在 [start, stop] 范围内的元素，返回删除的个数，调用方需要保证 0 <= start <= stop
+func (z *SortedSet) RemoveRangeByRank(start, stop int64) int64 {
+	removed := z.skiplist.DeleteRangeByRank(start+1, stop+1)
+	for _, e := range removed {
+		delete(z.dict, e.Member)
+		z.index.Remove(e.Member)
+	}
+	return int64(len(removed))
+}
+
+// 删除 [min, max] 范围内的元素，返回删除的个数
+func (z *SortedSet) RemoveRange(min, max skiplist.Border) int64 {
+	removed := z.skiplist.DeleteRange(min, max)
+	for _, e := range removed {
+		delete(z.dict, e.Member)
+		z.index.Remove(e.Member)
+	}
+	return int64(len(removed))
+}
+
+// 按照 score 从小到大遍历，consumer 返回 false 时停止遍历
+func (z *SortedSet) ForEach(consumer func(member string, score float64) bool) {
+	for n := z.skiplist.First(); n != nil; n = n.Next() {
+		if !consumer(n.Member, n.Score) {
+			return
+		}
+	}
+}
+
+// 按照 scan 的顺序从 cursor 开始返回至少 count 个 member，next 为 0 时遍历结束
+func (z *SortedSet) Scan(cursor uint64, count int) ([]string, uint64) {
+	return z.index.Scan(cursor, count)
+}
+
+func (z *SortedSet) Copy() *SortedSet {
+	res := MakeSortedSet()
+	z.ForEach(func(member string, score float64) bool {
+		res.Add(member, score)
+		return true
+	})
+	return res
+}
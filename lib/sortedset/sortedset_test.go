@@ -0,0 +1,50 @@
+package sortedset
+
+import (
+	"math"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/lib/skiplist"
+)
+
+func TestSortedSet(t *testing.T) {
+	z := MakeSortedSet()
+	if !z.Add("a", 1) || !z.Add("b", 2) || !z.Add("c", 3) || z.Add("a", 4) {
+		t.Fatalf("z.Add() should return whether the member is new")
+	}
+	// b:2 c:3 a:4
+	if score, ok := z.Score("a"); !ok || score != 4 {
+		t.Errorf("z.Score(a) = %v, %v", score, ok)
+	}
+	if rank, ok := z.Rank("a", false); !ok || rank != 2 {
+		t.Errorf("z.Rank(a) = %d, %v", rank, ok)
+	}
+	if rank, ok := z.Rank("a", true); !ok || rank != 0 {
+		t.Errorf("z.Rank(a, reverse) = %d, %v", rank, ok)
+	}
+	if _, ok := z.Rank("x", false); ok {
+		t.Errorf("z.Rank(x) should not exist")
+	}
+
+	all := skiplist.ScoreBorder{Value: math.Inf(1)}
+	if count := z.Count(skiplist.ScoreBorder{Value: 2, Exclude: true}, all); count != 2 {
+		t.Errorf("z.Count((2, +inf) = %d, want 2", count)
+	}
+	if got := z.RangeByRank(0, 0, true); len(got) != 1 || got[0].Member != "a" {
+		t.Errorf("z.RangeByRank(0, 0, reverse) = %v", got)
+	}
+
+	if removed := z.RemoveRangeByRank(0, 1); removed != 2 || z.Len() != 1 {
+		t.Errorf("z.RemoveRangeByRank(0, 1) = %d", removed)
+	}
+	c := z.Copy()
+	if !z.Remove("a") || z.Remove("a") || z.Len() != 0 || c.Len() != 1 {
+		t.Errorf("z.Remove(a) failed")
+	}
+	if members, next := z.Scan(0, 10); len(members) != 0 || next != 0 {
+		t.Errorf("z.Scan() after remove = %v, %d", members, next)
+	}
+	if members, next := c.Scan(0, 10); len(members) != 1 || members[0] != "a" || next != 0 {
+		t.Errorf("c.Scan() = %v, %d", members, next)
+	}
+}
@@ -2,16 +2,16 @@ package unboundedchan
 
 //TODO 没有长度的 chan 实现，用于 aof 命令写入
 type UnboundedChan struct {
-	In     chan<- [][]byte
-	Out    <-chan [][]byte
-	Buffer [][][]byte
+	In     chan<- interface{}
+	Out    <-chan interface{}
+	Buffer []interface{}
 }
 
 func MakeUnboundedChan(initial int) *UnboundedChan {
 
-	in := make(chan [][]byte, initial)
-	out := make(chan [][]byte, initial)
-	buffer := make([][][]byte, initial)
+	in := make(chan interface{}, initial)
+	out := make(chan interface{}, initial)
+	buffer := make([]interface{}, 0, initial)
 
 	go func() {
 		defer close(out)
@@ -2,9 +2,14 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"strconv"
 
+	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/redis/request"
 )
 
@@ -14,100 +19,377 @@ func ReadCommand(reader io.Reader) chan request.RedisRequet {
 	return ch
 }
 
+// 从 socket 中解析命令，读取出错（包括客户端关闭）之后退出协程并关闭 ch
 func ParseFromSocket(reader io.Reader, ch chan request.RedisRequet) {
-	buf := bufio.NewReader(reader)
+	defer close(ch)
+	decoder := MakeDecoder(reader)
+	decoder.inline = true
+	decoder.maxBulkLen = config.Config.ProtoMaxBulkLen
+	decoder.maxMultibulkLen = config.Config.ProtoMaxMultibulkLen
+	decoder.queryBufferLimit = config.Config.ClientQueryBufferLimit
 
 	for {
-		cmds := [][]byte{}
-		header, err := buf.ReadBytes('\n')
+		cmds, err := decoder.Decode()
 		if err != nil {
-
 			ch <- request.RedisRequet{
 				Err: err,
 			}
-			//如果是客户端关闭了，那么就不要读了，直接退出当前协程
-			if io.EOF == err {
-				break
-			}
-			continue
+			//读取 socket 出错、客户端关闭了或者协议错误，那么就不要读了，直接退出当前协程
+			return
 		}
 
-		if header[0] != '*' {
-			ch <- request.PROTOCOL_ERROR_REQUEST
-			continue
+		ch <- request.RedisRequet{
+			Args:    cmds,
+			Pending: decoder.Buffered() > 0,
+		}
+	}
+}
+
+// inline 命令一行的最大长度，和 redis 的 PROTO_INLINE_MAX_SIZE 一致
+// 数组和字符串长度的 header 同样不能超过这个长度
+const maxInlineSize = 64 * 1024
+
+// 超过这个长度的参数不会一次性分配内存，而是随着数据的到达逐步扩容
+// 避免客户端只发送了 $536870912\r\n 就让服务端分配 512mb 的内存
+const bigArgSize = 32 * 1024
+
+var (
+	errLineTooLong   = errors.New("line too long")
+	errInvalidLength = errors.New("invalid length")
+)
+
+// Decoder 同步地从 reader 中一条一条解析命令，并且记录已经解析的字节数
+// aof 文件的加载和 socket 的解析使用的是同一套逻辑
+type Decoder struct {
+	reader *countReader
+	buf    *bufio.Reader
+	inline bool //是否支持 inline 命令，只有客户端的请求支持，aof 文件只能是 RESP 格式
+
+	//客户端请求的限制，0 表示不限制，aof 文件不做限制
+	maxBulkLen       int64 //单个参数的最大长度
+	maxMultibulkLen  int   //参数个数的上限
+	queryBufferLimit int64 //单条命令的最大长度
+}
+
+// 记录从底层 reader 中读取的字节数
+type countReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+func MakeDecoder(reader io.Reader) *Decoder {
+	cr := &countReader{
+		reader: reader,
+	}
+	return &Decoder{
+		reader: cr,
+		buf:    bufio.NewReader(cr),
+	}
+}
+
+// 已经消费的字节数，也就是下一条命令在文件中的起始偏移量
+func (d *Decoder) Offset() int64 {
+	return d.reader.count - int64(d.buf.Buffered())
+}
+
+// 已经从底层 reader 读取但是还没有解析的字节数
+func (d *Decoder) Buffered() int {
+	return d.buf.Buffered()
+}
+
+// 解析一条命令，空行以及 *0\r\n 会被跳过
+// err == io.EOF：reader 已经读完，并且没有残留数据
+// err == io.ErrUnexpectedEOF：reader 已经读完，但是最后一条命令不完整
+// err 是 *request.ProtocolError：命令格式错误，需要关闭连接
+// err == request.ErrQueryBufferLimit：命令超过了 client-query-buffer-limit，需要关闭连接
+func (d *Decoder) Decode() ([][]byte, error) {
+	for {
+		first, err := d.buf.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		var cmds [][]byte
+		if d.inline && first[0] != '*' {
+			cmds, err = d.decodeInline()
+		} else {
+			cmds, err = d.decodeMultiBulk()
 		}
-		argsCount, err := parseCmdArgsCount(header)
 		if err != nil {
-			ch <- request.PROTOCOL_ERROR_REQUEST
-			continue
+			return nil, err
+		}
+		if len(cmds) > 0 {
+			return cmds, nil
 		}
+	}
+}
 
-		//依次读取 数组参数
-		// *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-		readArgsFail := false
-		for i := 0; i < argsCount; i++ {
-			argsWithDelimiter, err := buf.ReadBytes('\n')
-			if err != nil {
-				ch <- request.RedisRequet{
-					Err: err,
-				}
-				//如果是客户端关闭了，那么就不要读了，直接退出当前协程
-				if io.EOF == err {
-					break
-				}
-				readArgsFail = true
-				break
-			}
+// *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
+func (d *Decoder) decodeMultiBulk() ([][]byte, error) {
+	start := d.Offset()
+	header, err := d.readLine()
+	if err == errLineTooLong {
+		return nil, request.MakeProtocolError("too big mbulk count string")
+	}
+	if err != nil {
+		return nil, err
+	}
 
-			// $3\r\n
-			if argsWithDelimiter[0] != '$' ||
-				argsWithDelimiter[len(argsWithDelimiter)-1] != '\n' ||
-				argsWithDelimiter[len(argsWithDelimiter)-2] != '\r' {
+	if header[0] != '*' {
+		return nil, request.MakeProtocolError(fmt.Sprintf("expected '*', got '%c'", header[0]))
+	}
+	argsCount, err := parseCmdArgsCount(header)
+	if err != nil || argsCount > math.MaxInt32 || (d.maxMultibulkLen > 0 && argsCount > d.maxMultibulkLen) {
+		return nil, request.MakeProtocolError("invalid multibulk length")
+	}
+	//和 redis 一样，*0\r\n 以及 *-1\r\n 这种参数个数不大于 0 的请求直接忽略
+	if argsCount <= 0 {
+		return nil, nil
+	}
 
-				ch <- request.PROTOCOL_ERROR_REQUEST
-				readArgsFail = true
-				break
-			}
-			cmdLen, err := parseOneCmdArgsLen(argsWithDelimiter)
-			if err != nil {
-				ch <- request.PROTOCOL_ERROR_REQUEST
-				readArgsFail = true
-				break
-			}
+	//依次读取 数组参数，参数个数是客户端发送的，不能完全相信，预分配的空间不超过 1024
+	cmds := make([][]byte, 0, minInt(argsCount, 1024))
+	for i := 0; i < argsCount; i++ {
+		argsWithDelimiter, err := d.readLine()
+		if err == errLineTooLong {
+			return nil, request.MakeProtocolError("too big bulk count string")
+		}
+		if err != nil {
+			return nil, err
+		}
 
-			cmd := make([]byte, cmdLen+2)
-			_, err = io.ReadFull(buf, cmd)
-			if err != nil {
-				ch <- request.PROTOCOL_ERROR_REQUEST
-				readArgsFail = true
-				break
-			}
-			cmds = append(cmds, cmd[:len(cmd)-2])
+		// $3\r\n
+		if argsWithDelimiter[0] != '$' {
+			return nil, request.MakeProtocolError(fmt.Sprintf("expected '$', got '%c'", argsWithDelimiter[0]))
+		}
+		if argsWithDelimiter[len(argsWithDelimiter)-1] != '\n' ||
+			argsWithDelimiter[len(argsWithDelimiter)-2] != '\r' {
+			return nil, request.MakeProtocolError("invalid bulk length")
+		}
+		//请求中不允许出现 $-1\r\n 这种 null bulk string
+		//没有限制时（比如加载 aof）同样不能超过 math.MaxInt32，否则后面计算 cmdLen+2 会溢出
+		cmdLen, err := parseOneCmdArgsLen(argsWithDelimiter)
+		if err != nil || cmdLen < 0 || cmdLen > math.MaxInt32 || (d.maxBulkLen > 0 && int64(cmdLen) > d.maxBulkLen) {
+			return nil, request.MakeProtocolError("invalid bulk length")
+		}
+		//在分配内存之前检查整条命令的长度
+		if d.queryBufferLimit > 0 && d.Offset()-start+int64(cmdLen)+2 > d.queryBufferLimit {
+			return nil, request.ErrQueryBufferLimit
 		}
 
-		if readArgsFail {
+		cmd, err := d.readBulk(cmdLen)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// 读取 n 个字节的参数以及结尾的 \r\n，返回的参数不包含 \r\n
+func (d *Decoder) readBulk(n int) ([]byte, error) {
+	var cmd []byte
+	var err error
+	if n+2 <= bigArgSize {
+		cmd = make([]byte, n+2)
+		_, err = io.ReadFull(d.buf, cmd)
+	} else {
+		buf := bytes.NewBuffer(make([]byte, 0, bigArgSize))
+		_, err = io.CopyN(buf, d.buf, int64(n+2))
+		cmd = buf.Bytes()
+	}
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if cmd[n] != '\r' || cmd[n+1] != '\n' {
+		return nil, request.MakeProtocolError("invalid bulk length")
+	}
+	return cmd[:n], nil
+}
+
+// inline 命令：PING\r\n，set key "hello world"\n
+func (d *Decoder) decodeInline() ([][]byte, error) {
+	line, err := d.readLine()
+	if err == errLineTooLong {
+		return nil, request.MakeProtocolError("too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//和 redis 一样，inline 命令允许只以 \n 结尾
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	args, ok := splitArgs(line)
+	if !ok {
+		return nil, request.MakeProtocolError("unbalanced quotes in request")
+	}
+	return args, nil
+}
+
+// 读取一行（包含结尾的 \n），超过 maxInlineSize 还没有读到 \n 返回 errLineTooLong
+func (d *Decoder) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		slice, err := d.buf.ReadSlice('\n')
+		line = append(line, slice...)
+		if len(line) > maxInlineSize {
+			return nil, errLineTooLong
+		}
+		if err == bufio.ErrBufferFull {
 			continue
 		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return line, nil
+	}
+}
 
-		ch <- request.RedisRequet{
-			Args: cmds,
+// 按照 redis 的 sdssplitargs 规则切分 inline 命令的参数
+// 参数之间以空白字符分隔，双引号中支持 \n \r \t \b \a \xHH 等转义，单引号中只支持 \'
+// 引号不匹配或者闭合的引号后面没有紧跟空白字符，返回 false
+func splitArgs(line []byte) ([][]byte, bool) {
+	args := make([][]byte, 0)
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, true
 		}
+
+		inq := false  //双引号中
+		insq := false //单引号中
+		done := false
+		current := make([]byte, 0)
+		for !done {
+			if inq {
+				if i == len(line) {
+					return nil, false
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					current = append(current, hexDigitToInt(line[i+2])*16+hexDigitToInt(line[i+3]))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if line[i] == '"' {
+					//闭合的引号后面必须是空白字符或者结尾
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else if insq {
+				if i == len(line) {
+					return nil, false
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, false
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else {
+				if i == len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inq = true
+				case '\'':
+					insq = true
+				default:
+					current = append(current, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, current)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexDigitToInt(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
 	}
 }
 
 //解析 header *3\r\n
 func parseCmdArgsCount(header []byte) (int, error) {
-	argsCountAsByte := header[1 : len(header)-2]
-
-	argsCountAsStr := string(argsCountAsByte)
-	argsCount, err := strconv.Atoi(argsCountAsStr)
-	return argsCount, err
+	return parseLength(header)
 }
 
 //$3\r\n
 func parseOneCmdArgsLen(cmd []byte) (int, error) {
-	cmdLenAsByte := cmd[1 : len(cmd)-2]
-	cmdLenAsStr := string(cmdLenAsByte)
-	argsCount, err := strconv.Atoi(cmdLenAsStr)
-	return argsCount, err
+	return parseLength(cmd)
+}
+
+// 解析 *3\r\n、$3\r\n 中的长度，line 必须以 \r\n 结尾，并且至少有一个数字
+func parseLength(line []byte) (int, error) {
+	if len(line) < 4 || line[len(line)-2] != '\r' || line[len(line)-1] != '\n' {
+		return 0, errInvalidLength
+	}
+	return strconv.Atoi(string(line[1 : len(line)-2]))
 }
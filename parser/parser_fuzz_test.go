@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis/request"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+// 任意输入都不能让 parser panic，并且出错之后 ch 一定会被关闭
+func FuzzParseFromSocket(f *testing.F) {
+	seeds := []string{
+		"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n",
+		"*2\r\n$3\r\nGET\r\n$3\r\nke",
+		"PING\r\n",
+		"set key \"hello\\x41 world\" 'a\\'b'\n",
+		"*0\r\n*-1\r\n",
+		"*\n",
+		"*1\r\n$\r\n",
+		"*1\r\n$-1\r\n",
+		"\r\n\n",
+		"",
+		"*1\r\n$9223372036854775807\r\n",
+		"*9223372036854775807\r\n",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	//不限制参数长度和个数，和加载 aof 时一样，只依靠 parser 自身的检查
+	config.LoadDefaultConfig()
+	config.Config.ProtoMaxBulkLen = 0
+	config.Config.ProtoMaxMultibulkLen = 0
+	config.Config.ClientQueryBufferLimit = 0
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ch := make(chan request.RedisRequet)
+		go ParseFromSocket(bytes.NewReader(data), ch)
+
+		for r := range ch {
+			if r.Err == nil && len(r.Args) == 0 {
+				t.Errorf("ParseFromSocket() returned an empty command for %q", data)
+			}
+		}
+	})
+}
+
+// 随机的命令经过 resp 编码之后再解析，结果和原始命令一致
+func TestRoundTrip(t *testing.T) {
+	config.LoadDefaultConfig()
+	roundTrip := func(cmds [][][]byte) bool {
+		var buf bytes.Buffer
+		want := make([][][]byte, 0, len(cmds))
+		for _, args := range cmds {
+			buf.Write(resp.MakeMultiResponse(args).ToContentByte())
+			//parser 会忽略参数个数为 0 的命令
+			if len(args) > 0 {
+				want = append(want, args)
+			}
+		}
+
+		ch := make(chan request.RedisRequet)
+		go ParseFromSocket(&buf, ch)
+		for _, args := range want {
+			r := <-ch
+			if r.Err != nil || len(r.Args) != len(args) {
+				return false
+			}
+			for i := range args {
+				if !bytes.Equal(r.Args[i], args[i]) {
+					return false
+				}
+			}
+		}
+		r := <-ch
+		return r.Err == io.EOF
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 1000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// 超过 bigArgSize 的参数也可以正确地解析
+func TestRoundTrip_BigArg(t *testing.T) {
+	config.LoadDefaultConfig()
+	rnd := rand.New(rand.NewSource(1))
+	args := [][]byte{[]byte("SET"), []byte("key"), make([]byte, bigArgSize*3+7)}
+	rnd.Read(args[2])
+
+	decoder := MakeDecoder(bytes.NewReader(resp.MakeMultiResponse(args).ToContentByte()))
+	got, err := decoder.Decode()
+	if err != nil || len(got) != 3 || !bytes.Equal(got[2], args[2]) {
+		t.Fatalf("decoder.Decode() error = %v, args are not equal", err)
+	}
+}
+
+// 只发送了参数长度，不会一次性分配参数需要的内存
+func TestDecoder_DecodeHugeBulkLen(t *testing.T) {
+	decoder := MakeDecoder(bytes.NewBufferString("*2\r\n$3\r\nGET\r\n$536870911\r\nabc"))
+	_, err := decoder.Decode()
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("decoder.Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// 没有限制时，超大的参数长度不会溢出，返回协议错误
+func TestDecoder_DecodeOverflowBulkLen(t *testing.T) {
+	for _, input := range []string{"*1\r\n$9223372036854775807\r\n", "*1\r\n$2147483648\r\n", "*9223372036854775807\r\n"} {
+		decoder := MakeDecoder(bytes.NewBufferString(input))
+		_, err := decoder.Decode()
+		if _, ok := err.(*request.ProtocolError); !ok {
+			t.Errorf("decoder.Decode(%q) error = %v, want protocol error", input, err)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package parser
 
 import (
 	"bytes"
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/redis/request"
 )
 
 func TestParseFromSocket(t *testing.T) {
-
+	config.LoadDefaultConfig()
 	var buf bytes.Buffer
 	buf.Write([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"))
 	ch := make(chan request.RedisRequet)
@@ -102,3 +105,282 @@ func Test_parseOneCmdArgsLen(t *testing.T) {
 		})
 	}
 }
+
+func TestDecoder_Decode(t *testing.T) {
+	first := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	var buf bytes.Buffer
+	buf.Write([]byte(first + "*2\r\n$3\r\nGET\r\n$3\r\nke"))
+	decoder := MakeDecoder(&buf)
+
+	cmd, err := decoder.Decode()
+	if err != nil || len(cmd) != 3 {
+		t.Fatalf("decoder.Decode() = %v, %v, want 3 args", cmd, err)
+	}
+	if decoder.Offset() != int64(len(first)) {
+		t.Errorf("decoder.Offset() = %d, want %d", decoder.Offset(), len(first))
+	}
+
+	_, err = decoder.Decode()
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("decoder.Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func Test_splitArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   []string
+		wantOk bool
+	}{
+		{
+			name:   "empty",
+			line:   "",
+			want:   []string{},
+			wantOk: true,
+		},
+		{
+			name:   "only spaces",
+			line:   "  \t ",
+			want:   []string{},
+			wantOk: true,
+		},
+		{
+			name:   "simple",
+			line:   "set key value",
+			want:   []string{"set", "key", "value"},
+			wantOk: true,
+		},
+		{
+			name:   "multiple spaces",
+			line:   "  set   key\tvalue  ",
+			want:   []string{"set", "key", "value"},
+			wantOk: true,
+		},
+		{
+			name:   "double quotes",
+			line:   `set key "hello world"`,
+			want:   []string{"set", "key", "hello world"},
+			wantOk: true,
+		},
+		{
+			name:   "double quotes with escapes",
+			line:   `set key "a\nb\r\t\"c\\"`,
+			want:   []string{"set", "key", "a\nb\r\t\"c\\"},
+			wantOk: true,
+		},
+		{
+			name:   "double quotes with hex escape",
+			line:   `set key "\x41\x62\xzz"`,
+			want:   []string{"set", "key", "Abxzz"},
+			wantOk: true,
+		},
+		{
+			name:   "single quotes",
+			line:   `set key 'hello "world" \n \'x\''`,
+			want:   []string{"set", "key", `hello "world" \n 'x'`},
+			wantOk: true,
+		},
+		{
+			name:   "empty quoted arg",
+			line:   `set key ""`,
+			want:   []string{"set", "key", ""},
+			wantOk: true,
+		},
+		{
+			name:   "quote in the middle of arg",
+			line:   `set foo"bar baz"`,
+			want:   []string{"set", "foobar baz"},
+			wantOk: true,
+		},
+		{
+			name:   "unbalanced double quotes",
+			line:   `set key "value`,
+			wantOk: false,
+		},
+		{
+			name:   "unbalanced single quotes",
+			line:   `set key 'value`,
+			wantOk: false,
+		},
+		{
+			name:   "closing quote followed by non space",
+			line:   `set key "value"x`,
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := splitArgs([]byte(tt.line))
+			if ok != tt.wantOk {
+				t.Fatalf("splitArgs() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitArgs() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if string(got[i]) != tt.want[i] {
+					t.Errorf("splitArgs()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFromSocket_Inline(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "ping",
+			input: "PING\r\n",
+			want:  []string{"PING"},
+		},
+		{
+			name:  "only \\n",
+			input: "GET key\n",
+			want:  []string{"GET key"},
+		},
+		{
+			name:  "skip empty lines",
+			input: "\r\n  \r\nset key \"hello world\"\r\n",
+			want:  []string{"set key hello world"},
+		},
+		{
+			name:  "inline mixed with multibulk",
+			input: "PING\r\n*2\r\n$3\r\nGET\r\n$3\r\nkey\r\nECHO 'a b'\r\n",
+			want:  []string{"PING", "GET key", "ECHO a b"},
+		},
+		{
+			name:    "unbalanced quotes",
+			input:   "set key \"value\r\nPING\r\n",
+			wantErr: "ERR Protocol error: unbalanced quotes in request",
+		},
+		{
+			name:    "too big inline request",
+			input:   strings.Repeat("a", maxInlineSize+1),
+			wantErr: "ERR Protocol error: too big inline request",
+		},
+		{
+			name:    "too big mbulk count string",
+			input:   "*" + strings.Repeat("1", maxInlineSize+1),
+			wantErr: "ERR Protocol error: too big mbulk count string",
+		},
+	}
+	config.LoadDefaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan request.RedisRequet)
+			go ParseFromSocket(bytes.NewBufferString(tt.input), ch)
+
+			for _, want := range tt.want {
+				r := <-ch
+				if r.Err != nil || r.ToStrings() != want {
+					t.Fatalf("ParseFromSocket() = %q, %v, want %q", r.ToStrings(), r.Err, want)
+				}
+			}
+			r := <-ch
+			if tt.wantErr == "" {
+				if r.Err != io.EOF {
+					t.Errorf("ParseFromSocket() error = %v, want %v", r.Err, io.EOF)
+				}
+				return
+			}
+			if _, ok := r.Err.(*request.ProtocolError); !ok || r.Err.Error() != tt.wantErr {
+				t.Errorf("ParseFromSocket() error = %v, want %s", r.Err, tt.wantErr)
+			}
+			//协议错误之后不再继续解析
+			if _, ok := <-ch; ok {
+				t.Errorf("ParseFromSocket() should close ch after protocol error")
+			}
+		})
+	}
+}
+
+func TestParseFromSocket_Limit(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "skip empty multibulk",
+			input: "*0\r\n*-1\r\n*1\r\n$4\r\nPING\r\n",
+			want:  []string{"PING"},
+		},
+		{
+			name:    "invalid multibulk length",
+			input:   "*a\r\n",
+			wantErr: "ERR Protocol error: invalid multibulk length",
+		},
+		{
+			name:    "too many args",
+			input:   "*2147483647\r\n",
+			wantErr: "ERR Protocol error: invalid multibulk length",
+		},
+		{
+			name:    "expected $",
+			input:   "*1\r\n+PING\r\n",
+			wantErr: "ERR Protocol error: expected '$', got '+'",
+		},
+		{
+			name:    "null bulk string",
+			input:   "*2\r\n$3\r\nGET\r\n$-1\r\n",
+			wantErr: "ERR Protocol error: invalid bulk length",
+		},
+		{
+			name:    "negative bulk length",
+			input:   "*2\r\n$3\r\nGET\r\n$-5\r\n",
+			wantErr: "ERR Protocol error: invalid bulk length",
+		},
+		{
+			name:    "bulk length larger than proto-max-bulk-len",
+			input:   "*2\r\n$3\r\nGET\r\n$4000000000\r\n",
+			wantErr: "ERR Protocol error: invalid bulk length",
+		},
+		{
+			name:    "client query buffer limit",
+			input:   "*2\r\n$3\r\nGET\r\n$2000\r\n",
+			wantErr: request.ErrQueryBufferLimit.Error(),
+		},
+	}
+
+	config.LoadDefaultConfig()
+	config.Config.ProtoMaxMultibulkLen = 1024
+	config.Config.ClientQueryBufferLimit = 1024
+	defer config.LoadDefaultConfig()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan request.RedisRequet)
+			go ParseFromSocket(bytes.NewBufferString(tt.input), ch)
+
+			for _, want := range tt.want {
+				r := <-ch
+				if r.Err != nil || r.ToStrings() != want {
+					t.Fatalf("ParseFromSocket() = %q, %v, want %q", r.ToStrings(), r.Err, want)
+				}
+			}
+			r := <-ch
+			if tt.wantErr == "" {
+				if r.Err != io.EOF {
+					t.Errorf("ParseFromSocket() error = %v, want %v", r.Err, io.EOF)
+				}
+				return
+			}
+			if r.Err == nil || r.Err.Error() != tt.wantErr {
+				t.Errorf("ParseFromSocket() error = %v, want %s", r.Err, tt.wantErr)
+			}
+			if _, ok := <-ch; ok {
+				t.Errorf("ParseFromSocket() should close ch after error")
+			}
+		})
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/chenjiayao/goredistraning/interface/response"
 )
 
+// hello 命令返回的 redis 版本
+const Version = "6.2.0"
+
 type ExecCommandFunc func(conn conn.Conn, db *RedisDB, args [][]byte) response.Response
 type ValidateDBCmdArgsFunc func(conn conn.Conn, args [][]byte) error
 
@@ -40,11 +43,72 @@ const (
 	Lindex    = "lindex"
 	Lset      = "lset"
 	Lrange    = "lrange"
+	Lmove     = "lmove"
+	Linsert   = "linsert"
+	Ltrim     = "ltrim"
+	Lpos      = "lpos"
 	Blpop     = "blpop"
 	Brpop     = "brpop"
+	Blmove    = "blmove"
+
+	//hash
+	Hset         = "hset"
+	Hsetnx       = "hsetnx"
+	Hget         = "hget"
+	Hexists      = "hexists"
+	Hdel         = "hdel"
+	Hlen         = "hlen"
+	Hstrlen      = "hstrlen"
+	Hmget        = "hmget"
+	Hmset        = "hmset"
+	Hkeys        = "hkeys"
+	Hvals        = "hvals"
+	Hgetall      = "hgetall"
+	Hincrby      = "hincrby"
+	Hincrbyfloat = "hincrbyfloat"
+	Hrandfield   = "hrandfield"
+	Hscan        = "hscan"
+
+	//sorted set
+	Zadd             = "zadd"
+	Zscore           = "zscore"
+	Zincrby          = "zincrby"
+	Zrank            = "zrank"
+	Zrevrank         = "zrevrank"
+	Zcount           = "zcount"
+	Zcard            = "zcard"
+	Zrange           = "zrange"
+	Zrevrange        = "zrevrange"
+	Zrangebyscore    = "zrangebyscore"
+	Zrevrangebyscore = "zrevrangebyscore"
+	Zrem             = "zrem"
+	Zremrangebyscore = "zremrangebyscore"
+	Zremrangebyrank  = "zremrangebyrank"
+	Zremrangebylex   = "zremrangebylex"
+	Zscan            = "zscan"
 
 	//common
-	Expire = "expire"
+	Expire      = "expire"
+	Pexpire     = "pexpire"
+	Expireat    = "expireat"
+	Pexpireat   = "pexpireat"
+	TTL         = "ttl"
+	Pttl        = "pttl"
+	Persist     = "persist"
+	Expiretime  = "expiretime"
+	Pexpiretime = "pexpiretime"
+	Object      = "object"
+	Del         = "del"
+	Unlink      = "unlink"
+	Exists      = "exists"
+	Type        = "type"
+	Rename      = "rename"
+	Renamenx    = "renamenx"
+	Copy        = "copy"
+	Move        = "move"
+	Randomkey   = "randomkey"
+	Touch       = "touch"
+	Scan        = "scan"
 
 	//set
 	Sadd      = "sadd"
@@ -54,21 +118,153 @@ const (
 	Sismember = "sismember"
 	Sdiff     = "sdiff"
 
+	Srem        = "srem"
+	Smismember  = "smismember"
+	Srandmember = "srandmember"
+	Smove       = "smove"
+	Sinter      = "sinter"
+	Sunion      = "sunion"
+	Sdiffstore  = "sdiffstore"
+	Sinterstore = "sinterstore"
+	Sunionstore = "sunionstore"
+	Sintercard  = "sintercard"
+	Sscan       = "sscan"
+
 	Multi   = "multi"
 	Discard = "discard"
 	Watch   = "watch"
+	Unwatch = "unwatch"
 	Exec    = "exec"
 
-	Auth   = "auth"
-	Select = "select"
+	Auth         = "auth"
+	Hello        = "hello"
+	Config       = "config"
+	Select       = "select"
+	Bgrewriteaof = "bgrewriteaof"
+	Save         = "save"
+	Bgsave       = "bgsave"
+	Lastsave     = "lastsave"
+	Keys         = "keys"
+	Flushdb      = "flushdb"
+	Flushall     = "flushall"
 )
 
 var (
 	CommandTables = make(map[string]Command)
 
 	WriteCommands = map[string]string{
-		Set:   Set,
-		Setex: Setex,
+		Set:       Set,
+		Setnx:     Setnx,
+		Setex:     Setex,
+		Psetex:    Psetex,
+		Mset:      Mset,
+		Msetnx:    Msetnx,
+		Getset:    Getset,
+		Incr:      Incr,
+		Incrby:    Incrby,
+		Incrbyf:   Incrbyf,
+		Decr:      Decr,
+		Decrby:    Decrby,
+		Sadd:      Sadd,
+		Spop:      Spop,
+		Lpush:     Lpush,
+		Lpushx:    Lpushx,
+		Rpush:     Rpush,
+		Rpushx:    Rpushx,
+		Lpop:      Lpop,
+		Rpop:      Rpop,
+		Rpoplpush: Rpoplpush,
+		Lmove:     Lmove,
+		Lrem:      Lrem,
+		Lset:      Lset,
+		Linsert:   Linsert,
+		Ltrim:     Ltrim,
+		Blpop:     Blpop,
+		Brpop:     Brpop,
+		Blmove:    Blmove,
+		Expire:    Expire,
+		Pexpire:   Pexpire,
+		Expireat:  Expireat,
+		Pexpireat: Pexpireat,
+		Persist:   Persist,
+		Del:       Del,
+		Unlink:    Unlink,
+		Rename:    Rename,
+		Renamenx:  Renamenx,
+		Copy:      Copy,
+		Move:      Move,
+
+		Hset:         Hset,
+		Hsetnx:       Hsetnx,
+		Hdel:         Hdel,
+		Hmset:        Hmset,
+		Hincrby:      Hincrby,
+		Hincrbyfloat: Hincrbyfloat,
+
+		Zadd:             Zadd,
+		Zincrby:          Zincrby,
+		Zrem:             Zrem,
+		Zremrangebyscore: Zremrangebyscore,
+		Zremrangebyrank:  Zremrangebyrank,
+		Zremrangebylex:   Zremrangebylex,
+
+		Srem:        Srem,
+		Smove:       Smove,
+		Sdiffstore:  Sdiffstore,
+		Sinterstore: Sinterstore,
+		Sunionstore: Sunionstore,
+
+		Flushdb:  Flushdb,
+		Flushall: Flushall,
+	}
+
+	// 可能增加内存的命令，超过 maxmemory 并且淘汰 key 之后仍然超过时拒绝执行，和 redis 中有 denyoom 标记的命令一致
+	DenyOOMCommands = map[string]string{
+		Set:       Set,
+		Setnx:     Setnx,
+		Setex:     Setex,
+		Psetex:    Psetex,
+		Mset:      Mset,
+		Msetnx:    Msetnx,
+		Getset:    Getset,
+		Incr:      Incr,
+		Incrby:    Incrby,
+		Incrbyf:   Incrbyf,
+		Decr:      Decr,
+		Decrby:    Decrby,
+		Sadd:      Sadd,
+		Lpush:     Lpush,
+		Lpushx:    Lpushx,
+		Rpush:     Rpush,
+		Rpushx:    Rpushx,
+		Rpoplpush: Rpoplpush,
+		Lmove:     Lmove,
+		Lset:      Lset,
+		Linsert:   Linsert,
+		Blmove:    Blmove,
+		Copy:      Copy,
+
+		Hset:         Hset,
+		Hsetnx:       Hsetnx,
+		Hmset:        Hmset,
+		Hincrby:      Hincrby,
+		Hincrbyfloat: Hincrbyfloat,
+
+		Zadd:    Zadd,
+		Zincrby: Zincrby,
+
+		Sdiffstore:  Sdiffstore,
+		Sinterstore: Sinterstore,
+		Sunionstore: Sunionstore,
+	}
+
+	// 执行时需要独占整个 server 的命令：执行期间其他客户端的命令都不能执行
+	// save 需要一致的快照，exec 需要保证事务中的命令不会和其他客户端的命令交替执行，flushdb、flushall 清空 db 时不能有其他命令访问 db
+	ExclusiveCommands = map[string]string{
+		Save:     Save,
+		Exec:     Exec,
+		Flushdb:  Flushdb,
+		Flushall: Flushall,
 	}
 )
 
@@ -0,0 +1,450 @@
+package datatype
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+	"github.com/chenjiayao/goredistraning/redis/validate"
+)
+
+/**
+HSET
+HSETNX
+HGET
+HEXISTS
+HDEL
+HLEN
+HSTRLEN
+HMGET
+HMSET
+HKEYS
+HVALS
+HGETALL
+HINCRBY
+HINCRBYFLOAT
+HRANDFIELD
+HSCAN
+*/
+func init() {
+	redis.RegisterExecCommand(redis.Hset, ExecHSet, validate.ValidateHSet)
+	redis.RegisterExecCommand(redis.Hsetnx, ExecHSetNX, validate.ValidateHSetNX)
+	redis.RegisterExecCommand(redis.Hget, ExecHGet, validate.ValidateHGet)
+	redis.RegisterExecCommand(redis.Hexists, ExecHExists, validate.ValidateHExists)
+	redis.RegisterExecCommand(redis.Hdel, ExecHDel, validate.ValidateHDel)
+	redis.RegisterExecCommand(redis.Hlen, ExecHLen, validate.ValidateHLen)
+	redis.RegisterExecCommand(redis.Hstrlen, ExecHStrlen, validate.ValidateHStrlen)
+	redis.RegisterExecCommand(redis.Hmget, ExecHMGet, validate.ValidateHMGet)
+	redis.RegisterExecCommand(redis.Hmset, ExecHMSet, validate.ValidateHMSet)
+	redis.RegisterExecCommand(redis.Hkeys, ExecHKeys, validate.ValidateHKeys)
+	redis.RegisterExecCommand(redis.Hvals, ExecHVals, validate.ValidateHVals)
+	redis.RegisterExecCommand(redis.Hgetall, ExecHGetAll, validate.ValidateHGetAll)
+	redis.RegisterExecCommand(redis.Hincrby, ExecHIncrBy, validate.ValidateHIncrBy)
+	redis.RegisterExecCommand(redis.Hincrbyfloat, ExecHIncrByFloat, validate.ValidateHIncrByFloat)
+	redis.RegisterExecCommand(redis.Hrandfield, ExecHRandField, validate.ValidateHRandField)
+	redis.RegisterExecCommand(redis.Hscan, ExecHScan, validate.ValidateHScan)
+}
+
+// hset key field value [field value ...]，返回新增的 field 个数
+func ExecHSet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getOrCreateHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if h.Set(string(args[i]), string(args[i+1])) {
+			added++
+		}
+	}
+	return resp.MakeNumberResponse(int64(added))
+}
+
+// hmset 和 hset 一样，只是返回 OK
+func ExecHMSet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	res := ExecHSet(conn, db, args)
+	if !res.ISOK() {
+		return res
+	}
+	return resp.OKSimpleResponse
+}
+
+// hsetnx key field value，field 已经存在时不做任何操作
+func ExecHSetNX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getOrCreateHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	field := string(args[1])
+	if h.Exists(field) {
+		return resp.MakeNumberResponse(0)
+	}
+	h.Set(field, string(args[2]))
+	return resp.MakeNumberResponse(1)
+}
+
+func ExecHGet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil {
+		return resp.NullBulkResponse
+	}
+	value, ok := h.Get(string(args[1]))
+	if !ok {
+		return resp.NullBulkResponse
+	}
+	return resp.MakeBulkResponse([]byte(value))
+}
+
+func ExecHExists(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil || !h.Exists(string(args[1])) {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(1)
+}
+
+// hdel key field [field ...]，返回删除的 field 个数，所有 field 都被删除之后删除 key
+func ExecHDel(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	deleted := 0
+	for _, field := range args[1:] {
+		if h.Delete(string(field)) {
+			deleted++
+		}
+	}
+	if h.Len() == 0 {
+		db.Remove(key)
+	}
+	return resp.MakeNumberResponse(int64(deleted))
+}
+
+func ExecHLen(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(int64(h.Len()))
+}
+
+// hstrlen key field，field 不存在时返回 0
+func ExecHStrlen(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	value, _ := h.Get(string(args[1]))
+	return resp.MakeNumberResponse(int64(len(value)))
+}
+
+// hmget key field [field ...]，不存在的 field 返回 nil
+func ExecHMGet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	values := make([][]byte, len(args)-1)
+	if h == nil {
+		return resp.MakeMultiResponse(values)
+	}
+	for i, field := range args[1:] {
+		if value, ok := h.Get(string(field)); ok {
+			values[i] = []byte(value)
+		}
+	}
+	return resp.MakeMultiResponse(values)
+}
+
+func ExecHKeys(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return hashItems(db, string(args[0]), true, false)
+}
+
+func ExecHVals(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return hashItems(db, string(args[0]), false, true)
+}
+
+func hashItems(db *redis.RedisDB, key string, withFields, withValues bool) response.Response {
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	items := make([][]byte, 0)
+	if h == nil {
+		return resp.MakeMultiResponse(items)
+	}
+	h.ForEach(func(field, value string) bool {
+		if withFields {
+			items = append(items, []byte(field))
+		}
+		if withValues {
+			items = append(items, []byte(value))
+		}
+		return true
+	})
+	return resp.MakeMultiResponse(items)
+}
+
+// hgetall key，RESP3 中返回 map，RESP2 中返回 field 和 value 交替排列的数组
+func ExecHGetAll(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	fields := make([]response.Response, 0)
+	values := make([]response.Response, 0)
+	if h != nil {
+		h.ForEach(func(field, value string) bool {
+			fields = append(fields, resp.MakeBulkResponse([]byte(field)))
+			values = append(values, resp.MakeBulkResponse([]byte(value)))
+			return true
+		})
+	}
+	return resp.MakeMapResponse(fields, values)
+}
+
+// hincrby key field increment，field 不存在时当成 0
+func ExecHIncrBy(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	field := string(args[1])
+	increment, _ := strconv.ParseInt(string(args[2]), 10, 64)
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getOrCreateHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+
+	var current int64
+	if value, ok := h.Get(field); ok {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return resp.MakeErrorResponse("ERR hash value is not an integer")
+		}
+		current = v
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		removeHashIfEmpty(db, key, h)
+		return resp.MakeErrorResponse("ERR increment or decrement would overflow")
+	}
+	current += increment
+	h.Set(field, strconv.FormatInt(current, 10))
+	return resp.MakeNumberResponse(current)
+}
+
+// hincrbyfloat key field increment，返回 bulk string
+func ExecHIncrByFloat(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	field := string(args[1])
+	increment, _ := strconv.ParseFloat(string(args[2]), 64)
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getOrCreateHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+
+	var current float64
+	if value, ok := h.Get(field); ok {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return resp.MakeErrorResponse("ERR hash value is not a float")
+		}
+		current = v
+	}
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		removeHashIfEmpty(db, key, h)
+		return resp.MakeErrorResponse("ERR increment would produce NaN or Infinity")
+	}
+	value := strconv.FormatFloat(current, 'f', -1, 64)
+	h.Set(field, value)
+	return resp.MakeBulkResponse([]byte(value))
+}
+
+// hrandfield key [count [WITHVALUES]]
+// count 为正数时返回不重复的 field，为负数时返回 -count 个可能重复的 field
+func ExecHRandField(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+
+	if len(args) == 1 {
+		if h == nil {
+			return resp.NullBulkResponse
+		}
+		return resp.MakeBulkResponse([]byte(h.RandomDistinctFields(1)[0]))
+	}
+
+	count, _ := strconv.ParseInt(string(args[1]), 10, 64)
+	withValues := len(args) == 3
+	if h == nil || count == 0 {
+		return resp.MakeMultiResponse([][]byte{})
+	}
+
+	var fields []string
+	if count > 0 {
+		fields = h.RandomDistinctFields(int(count))
+	} else {
+		if count < -math.MaxInt32 {
+			return resp.MakeErrorResponse("ERR value is out of range")
+		}
+		fields = h.RandomFields(int(-count))
+	}
+
+	if !withValues {
+		items := make([][]byte, len(fields))
+		for i, field := range fields {
+			items[i] = []byte(field)
+		}
+		return resp.MakeMultiResponse(items)
+	}
+
+	//RESP3 中每一对 field 和 value 是一个数组
+	if conn.GetProtocol() == resp.RESP3 {
+		pairs := make([]response.Response, len(fields))
+		for i, field := range fields {
+			value, _ := h.Get(field)
+			pairs[i] = resp.MakeMultiResponse([][]byte{[]byte(field), []byte(value)})
+		}
+		return resp.MakeArrayResponse(pairs)
+	}
+	items := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		value, _ := h.Get(field)
+		items = append(items, []byte(field), []byte(value))
+	}
+	return resp.MakeMultiResponse(items)
+}
+
+// hscan key cursor [MATCH pattern] [COUNT count]
+// hashtable 编码按照 scan 的顺序从 cursor 开始每次至少取出 count 个 field，返回下一次的游标，游标为 0 时遍历结束
+// listpack 编码的 hash 元素很少，一次返回所有的 field，游标总是 0
+// MATCH 在取出 field 之后再过滤，所以返回的 field 可能少于 count 个
+func ExecHScan(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	options := parseScanOptions(args[1:])
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	h, errResp := getHash(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if h == nil {
+		return makeScanResponse(0, [][]byte{})
+	}
+
+	fields, next := h.Scan(options.cursor, options.count)
+
+	items := make([][]byte, 0, 2*len(fields))
+	for _, field := range fields {
+		if !options.match(field) {
+			continue
+		}
+		value, _ := h.Get(field)
+		items = append(items, []byte(field), []byte(value))
+	}
+	return makeScanResponse(next, items)
+}
+
+// key 不存在时返回 nil，key 不是 hash 类型时返回 WRONGTYPE 错误
+func getHash(db *redis.RedisDB, key string) (*hash.Hash, response.Response) {
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return nil, nil
+	}
+	h, ok := v.(*hash.Hash)
+	if !ok {
+		return nil, resp.MakeErrorResponse(rediserr.WRONG_TYPE_ERROR.Error())
+	}
+	return h, nil
+}
+
+// key 不存在时创建一个空的 hash，调用方在没有写入 field 的时候需要调用 removeHashIfEmpty
+func getOrCreateHash(db *redis.RedisDB, key string) (*hash.Hash, response.Response) {
+	h, errResp := getHash(db, key)
+	if errResp != nil || h != nil {
+		return h, errResp
+	}
+	h = hash.MakeHash(config.Config.HashMaxListpackEntries, config.Config.HashMaxListpackValue)
+	db.Dataset.Put(key, h)
+	return h, nil
+}
+
+func removeHashIfEmpty(db *redis.RedisDB, key string, h *hash.Hash) {
+	if h.Len() == 0 {
+		db.Remove(key)
+	}
+}
@@ -0,0 +1,139 @@
+package datatype
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+func TestHashSetGet(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"HSET hash a 1 b 2", ":2\r\n"},
+		{"HSET hash a 3", ":0\r\n"},
+		{"HMSET hash c 4", "+OK\r\n"},
+		{"HSETNX hash a 5", ":0\r\n"},
+		{"HSETNX hash d 5", ":1\r\n"},
+		{"HGET hash a", "$1\r\n3\r\n"},
+		{"HGET hash x", "$-1\r\n"},
+		{"HGET missing a", "$-1\r\n"},
+		{"HEXISTS hash b", ":1\r\n"},
+		{"HEXISTS hash x", ":0\r\n"},
+		{"HLEN hash", ":4\r\n"},
+		{"HSTRLEN hash a", ":1\r\n"},
+		{"HSTRLEN hash x", ":0\r\n"},
+		{"HMGET hash a x b", "*3\r\n$1\r\n3\r\n$-1\r\n$1\r\n2\r\n"},
+		{"HMGET missing a", "*1\r\n$-1\r\n"},
+		{"HKEYS hash", "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"HVALS hash", "*4\r\n$1\r\n3\r\n$1\r\n2\r\n$1\r\n4\r\n$1\r\n5\r\n"},
+		{"HDEL hash a x b", ":2\r\n"},
+		{"HGETALL hash", "*4\r\n$1\r\nc\r\n$1\r\n4\r\n$1\r\nd\r\n$1\r\n5\r\n"},
+		{"HGETALL missing", "*0\r\n"},
+		{"HDEL hash c d", ":2\r\n"},
+		{"HLEN hash", ":0\r\n"},
+		{"HSET hash a", "-ERR wrong number of arguments for 'hset' command\r\n"},
+		{"SET string value", "+OK\r\n"},
+		{"HGET string a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+
+	if _, exist := db.Dataset.Get("hash"); exist {
+		t.Errorf("empty hash should be removed")
+	}
+
+	execCmd(db, "HSET hash a 1")
+	res := db.Exec(redis.MakeRedisConn(nil), redis.Hgetall, [][]byte{[]byte("hash")})
+	if got := string(resp.Encode(res, resp.RESP3)); got != "%1\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Errorf("HGETALL in RESP3 = %q", got)
+	}
+}
+
+func TestHashIncr(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"HINCRBY hash n 5", ":5\r\n"},
+		{"HINCRBY hash n -7", ":-2\r\n"},
+		{"HINCRBY hash n 1.5", "-ERR value is not an integer or out of range\r\n"},
+		{"HSET hash s abc big 9223372036854775807", ":2\r\n"},
+		{"HINCRBY hash s 1", "-ERR hash value is not an integer\r\n"},
+		{"HINCRBY hash big 1", "-ERR increment or decrement would overflow\r\n"},
+		{"HINCRBYFLOAT hash f 10.5", "$4\r\n10.5\r\n"},
+		{"HINCRBYFLOAT hash f -0.5", "$2\r\n10\r\n"},
+		{"HINCRBYFLOAT hash s 1", "-ERR hash value is not a float\r\n"},
+		{"HINCRBYFLOAT hash f abc", "-ERR value is not a valid float\r\n"},
+		{"HINCRBYFLOAT missing f 1e400", "-ERR value is not a valid float\r\n"},
+		{"HINCRBY missing n 9223372036854775807", ":9223372036854775807\r\n"},
+	})
+}
+
+func TestHashRandFieldAndScan(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"HRANDFIELD missing", "$-1\r\n"},
+		{"HRANDFIELD missing 3", "*0\r\n"},
+		{"HSET hash a 1", ":1\r\n"},
+		{"HRANDFIELD hash", "$1\r\na\r\n"},
+		{"HRANDFIELD hash 5", "*1\r\n$1\r\na\r\n"},
+		{"HRANDFIELD hash -3", "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\na\r\n"},
+		{"HRANDFIELD hash 1 WITHVALUES", "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{"HRANDFIELD hash 0", "*0\r\n"},
+		{"HRANDFIELD hash 1 VALUES", "-ERR syntax error\r\n"},
+		{"HSET hash b 2 ab 3", ":2\r\n"},
+		{"HSCAN hash 0 MATCH a*", "*2\r\n$1\r\n0\r\n*4\r\n$1\r\na\r\n$1\r\n1\r\n$2\r\nab\r\n$1\r\n3\r\n"},
+		{"HSCAN hash 0 COUNT 0", "-ERR syntax error\r\n"},
+		{"HSCAN hash x", "-ERR invalid cursor\r\n"},
+	})
+}
+
+func TestHashEncoding(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+
+	execCmd(db, "HSET hash a 1")
+	v, _ := db.Dataset.Get("hash")
+	if v.(*hash.Hash).Encoding() != hash.EncodingListpack {
+		t.Errorf("small hash should use listpack encoding")
+	}
+
+	execCmd(db, "HSET hash long "+strings.Repeat("v", config.Config.HashMaxListpackValue+1))
+	if v.(*hash.Hash).Encoding() != hash.EncodingHashtable {
+		t.Errorf("hash with long value should use hashtable encoding")
+	}
+}
+
+func TestHashScanHashtable(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.HashMaxListpackEntries = 4
+	defer config.LoadDefaultConfig()
+
+	db := redis.NewDBInstance(0)
+	for i := 0; i < 50; i++ {
+		execCmd(db, fmt.Sprintf("HSET hash f%d v%d", i, i))
+	}
+	items := scanAll(t, db, "HSCAN hash %d COUNT 5")
+	if len(items) != 100 {
+		t.Fatalf("HSCAN returned %d items, want 100", len(items))
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < len(items); i += 2 {
+		if seen[items[i]] || "v"+items[i][1:] != items[i+1] {
+			t.Errorf("HSCAN returned %s %s", items[i], items[i+1])
+		}
+		seen[items[i]] = true
+	}
+
+	if items := scanAll(t, db, "HSCAN hash %d MATCH f1?"); len(items) != 20 {
+		t.Errorf("HSCAN MATCH f1? returned %v", items)
+	}
+	runCmdCases(t, db, []cmdCase{
+		{"HSCAN missing 0", "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{"HSCAN hash 0 TYPE hash", "-ERR syntax error\r\n"},
+	})
+}
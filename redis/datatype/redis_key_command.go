@@ -1,60 +1,616 @@
 package datatype
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/glob"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
 	"github.com/chenjiayao/goredistraning/redis"
 	"github.com/chenjiayao/goredistraning/redis/resp"
+	"github.com/chenjiayao/goredistraning/redis/validate"
 )
 
+/**
+DEL
+UNLINK
+EXISTS
+TYPE
+RENAME
+RENAMENX
+COPY
+MOVE
+RANDOMKEY
+TOUCH
+OBJECT
+EXPIRE
+PEXPIRE
+EXPIREAT
+PEXPIREAT
+TTL
+PTTL
+PERSIST
+EXPIRETIME
+PEXPIRETIME
+SCAN
+*/
+func init() {
+	redis.RegisterExecCommand(redis.Del, ExecDel, validate.ValidateDel)
+	redis.RegisterExecCommand(redis.Unlink, ExecUnlink, validate.ValidateUnlink)
+	redis.RegisterExecCommand(redis.Exists, ExecExists, validate.ValidateExists)
+	redis.RegisterExecCommand(redis.Type, ExecType, validate.ValidateType)
+	redis.RegisterExecCommand(redis.Rename, ExecRename, validate.ValidateRename)
+	redis.RegisterExecCommand(redis.Renamenx, ExecRenamenx, validate.ValidateRenamenx)
+	redis.RegisterExecCommand(redis.Copy, ExecCopy, validate.ValidateCopy)
+	redis.RegisterExecCommand(redis.Move, ExecMove, validate.ValidateMove)
+	redis.RegisterExecCommand(redis.Randomkey, ExecRandomkey, validate.ValidateRandomkey)
+	redis.RegisterExecCommand(redis.Touch, ExecTouch, validate.ValidateTouch)
+	redis.RegisterExecCommand(redis.Expire, ExecExpire, validate.ValidateExpire)
+	redis.RegisterExecCommand(redis.Pexpire, ExecPExpire, validate.ValidatePExpire)
+	redis.RegisterExecCommand(redis.Expireat, ExecExpireAt, validate.ValidateExpireAt)
+	redis.RegisterExecCommand(redis.Pexpireat, ExecPExpireAt, validate.ValidatePExpireAt)
+	redis.RegisterExecCommand(redis.TTL, ExecTTL, validate.ValidateTTL)
+	redis.RegisterExecCommand(redis.Pttl, ExecPTTL, validate.ValidatePTTL)
+	redis.RegisterExecCommand(redis.Persist, ExecPersist, validate.ValidatePersist)
+	redis.RegisterExecCommand(redis.Expiretime, ExecExpireTime, validate.ValidateExpireTime)
+	redis.RegisterExecCommand(redis.Pexpiretime, ExecPExpireTime, validate.ValidatePExpireTime)
+	redis.RegisterExecCommand(redis.Object, ExecObject, validate.ValidateObject)
+	redis.RegisterExecCommand(redis.Scan, ExecScan, validate.ValidateScan)
+}
+
 const (
 	UnlimitTTL = int64(-1)
+
+	// 长度不超过 44 的字符串在 redis 中和 robj 分配在同一块内存中
+	embstrSizeLimit = 44
+
+	// scan 没有指定 COUNT 时每次返回的元素个数
+	defaultScanCount = 10
 )
 
-func ExecExpire(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
-	ExecTTL(conn, db, args)
+// del key [key ...]，返回删除的 key 个数
+func ExecDel(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	db.LockKeys(keys...)
+	defer db.UnLockKeys(keys...)
+
+	deleted := 0
+	for _, key := range keys {
+		if _, exist := db.Dataset.Get(key); !exist {
+			continue
+		}
+		db.Remove(key)
+		db.SignalModifiedKey(key)
+		deleted++
+	}
+	return resp.MakeNumberResponse(int64(deleted))
+}
+
+// unlink 在 redis 中会在后台线程释放内存，这里交给 gc，和 del 一样
+func ExecUnlink(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return ExecDel(conn, db, args)
+}
+
+// exists key [key ...]，返回存在的 key 个数，同一个 key 出现多次会计算多次
+func ExecExists(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return resp.MakeNumberResponse(countExistingKeys(db, args))
+}
+
+// touch key [key ...]，返回存在的 key 个数
+func ExecTouch(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return resp.MakeNumberResponse(countExistingKeys(db, args))
+}
+
+// type key，key 不存在时返回 none
+func ExecType(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return resp.MakeSimpleResponse("none")
+	}
+	return resp.MakeSimpleResponse(typeOf(v))
+}
+
+// rename key newkey，newkey 已经存在时会被覆盖，过期时间跟着 key 一起移动
+func ExecRename(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	newKey := string(args[1])
+	db.LockKeys(key, newKey)
+	defer db.UnLockKeys(key, newKey)
+
+	if _, exist := db.Dataset.Get(key); !exist {
+		return resp.MakeErrorResponse("ERR no such key")
+	}
+	renameKey(db, key, newKey)
+	return resp.OKSimpleResponse
+}
+
+// renamenx key newkey，newkey 不存在时才会重命名，重命名成功返回 1
+func ExecRenamenx(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	newKey := string(args[1])
+	db.LockKeys(key, newKey)
+	defer db.UnLockKeys(key, newKey)
+
+	if _, exist := db.Dataset.Get(key); !exist {
+		return resp.MakeErrorResponse("ERR no such key")
+	}
+	if _, exist := db.Dataset.Get(newKey); exist {
+		return resp.MakeNumberResponse(0)
+	}
+	renameKey(db, key, newKey)
 	return resp.MakeNumberResponse(1)
 }
 
-// ttl = -2  key 不存在
-// ttl = -1 永久有效
-func ExecTTL(conn conn.Conn, db *redis.RedisDB, args [][]byte) int64 {
+// copy source destination [DB destination-db] [REPLACE]
+// destination 已经存在并且没有 REPLACE 时返回 0，拷贝成功返回 1
+func ExecCopy(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	source := string(args[0])
+	destination := string(args[1])
+	dstDB := db
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "replace":
+			replace = true
+		case "db":
+			index, _ := strconv.Atoi(string(args[i+1]))
+			dstDB = db.GetDB(index)
+			i++
+		}
+	}
+	if dstDB == nil {
+		return resp.MakeErrorResponse("ERR DB index is out of range")
+	}
+	if dstDB == db && source == destination {
+		return resp.MakeErrorResponse("ERR source and destination objects are the same")
+	}
+	//当前 db 中的 key 在 Exec 中已经检查过了
+	if dstDB != db {
+		dstDB.ExpireIfNeeded(conn, destination)
+	}
+
+	unlock := lockKeysInDBs(db, source, dstDB, destination)
+	defer unlock()
+
+	v, exist := db.Dataset.Get(source)
+	if !exist {
+		return resp.MakeNumberResponse(0)
+	}
+	if _, exist := dstDB.Dataset.Get(destination); exist && !replace {
+		return resp.MakeNumberResponse(0)
+	}
+
+	dstDB.Remove(destination)
+	dstDB.Dataset.Put(destination, redis.CopyValue(v))
+	if expiredAt, ok := db.TtlMap.Get(source); ok {
+		dstDB.TtlMap.Put(destination, expiredAt)
+	}
+	dstDB.TrackMemory(destination)
+	dstDB.SignalModifiedKey(destination)
+	dstDB.SignalKeyAsReady(conn, destination)
+	return resp.MakeNumberResponse(1)
+}
 
+// move key db，key 不存在或者目标 db 中已经有同名的 key 时返回 0，移动成功返回 1
+func ExecMove(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 	key := string(args[0])
+	index, _ := strconv.Atoi(string(args[1]))
+	dstDB := db.GetDB(index)
+	if dstDB == nil {
+		return resp.MakeErrorResponse("ERR DB index is out of range")
+	}
+	if dstDB == db {
+		return resp.MakeErrorResponse("ERR source and destination objects are the same")
+	}
+	dstDB.ExpireIfNeeded(conn, key)
+
+	unlock := lockKeysInDBs(db, key, dstDB, key)
+	defer unlock()
 
-	_, exist := db.Dataset.Get(key)
+	v, exist := db.Dataset.Get(key)
 	if !exist {
-		return -2
+		return resp.MakeNumberResponse(0)
+	}
+	if _, exist := dstDB.Dataset.Get(key); exist {
+		return resp.MakeNumberResponse(0)
+	}
+
+	dstDB.Dataset.Put(key, v)
+	if expiredAt, ok := db.TtlMap.Get(key); ok {
+		dstDB.TtlMap.Put(key, expiredAt)
+	}
+	dstDB.TrackMemory(key)
+	db.Remove(key)
+	db.SignalModifiedKey(key)
+	dstDB.SignalModifiedKey(key)
+	dstDB.SignalKeyAsReady(conn, key)
+	return resp.MakeNumberResponse(1)
+}
+
+// randomkey，db 为空时返回 nil
+// 抽到过期的 key 时删除之后重新抽取
+func ExecRandomkey(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	for {
+		keys := db.Dataset.RandomKeys(1)
+		if len(keys) == 0 {
+			return resp.NullBulkResponse
+		}
+		if !db.ExpireIfNeeded(conn, keys[0]) {
+			return resp.MakeBulkResponse([]byte(keys[0]))
+		}
+	}
+}
+
+// expire key seconds [NX | XX | GT | LT]
+// NX：key 没有过期时间时才设置；XX：key 有过期时间时才设置
+// GT：新的过期时间大于原来的才设置；LT：新的过期时间小于原来的才设置，没有过期时间当作无限大
+// 设置成功返回 1，key 不存在或者不满足条件返回 0
+func ExecExpire(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return expireGeneric(conn, db, args, time.Now().UnixMilli(), 1000, redis.Expire)
+}
+
+// pexpire key milliseconds [NX | XX | GT | LT]
+func ExecPExpire(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return expireGeneric(conn, db, args, time.Now().UnixMilli(), 1, redis.Pexpire)
+}
+
+// expireat key unix-time-seconds [NX | XX | GT | LT]
+func ExecExpireAt(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return expireGeneric(conn, db, args, 0, 1000, redis.Expireat)
+}
+
+// pexpireat key unix-time-milliseconds [NX | XX | GT | LT]
+// aof 中所有的过期时间都记录成 pexpireat，重放旧的 aof 文件不会延长 key 的过期时间
+func ExecPExpireAt(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return expireGeneric(conn, db, args, 0, 1, redis.Pexpireat)
+}
+
+// 过期的绝对时间（毫秒） = base + args[1] * unit
+func expireGeneric(conn conn.Conn, db *redis.RedisDB, args [][]byte, base, unit int64, cmdName string) response.Response {
+	key := string(args[0])
+	value, _ := strconv.ParseInt(string(args[1]), 10, 64)
+	if value > (math.MaxInt64-base)/unit || value < math.MinInt64/unit {
+		return resp.MakeErrorResponse(fmt.Sprintf("ERR invalid expire time in '%s' command", cmdName))
 	}
+	expiredAt := base + value*unit
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
-	//key 存在，但是 TtlMap 中不存在，那么说明key没有设置过期时间
-	res, ok := db.TtlMap.Get(key)
+	if _, exist := db.Dataset.Get(key); !exist {
+		propagate(conn)
+		return resp.MakeNumberResponse(0)
+	}
+	current, hasExpire := getExpireAt(db, key)
+	for _, arg := range args[2:] {
+		var ok bool
+		switch strings.ToLower(string(arg)) {
+		case "nx":
+			ok = !hasExpire
+		case "xx":
+			ok = hasExpire
+		case "gt":
+			ok = hasExpire && expiredAt > current
+		case "lt":
+			ok = !hasExpire || expiredAt < current
+		}
+		if !ok {
+			propagate(conn)
+			return resp.MakeNumberResponse(0)
+		}
+	}
+
+	//过期时间已经过去了，直接删除 key
+	if expiredAt <= time.Now().UnixMilli() {
+		db.Remove(key)
+		propagate(conn, [][]byte{[]byte(redis.Del), args[0]})
+		return resp.MakeNumberResponse(1)
+	}
+	db.TtlMap.Put(key, expiredAt)
+	propagate(conn, makePExpireAtCmd(args[0], expiredAt))
+	return resp.MakeNumberResponse(1)
+}
+
+// ttl key，返回剩余的秒数
+// key 不存在返回 -2，key 没有过期时间返回 -1
+func ExecTTL(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	ttl := keyTTL(db, string(args[0]))
+	if ttl < 0 {
+		return resp.MakeNumberResponse(ttl)
+	}
+	return resp.MakeNumberResponse((ttl + 500) / 1000)
+}
+
+// pttl key，返回剩余的毫秒数
+func ExecPTTL(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return resp.MakeNumberResponse(keyTTL(db, string(args[0])))
+}
+
+// persist key，清除 key 的过期时间，清除成功返回 1
+func ExecPersist(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	if _, exist := db.Dataset.Get(key); !exist {
+		return resp.MakeNumberResponse(0)
+	}
+	if !db.TtlMap.Del(key) {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(1)
+}
+
+// expiretime key，返回过期时间的秒级时间戳
+// key 不存在返回 -2，key 没有过期时间返回 -1
+func ExecExpireTime(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	expiredAt := keyExpireTime(db, string(args[0]))
+	if expiredAt < 0 {
+		return resp.MakeNumberResponse(expiredAt)
+	}
+	return resp.MakeNumberResponse((expiredAt + 500) / 1000)
+}
+
+// pexpiretime key，返回过期时间的毫秒级时间戳
+func ExecPExpireTime(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return resp.MakeNumberResponse(keyExpireTime(db, string(args[0])))
+}
+
+// key 剩余的毫秒数，key 不存在返回 -2，key 没有过期时间返回 -1
+func keyTTL(db *redis.RedisDB, key string) int64 {
+	expiredAt := keyExpireTime(db, key)
+	if expiredAt < 0 {
+		return expiredAt
+	}
+	return expiredAt - time.Now().UnixMilli()
+}
+
+// key 的过期时间（毫秒时间戳），key 不存在或者已经过期返回 -2，key 没有过期时间返回 -1
+func keyExpireTime(db *redis.RedisDB, key string) int64 {
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	if _, exist := db.Dataset.Get(key); !exist {
+		return -2
+	}
+	expiredAt, ok := getExpireAt(db, key)
 	if !ok {
 		return -1
 	}
-	expiredAt, _ := res.(int64)
-	now := time.Now().UnixNano() / 1e6
-	ttl := (expiredAt - now) / 1000
-	return int64(ttl)
+	if expiredAt <= time.Now().UnixMilli() {
+		return -2
+	}
+	return expiredAt
 }
 
-//设置key 的 ttl
-/*
-	保存到 TtlMap 中的是过期的时间
-	ttl : 毫秒，以字符串形式传递
-*/
-func SetKeyTTL(conn conn.Conn, db *redis.RedisDB, args [][]byte) {
-	key := string(args[0])
-	ttls := string(args[1])
+// key 的过期时间（毫秒时间戳），没有设置过期时间时返回 false
+func getExpireAt(db *redis.RedisDB, key string) (int64, bool) {
+	v, ok := db.TtlMap.Get(key)
+	if !ok {
+		return 0, false
+	}
+	return v.(int64), true
+}
+
+// key 已经过了过期时间
+func isExpired(db *redis.RedisDB, key string) bool {
+	expiredAt, ok := getExpireAt(db, key)
+	return ok && expiredAt <= time.Now().UnixMilli()
+}
+
+func makePExpireAtCmd(key []byte, expiredAt int64) [][]byte {
+	return [][]byte{[]byte(redis.Pexpireat), key, []byte(strconv.FormatInt(expiredAt, 10))}
+}
+
+// 把正在执行的命令在 aof 中替换成 cmds，conn 为 nil 时（测试中直接调用 Exec 函数）不需要记录
+func propagate(conn conn.Conn, cmds ...[][]byte) {
+	if conn != nil {
+		conn.Propagate(cmds...)
+	}
+}
 
-	ttl, _ := strconv.Atoi(ttls)
+// object encoding|idletime|freq key
+// key 不存在时返回 nil
+// idletime 是距离最近一次访问的秒数，只有不是 lfu 策略时可用；freq 是访问频率计数器，只有 lfu 策略时可用，和 redis 一致
+func ExecObject(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	subCommand := strings.ToLower(string(args[0]))
+	key := string(args[1])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
-	if int64(ttl) == UnlimitTTL {
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return resp.NullBulkResponse
+	}
+	switch subCommand {
+	case "idletime":
+		if redis.IsLFUPolicy() {
+			return resp.MakeErrorResponse("ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		idle, _ := db.ObjectIdleTime(key)
+		return resp.MakeNumberResponse(int64(idle / time.Second))
+	case "freq":
+		if !redis.IsLFUPolicy() {
+			return resp.MakeErrorResponse("ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		freq, _ := db.ObjectFreq(key)
+		return resp.MakeNumberResponse(int64(freq))
+	default:
+		return resp.MakeBulkResponse([]byte(objectEncoding(v)))
+	}
+}
+
+func objectEncoding(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil && strconv.FormatInt(i, 10) == val {
+			return "int"
+		}
+		if len(val) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case *quicklist.QuickList:
+		return "quicklist"
+	case *hash.Hash:
+		return val.Encoding()
+	case *set.Set:
+		return val.Encoding()
+	case *sortedset.SortedSet:
+		return "skiplist"
+	default:
+		return "unknown"
+	}
+}
+
+func countExistingKeys(db *redis.RedisDB, args [][]byte) int64 {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	db.LockKeys(keys...)
+	defer db.UnLockKeys(keys...)
+
+	count := int64(0)
+	for _, key := range keys {
+		if _, exist := db.Dataset.Get(key); exist {
+			count++
+		}
+	}
+	return count
+}
+
+// 把 key 的 value 和过期时间移动到 newKey 上，调用方需要保证 key 存在并且持有两个 key 的锁
+func renameKey(db *redis.RedisDB, key, newKey string) {
+	if key == newKey {
 		return
 	}
-	expiredAt := time.Now().UnixNano()/1e6 + int64(ttl)
-	db.TtlMap.Put(string(key), expiredAt)
+	v, _ := db.Dataset.Get(key)
+	expiredAt, hasTTL := db.TtlMap.Get(key)
+	db.Remove(newKey)
+	db.Dataset.Put(newKey, v)
+	if hasTTL {
+		db.TtlMap.Put(newKey, expiredAt)
+	}
+	db.Remove(key)
+	db.SignalModifiedKey(key)
+	db.SignalModifiedKey(newKey)
+}
+
+// 对两个 db 中的 key 加锁，按照 db 编号从小到大的顺序加锁，避免和反方向的 move 死锁
+// 返回解锁的函数
+func lockKeysInDBs(db *redis.RedisDB, key string, otherDB *redis.RedisDB, otherKey string) func() {
+	if db == otherDB {
+		db.LockKeys(key, otherKey)
+		return func() {
+			db.UnLockKeys(key, otherKey)
+		}
+	}
+
+	first, firstKey, second, secondKey := db, key, otherDB, otherKey
+	if first.Index > second.Index {
+		first, firstKey, second, secondKey = second, secondKey, first, firstKey
+	}
+	first.LockKey(firstKey)
+	second.LockKey(secondKey)
+	return func() {
+		second.UnLockKey(secondKey)
+		first.UnLockKey(firstKey)
+	}
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case *quicklist.QuickList:
+		return "list"
+	case *hash.Hash:
+		return "hash"
+	case *set.Set:
+		return "set"
+	case *sortedset.SortedSet:
+		return "zset"
+	default:
+		return "none"
+	}
+}
+
+// scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 游标的含义见 dict.ConcurrentDict.Scan，MATCH 和 TYPE 在取出 key 之后再过滤，所以返回的 key 可能少于 count 个
+func ExecScan(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	options := parseScanOptions(args)
+	keys, next := db.Dataset.Scan(options.cursor, options.count)
+
+	items := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if isExpired(db, key) || !options.match(key) {
+			continue
+		}
+		if options.typ != "" {
+			v, exist := db.Dataset.Get(key)
+			if !exist || typeOf(v) != options.typ {
+				continue
+			}
+		}
+		items = append(items, []byte(key))
+	}
+	return makeScanResponse(next, items)
+}
+
+// scan、hscan、sscan、zscan 的参数：cursor [MATCH pattern] [COUNT count] [TYPE type]
+type scanOptions struct {
+	cursor  uint64
+	pattern string
+	count   int
+	typ     string
+}
+
+// 参数已经校验过了
+func parseScanOptions(args [][]byte) scanOptions {
+	options := scanOptions{count: defaultScanCount}
+	options.cursor, _ = strconv.ParseUint(string(args[0]), 10, 64)
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			options.pattern = string(args[i+1])
+		case "count":
+			count, _ := strconv.ParseInt(string(args[i+1]), 10, 64)
+			options.count = int(count)
+		case "type":
+			options.typ = strings.ToLower(string(args[i+1]))
+		}
+	}
+	return options
+}
+
+// 没有 MATCH 或者 MATCH * 时匹配所有元素
+func (options scanOptions) match(s string) bool {
+	if options.pattern == "" || options.pattern == "*" {
+		return true
+	}
+	return glob.Match(options.pattern, s)
+}
+
+// [next cursor, [item ...]]
+func makeScanResponse(next uint64, items [][]byte) response.Response {
+	return resp.MakeArrayResponse([]response.Response{
+		resp.MakeBulkResponse([]byte(strconv.FormatUint(next, 10))),
+		resp.MakeMultiResponse(items),
+	})
 }
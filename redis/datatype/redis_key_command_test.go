@@ -0,0 +1,386 @@
+package datatype
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.SetMaxIntsetEntries = 2
+	defer config.LoadDefaultConfig()
+
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET int 123", "+OK\r\n"},
+		{"OBJECT ENCODING int", "$3\r\nint\r\n"},
+		{"SET embstr abc", "+OK\r\n"},
+		{"OBJECT ENCODING embstr", "$6\r\nembstr\r\n"},
+		{"SET raw " + strings.Repeat("a", 45), "+OK\r\n"},
+		{"OBJECT ENCODING raw", "$3\r\nraw\r\n"},
+		{"SADD ints 1 2", ":2\r\n"},
+		{"OBJECT ENCODING ints", "$6\r\nintset\r\n"},
+		{"SADD ints 3", ":1\r\n"},
+		{"OBJECT ENCODING ints", "$9\r\nhashtable\r\n"},
+		{"SADD strs 1 a", ":2\r\n"},
+		{"OBJECT ENCODING strs", "$9\r\nhashtable\r\n"},
+		{"HSET hash a 1", ":1\r\n"},
+		{"OBJECT ENCODING hash", "$8\r\nlistpack\r\n"},
+		{"RPUSH list a", ":1\r\n"},
+		{"OBJECT ENCODING list", "$9\r\nquicklist\r\n"},
+		{"ZADD zset 1 a", ":1\r\n"},
+		{"OBJECT ENCODING zset", "$8\r\nskiplist\r\n"},
+		{"OBJECT ENCODING missing", "$-1\r\n"},
+		{"OBJECT ENCODING", "-ERR wrong number of arguments for 'object|encoding' command\r\n"},
+		{"OBJECT foo key", "-ERR unknown subcommand 'foo'. Try OBJECT HELP.\r\n"},
+	})
+}
+
+func TestObjectIdleTimeFreq(t *testing.T) {
+	config.LoadDefaultConfig()
+	defer config.LoadDefaultConfig()
+
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET a 1", "+OK\r\n"},
+		{"OBJECT IDLETIME a", ":0\r\n"},
+		{"OBJECT IDLETIME missing", "$-1\r\n"},
+		{"OBJECT FREQ a", "-ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.\r\n"},
+		{"OBJECT IDLETIME", "-ERR wrong number of arguments for 'object|idletime' command\r\n"},
+	})
+
+	//新 key 的计数器是 5，计数器不超过 5 时每次访问都加一，object 命令不算访问
+	config.Config.MaxmemoryPolicy = config.MaxmemoryPolicyAllkeysLFU
+	runCmdCases(t, db, []cmdCase{
+		{"SET b 1", "+OK\r\n"},
+		{"OBJECT FREQ b", ":6\r\n"},
+		{"OBJECT FREQ b", ":6\r\n"},
+		{"OBJECT FREQ missing", "$-1\r\n"},
+		{"OBJECT IDLETIME b", "-ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.\r\n"},
+	})
+}
+
+func TestKeyDelExistsType(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET a 1", "+OK\r\n"},
+		{"RPUSH list x", ":1\r\n"},
+		{"SADD set x", ":1\r\n"},
+		{"ZADD zset 1 x", ":1\r\n"},
+		{"HSET hash x 1", ":1\r\n"},
+		{"TYPE a", "+string\r\n"},
+		{"TYPE list", "+list\r\n"},
+		{"TYPE set", "+set\r\n"},
+		{"TYPE zset", "+zset\r\n"},
+		{"TYPE hash", "+hash\r\n"},
+		{"TYPE missing", "+none\r\n"},
+		{"EXISTS a a missing list", ":3\r\n"},
+		{"TOUCH a missing", ":1\r\n"},
+		{"DEL a missing list", ":2\r\n"},
+		{"UNLINK set zset", ":2\r\n"},
+		{"EXISTS a list set zset", ":0\r\n"},
+		{"RANDOMKEY", "$4\r\nhash\r\n"},
+		{"DEL hash", ":1\r\n"},
+		{"RANDOMKEY", "$-1\r\n"},
+		{"DEL", "-ERR wrong number of arguments for 'del' command\r\n"},
+	})
+}
+
+func TestKeyRename(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET a 1", "+OK\r\n"},
+		{"PEXPIREAT a 99999999999999", ":1\r\n"},
+		{"SET b 2", "+OK\r\n"},
+		{"RENAMENX a b", ":0\r\n"},
+		{"RENAME a b", "+OK\r\n"},
+		{"GET b", "$1\r\n1\r\n"},
+		{"EXISTS a", ":0\r\n"},
+		{"RENAME a b", "-ERR no such key\r\n"},
+		{"RENAMENX b c", ":1\r\n"},
+		{"RENAME c c", "+OK\r\n"},
+		{"GET c", "$1\r\n1\r\n"},
+	})
+	if _, ok := db.TtlMap.Get("c"); !ok {
+		t.Errorf("rename should carry the ttl")
+	}
+	if _, ok := db.TtlMap.Get("a"); ok {
+		t.Errorf("ttl of the old key should be removed")
+	}
+}
+
+func TestKeyCopyAndMove(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := redis.NewDBs()
+	db0, db1 := rds.DBs[0], rds.DBs[1]
+	runCmdCases(t, db0, []cmdCase{
+		{"RPUSH list a b", ":2\r\n"},
+		{"COPY list list2", ":1\r\n"},
+		{"RPUSH list2 c", ":3\r\n"},
+		{"LLEN list", ":2\r\n"},
+		{"SET s v", "+OK\r\n"},
+		{"COPY s list2", ":0\r\n"},
+		{"COPY s list2 REPLACE", ":1\r\n"},
+		{"GET list2", "$1\r\nv\r\n"},
+		{"COPY s s", "-ERR source and destination objects are the same\r\n"},
+		{"COPY missing x", ":0\r\n"},
+		{"COPY list list DB 1", ":1\r\n"},
+		{"COPY s x DB 16", "-ERR DB index is out of range\r\n"},
+		{"COPY s x FOO", "-ERR syntax error\r\n"},
+		{"MOVE list 1", ":0\r\n"},
+		{"MOVE s 1", ":1\r\n"},
+		{"EXISTS s", ":0\r\n"},
+		{"MOVE s 1", ":0\r\n"},
+		{"MOVE list 0", "-ERR source and destination objects are the same\r\n"},
+		{"MOVE list x", "-ERR value is not an integer or out of range\r\n"},
+	})
+	runCmdCases(t, db1, []cmdCase{
+		{"GET s", "$1\r\nv\r\n"},
+		{"LRANGE list 0 -1", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+	})
+}
+
+func TestKeyWriteInvalidatesWatch(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := redis.NewDBs()
+	db0, db1 := rds.DBs[0], rds.DBs[1]
+	execCmd(db0, "SET a 1")
+	execCmd(db1, "SET b 1")
+
+	tests := []struct {
+		db      *redis.RedisDB
+		watched string
+		cmd     string
+	}{
+		{db0, "b", "RENAME a b"},
+		{db0, "b", "DEL missing b"},
+		{db1, "c", "COPY b c"},
+		{db1, "b", "MOVE b 0"},
+	}
+	for _, tt := range tests {
+		conn := redis.MakeRedisConn(nil)
+		tt.db.Exec(conn, redis.Watch, [][]byte{[]byte(tt.watched)})
+		execCmd(tt.db, tt.cmd)
+		if !conn.GetDirtyCAS() {
+			t.Errorf("%s should invalidate WATCH on %s", tt.cmd, tt.watched)
+		}
+	}
+
+	//目标 db 中 watch 的 key 也需要失效
+	conn := redis.MakeRedisConn(nil)
+	db1.Exec(conn, redis.Watch, [][]byte{[]byte("b")})
+	execCmd(db0, "MOVE b 1")
+	if !conn.GetDirtyCAS() {
+		t.Errorf("MOVE should invalidate WATCH on the destination db")
+	}
+}
+
+func TestExpireCommands(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"EXPIRE missing 100", ":0\r\n"},
+		{"TTL missing", ":-2\r\n"},
+		{"PTTL missing", ":-2\r\n"},
+		{"EXPIRETIME missing", ":-2\r\n"},
+		{"SET k v", "+OK\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"EXPIRETIME k", ":-1\r\n"},
+		{"PERSIST k", ":0\r\n"},
+
+		//NX 只在没有过期时间时设置，XX 只在已经有过期时间时设置
+		{"EXPIRE k 100 XX", ":0\r\n"},
+		{"EXPIRE k 100 NX", ":1\r\n"},
+		{"EXPIRE k 200 NX", ":0\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"EXPIRE k 200 XX", ":1\r\n"},
+		{"TTL k", ":200\r\n"},
+
+		//GT、LT 和当前的过期时间比较，没有过期时间当作无穷大
+		{"EXPIRE k 100 GT", ":0\r\n"},
+		{"EXPIRE k 300 GT", ":1\r\n"},
+		{"EXPIRE k 400 LT", ":0\r\n"},
+		{"EXPIRE k 50 LT", ":1\r\n"},
+		{"TTL k", ":50\r\n"},
+		{"PERSIST k", ":1\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"EXPIRE k 100 GT", ":0\r\n"},
+		{"EXPIRE k 100 LT", ":1\r\n"},
+
+		{"EXPIREAT k 4102444800", ":1\r\n"},
+		{"EXPIRETIME k", ":4102444800\r\n"},
+		{"PEXPIRETIME k", ":4102444800000\r\n"},
+		{"PEXPIREAT k 4102444800123", ":1\r\n"},
+		{"PEXPIRETIME k", ":4102444800123\r\n"},
+
+		//过期时间已经过去时直接删除 key
+		{"EXPIRE k -1", ":1\r\n"},
+		{"GET k", "$-1\r\n"},
+		{"TTL k", ":-2\r\n"},
+		{"SET k v", "+OK\r\n"},
+		{"PEXPIREAT k 1", ":1\r\n"},
+		{"GET k", "$-1\r\n"},
+
+		{"EXPIRE k", "-ERR wrong number of arguments for 'expire' command\r\n"},
+		{"EXPIRE k abc", "-ERR value is not an integer or out of range\r\n"},
+		{"EXPIRE k 100 FOO", "-ERR Unsupported option FOO\r\n"},
+		{"EXPIRE k 100 NX XX", "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n"},
+		{"EXPIRE k 100 GT LT", "-ERR GT and LT options at the same time are not compatible\r\n"},
+		{"EXPIRE k 9223372036854775807", "-ERR invalid expire time in 'expire' command\r\n"},
+	})
+
+	execCmd(db, "SET k v")
+	execCmd(db, "PEXPIRE k 100000")
+	pttl := execCmd(db, "PTTL k")
+	var ms int64
+	if _, err := fmt.Sscanf(pttl, ":%d\r\n", &ms); err != nil || ms <= 90000 || ms > 100000 {
+		t.Errorf("PTTL k = %q, want about 100000", pttl)
+	}
+}
+
+func TestSetExpireOptions(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET k v EX 100", "+OK\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"SET k v", "+OK\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"SET k v PX 100000 XX", "+OK\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"SET k v NX", "$-1\r\n"},
+		{"SET other v XX", "$-1\r\n"},
+		{"SETEX k 100 v", "+OK\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"PSETEX k 100000 v", "+OK\r\n"},
+		{"TTL k", ":100\r\n"},
+
+		{"SET k v EX 0", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SET k v EX", "-ERR syntax error\r\n"},
+		{"SET k v FOO", "-ERR syntax error\r\n"},
+		{"SETEX k -1 v", "-ERR invalid expire time in 'setex' command\r\n"},
+		{"SET k v EX 9223372036854775", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SET k v PX 9223372036854775807", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SETEX k 9223372036854775 v", "-ERR invalid expire time in 'setex' command\r\n"},
+		{"PSETEX k 9223372036854775807 v", "-ERR invalid expire time in 'psetex' command\r\n"},
+		{"TTL k", ":100\r\n"},
+		{"SETEX k abc v", "-ERR value is not an integer or out of range\r\n"},
+		{"PSETEX k 100", "-ERR wrong number of arguments for 'psetex' command\r\n"},
+	})
+}
+
+// 所有命令访问过期的 key 之前都会先删除它
+func TestLazyExpire(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"RPUSH list a b", ":2\r\n"},
+		{"SADD s1 a", ":1\r\n"},
+		{"SET src v", "+OK\r\n"},
+		{"SET dst v", "+OK\r\n"},
+	})
+	//直接设置一个已经过去的过期时间，pexpireat 会立即删除 key
+	for _, key := range []string{"list", "s1", "dst"} {
+		db.TtlMap.Put(key, int64(1000))
+	}
+
+	runCmdCases(t, db, []cmdCase{
+		{"LLEN list", ":0\r\n"},
+		{"SUNION s0 s1", "*0\r\n"},
+		{"RENAMENX src dst", ":1\r\n"},
+		{"GET dst", "$1\r\nv\r\n"},
+		{"TTL dst", ":-1\r\n"},
+	})
+	for _, key := range []string{"list", "s1"} {
+		if _, ok := db.Dataset.Get(key); ok {
+			t.Errorf("expired key %s should be deleted", key)
+		}
+		if _, ok := db.TtlMap.Get(key); ok {
+			t.Errorf("ttl of expired key %s should be deleted", key)
+		}
+	}
+
+	//目标 db 中过期的 key
+	rds := redis.NewDBs()
+	db0, db1 := rds.DBs[0], rds.DBs[1]
+	execCmd(db0, "SET k v0")
+	execCmd(db1, "SET k v1")
+	db1.TtlMap.Put("k", int64(1000))
+	runCmdCases(t, db0, []cmdCase{
+		{"MOVE k 1", ":1\r\n"},
+	})
+	runCmdCases(t, db1, []cmdCase{
+		{"GET k", "$2\r\nv0\r\n"},
+	})
+}
+
+// 用 cursor 从 0 开始一直执行 scan 类命令直到 cursor 为 0，返回所有的元素
+// cmdFormat 中用 %d 表示 cursor
+func scanAll(t *testing.T, db *redis.RedisDB, cmdFormat string) []string {
+	t.Helper()
+	items := make([]string, 0)
+	cursor := "0"
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatalf("%s does not terminate", cmdFormat)
+		}
+		reply := execCmd(db, strings.Replace(cmdFormat, "%d", cursor, 1))
+		// *2 $n cursor *m $l item ...
+		lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+		if len(lines) < 4 || lines[0] != "*2" {
+			t.Fatalf("%s reply = %q", cmdFormat, reply)
+		}
+		for j := 5; j < len(lines); j += 2 {
+			items = append(items, lines[j])
+		}
+		cursor = lines[2]
+		if cursor == "0" {
+			return items
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	for i := 0; i < 100; i++ {
+		execCmd(db, fmt.Sprintf("SET key:%d v", i))
+	}
+	execCmd(db, "RPUSH list a")
+	execCmd(db, "SET expired v")
+	db.TtlMap.Put("expired", int64(1000))
+
+	seen := make(map[string]int)
+	for _, key := range scanAll(t, db, "SCAN %d COUNT 7") {
+		seen[key]++
+	}
+	if len(seen) != 101 || seen["list"] != 1 || seen["expired"] != 0 {
+		t.Errorf("SCAN returned %d keys, want 101 without the expired key", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("SCAN returned %s %d times", key, n)
+		}
+	}
+
+	if keys := scanAll(t, db, "SCAN %d MATCH key:1? COUNT 1000"); len(keys) != 10 {
+		t.Errorf("SCAN MATCH key:1? returned %v", keys)
+	}
+	if keys := scanAll(t, db, "SCAN %d TYPE LIST"); len(keys) != 1 || keys[0] != "list" {
+		t.Errorf("SCAN TYPE list returned %v", keys)
+	}
+
+	runCmdCases(t, db, []cmdCase{
+		{"SCAN x", "-ERR invalid cursor\r\n"},
+		{"SCAN 0 COUNT 0", "-ERR syntax error\r\n"},
+		{"SCAN 0 COUNT", "-ERR syntax error\r\n"},
+		{"SCAN 0 FOO bar", "-ERR syntax error\r\n"},
+		{"SCAN 18446744073709551615", "*2\r\n$1\r\n0\r\n*0\r\n"},
+	})
+}
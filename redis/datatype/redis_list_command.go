@@ -1,17 +1,588 @@
 package datatype
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/helper"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
 	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+	"github.com/chenjiayao/goredistraning/redis/resp"
 	"github.com/chenjiayao/goredistraning/redis/validate"
 )
 
+/**
+LPUSH
+LPUSHX
+RPUSH
+RPUSHX
+LPOP
+RPOP
+RPOPLPUSH
+LMOVE
+LREM
+LLEN
+LINDEX
+LSET
+LRANGE
+LINSERT
+LTRIM
+LPOS
+BLPOP
+BRPOP
+BLMOVE
+*/
 func init() {
+	redis.RegisterExecCommand(redis.Lpush, ExecLPush, validate.ValidateLPush)
+	redis.RegisterExecCommand(redis.Lpushx, ExecLPushX, validate.ValidateLPushX)
+	redis.RegisterExecCommand(redis.Rpush, ExecRPush, validate.ValidateRPush)
+	redis.RegisterExecCommand(redis.Rpushx, ExecRPushX, validate.ValidateRPushX)
 	redis.RegisterExecCommand(redis.Lpop, ExecLPop, validate.ValidateLPop)
+	redis.RegisterExecCommand(redis.Rpop, ExecRPop, validate.ValidateRPop)
+	redis.RegisterExecCommand(redis.Rpoplpush, ExecRPopLPush, validate.ValidateRPopLPush)
+	redis.RegisterExecCommand(redis.Lmove, ExecLMove, validate.ValidateLMove)
+	redis.RegisterExecCommand(redis.Lrem, ExecLRem, validate.ValidateLRem)
+	redis.RegisterExecCommand(redis.Llen, ExecLLen, validate.ValidateLLen)
+	redis.RegisterExecCommand(redis.Lindex, ExecLIndex, validate.ValidateLIndex)
+	redis.RegisterExecCommand(redis.Lset, ExecLSet, validate.ValidateLSet)
+	redis.RegisterExecCommand(redis.Lrange, ExecLRange, validate.ValidateLRange)
+	redis.RegisterExecCommand(redis.Linsert, ExecLInsert, validate.ValidateLInsert)
+	redis.RegisterExecCommand(redis.Ltrim, ExecLTrim, validate.ValidateLTrim)
+	redis.RegisterExecCommand(redis.Lpos, ExecLPos, validate.ValidateLPos)
+	redis.RegisterExecCommand(redis.Blpop, ExecBLPop, validate.ValidateBLPop)
+	redis.RegisterExecCommand(redis.Brpop, ExecBRPop, validate.ValidateBRPop)
+	redis.RegisterExecCommand(redis.Blmove, ExecBLMove, validate.ValidateBLMove)
+}
+
+// lpush key element [element ...]
+func ExecLPush(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return push(db, args, true, false)
+}
+
+// key 存在的时候才 push
+func ExecLPushX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return push(db, args, true, true)
+}
+
+func ExecRPush(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return push(db, args, false, false)
+}
+
+func ExecRPushX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return push(db, args, false, true)
 }
 
+// 返回 push 之后列表的长度
+func push(db *redis.RedisDB, args [][]byte, left bool, onlyExist bool) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		if onlyExist {
+			return resp.MakeNumberResponse(0)
+		}
+		l = quicklist.MakeQuickList()
+		db.Dataset.Put(key, l)
+	}
+
+	for _, element := range args[1:] {
+		if left {
+			l.PushFront(string(element))
+		} else {
+			l.PushBack(string(element))
+		}
+	}
+	return resp.MakeNumberResponse(int64(l.Len()))
+}
+
+// lpop key [count]
+// 没有 count 参数时返回 bulk string，有 count 参数时返回数组
 func ExecLPop(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return pop(db, args, true)
+}
+
+func ExecRPop(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return pop(db, args, false)
+}
+
+func pop(db *redis.RedisDB, args [][]byte, left bool) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	withCount := len(args) == 2
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		if withCount {
+			return resp.NullArrayResponse
+		}
+		return resp.NullBulkResponse
+	}
+
+	if !withCount {
+		val := popOne(l, left)
+		removeListIfEmpty(db, key, l)
+		return resp.MakeBulkResponse([]byte(val))
+	}
+
+	count, _ := strconv.Atoi(string(args[1]))
+	if count > l.Len() {
+		count = l.Len()
+	}
+	vals := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		vals = append(vals, []byte(popOne(l, left)))
+	}
+	removeListIfEmpty(db, key, l)
+	return resp.MakeMultiResponse(vals)
+}
+
+func popOne(l *quicklist.QuickList, left bool) string {
+	var val string
+	if left {
+		val, _ = l.PopFront()
+	} else {
+		val, _ = l.PopBack()
+	}
+	return val
+}
+
+// rpoplpush source destination ---> lmove source destination right left
+func ExecRPopLPush(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return move(db, string(args[0]), string(args[1]), false, true)
+}
+
+// lmove source destination LEFT|RIGHT LEFT|RIGHT
+func ExecLMove(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	fromLeft := strings.ToLower(string(args[2])) == "left"
+	toLeft := strings.ToLower(string(args[3])) == "left"
+	return move(db, string(args[0]), string(args[1]), fromLeft, toLeft)
+}
+
+// 从 source 弹出一个元素 push 到 destination，source 和 destination 可以是同一个 key
+func move(db *redis.RedisDB, source, destination string, fromLeft, toLeft bool) response.Response {
+	db.LockKeys(source, destination)
+	defer db.UnLockKeys(source, destination)
+
+	src, errResp := getList(db, source)
+	if errResp != nil {
+		return errResp
+	}
+	if src == nil {
+		return resp.NullBulkResponse
+	}
+	dst, errResp := getList(db, destination)
+	if errResp != nil {
+		return errResp
+	}
+
+	val := popOne(src, fromLeft)
+	if dst == nil {
+		dst = quicklist.MakeQuickList()
+		db.Dataset.Put(destination, dst)
+	}
+	if toLeft {
+		dst.PushFront(val)
+	} else {
+		dst.PushBack(val)
+	}
+	removeListIfEmpty(db, source, src)
+	return resp.MakeBulkResponse([]byte(val))
+}
+
+// lrem key count element
+func ExecLRem(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.MakeNumberResponse(0)
+	}
+
+	count, _ := strconv.Atoi(string(args[1]))
+	removed := l.RemoveValue(string(args[2]), count)
+	removeListIfEmpty(db, key, l)
+	return resp.MakeNumberResponse(int64(removed))
+}
+
+func ExecLLen(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(int64(l.Len()))
+}
+
+// lindex key index，index 为负数时从尾部开始计算
+func ExecLIndex(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.NullBulkResponse
+	}
+
+	index, _ := strconv.Atoi(string(args[1]))
+	index, ok := normalizeIndex(index, l.Len())
+	if !ok {
+		return resp.NullBulkResponse
+	}
+	return resp.MakeBulkResponse([]byte(l.Get(index)))
+}
+
+// lset key index element
+func ExecLSet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.MakeErrorResponse("ERR no such key")
+	}
+
+	index, _ := strconv.Atoi(string(args[1]))
+	index, ok := normalizeIndex(index, l.Len())
+	if !ok {
+		return resp.MakeErrorResponse("ERR index out of range")
+	}
+	l.Set(index, string(args[2]))
+	return resp.OKSimpleResponse
+}
+
+// lrange key start stop，包含 stop
+func ExecLRange(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.MakeMultiResponse([][]byte{})
+	}
+
+	start, _ := strconv.Atoi(string(args[1]))
+	stop, _ := strconv.Atoi(string(args[2]))
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		return resp.MakeMultiResponse([][]byte{})
+	}
+
+	vals := l.Range(start, stop)
+	res := make([][]byte, len(vals))
+	for i, val := range vals {
+		res[i] = []byte(val)
+	}
+	return resp.MakeMultiResponse(res)
+}
+
+// linsert key BEFORE|AFTER pivot element
+// 返回插入之后列表的长度，key 不存在返回 0，pivot 不存在返回 -1
+func ExecLInsert(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.MakeNumberResponse(0)
+	}
+
+	pivot := string(args[2])
+	pivotIndex := -1
+	l.ForEach(0, func(index int, val string) bool {
+		if val == pivot {
+			pivotIndex = index
+			return false
+		}
+		return true
+	})
+	if pivotIndex == -1 {
+		return resp.MakeNumberResponse(-1)
+	}
+
+	if strings.ToLower(string(args[1])) == "after" {
+		pivotIndex++
+	}
+	l.Insert(pivotIndex, string(args[3]))
+	return resp.MakeNumberResponse(int64(l.Len()))
+}
+
+// ltrim key start stop，只保留 [start, stop] 范围内的元素
+func ExecLTrim(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return resp.OKSimpleResponse
+	}
+
+	start, _ := strconv.Atoi(string(args[1]))
+	stop, _ := strconv.Atoi(string(args[2]))
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		l.Clear()
+	} else {
+		l.Trim(start, stop)
+	}
+	removeListIfEmpty(db, key, l)
+	return resp.OKSimpleResponse
+}
+
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+// rank：返回第几个匹配的元素，负数表示从尾部开始匹配
+// count：返回多少个匹配的元素，0 表示返回所有，指定了 count 时返回数组
+// maxlen：最多比较多少个元素，0 表示不限制
+func ExecLPos(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	element := string(args[1])
+	rank, count, maxLen := 1, 0, 0
+	withCount := false
+	for i := 2; i < len(args); i += 2 {
+		value, _ := strconv.Atoi(string(args[i+1]))
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			rank = value
+		case "count":
+			count = value
+			withCount = true
+		case "maxlen":
+			maxLen = value
+		}
+	}
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	l, errResp := getList(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		if withCount {
+			return resp.MakeArrayResponse([]response.Response{})
+		}
+		return resp.NullBulkResponse
+	}
+
+	matches := make([]response.Response, 0)
+	skip := rank - 1 // 需要跳过的匹配个数
+	compared := 0
+	consumer := func(index int, val string) bool {
+		if maxLen != 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if val != element {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		matches = append(matches, resp.MakeNumberResponse(int64(index)))
+		return withCount && (count == 0 || len(matches) < count)
+	}
+	if rank > 0 {
+		l.ForEach(0, consumer)
+	} else {
+		skip = -rank - 1
+		l.ReverseForEach(l.Len()-1, consumer)
+	}
+
+	if withCount {
+		return resp.MakeArrayResponse(matches)
+	}
+	if len(matches) == 0 {
+		return resp.NullBulkResponse
+	}
+	return matches[0]
+}
+
+// blpop key [key ...] timeout
+func ExecBLPop(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return blockingPop(conn, db, args, true)
+}
+
+// brpop key [key ...] timeout
+func ExecBRPop(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return blockingPop(conn, db, args, false)
+}
+
+// 按顺序从第一个有元素的 key 中弹出元素，所有 key 都没有元素时阻塞
+func blockingPop(conn conn.Conn, db *redis.RedisDB, args [][]byte, left bool) response.Response {
+	keys := helper.BbyteToSString(args[:len(args)-1])
+	for _, key := range keys {
+		res := pop(db, [][]byte{[]byte(key)}, left)
+		if reply, ok := makeBlockingPopReply(key, res); ok {
+			return reply
+		}
+	}
+
+	//exec 中的阻塞命令不会阻塞，直接返回超时的回复
+	if conn.GetMultiState() == int(redis.InExecState) {
+		return resp.NullArrayResponse
+	}
+
+	popCmd := redis.Lpop
+	if !left {
+		popCmd = redis.Rpop
+	}
+	return &redis.BlockedResponse{
+		Keys:    keys,
+		Timeout: parseTimeout(args[len(args)-1]),
+		ServeCmd: func(key string) [][]byte {
+			return [][]byte{[]byte(popCmd), []byte(key)}
+		},
+		MakeReply:    makeBlockingPopReply,
+		TimeoutReply: resp.NullArrayResponse,
+	}
+}
+
+// lpop/rpop 的回复转换成 blpop/brpop 的回复：[key, element]，错误直接返回
+func makeBlockingPopReply(key string, res response.Response) (response.Response, bool) {
+	bulk, ok := res.(resp.RedisBulkResponse)
+	if !ok {
+		return res, true
+	}
+	if bulk.Content == nil {
+		return nil, false
+	}
+	return resp.MakeMultiResponse([][]byte{[]byte(key), bulk.Content}), true
+}
+
+// blmove source destination LEFT|RIGHT LEFT|RIGHT timeout
+func ExecBLMove(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	res := ExecLMove(conn, db, args[:4])
+	if reply, ok := makeBlockingMoveReply(string(args[0]), res); ok {
+		return reply
+	}
+
+	if conn.GetMultiState() == int(redis.InExecState) {
+		return resp.NullBulkResponse
+	}
+
+	lmoveCmd := append([][]byte{[]byte(redis.Lmove)}, args[:4]...)
+	return &redis.BlockedResponse{
+		Keys:    []string{string(args[0])},
+		Timeout: parseTimeout(args[4]),
+		ServeCmd: func(key string) [][]byte {
+			return lmoveCmd
+		},
+		MakeReply:    makeBlockingMoveReply,
+		TimeoutReply: resp.NullBulkResponse,
+	}
+}
+
+// source 为空时 lmove 返回 nil，继续阻塞
+func makeBlockingMoveReply(key string, res response.Response) (response.Response, bool) {
+	if bulk, ok := res.(resp.RedisBulkResponse); ok && bulk.Content == nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// 超时时间已经校验过了，单位是秒，0 表示一直阻塞
+func parseTimeout(arg []byte) time.Duration {
+	seconds, _ := strconv.ParseFloat(string(arg), 64)
+	timeout := time.Duration(seconds * float64(time.Second))
+	if seconds > 0 && timeout <= 0 {
+		//不到 1ns 的超时时间不能当成一直阻塞
+		timeout = 1
+	}
+	return timeout
+}
+
+// key 不存在时返回 nil，key 不是 list 类型时返回 WRONGTYPE 错误
+func getList(db *redis.RedisDB, key string) (*quicklist.QuickList, response.Response) {
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return nil, nil
+	}
+	l, ok := v.(*quicklist.QuickList)
+	if !ok {
+		return nil, resp.MakeErrorResponse(rediserr.WRONG_TYPE_ERROR.Error())
+	}
+	return l, nil
+}
+
+// 列表中的元素全部被删除之后，删除这个 key
+func removeListIfEmpty(db *redis.RedisDB, key string, l *quicklist.QuickList) {
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+}
+
+// 负数下标从尾部开始计算，下标超出范围时返回 false
+func normalizeIndex(index int, size int) (int, bool) {
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return 0, false
+	}
+	return index, true
+}
 
-	return nil
+// 把 [start, stop] 转换成 [0, size) 范围内的下标，范围为空时返回 false
+func normalizeRange(start, stop int, size int) (int, int, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop, true
 }
@@ -0,0 +1,141 @@
+package datatype
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+// 通过 db.Exec 执行一条命令（包括参数校验），返回 RESP2 编码之后的结果
+func execCmd(db *redis.RedisDB, cmdLine string) string {
+	fields := strings.Fields(cmdLine)
+	args := make([][]byte, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		args = append(args, []byte(field))
+	}
+
+	res := db.Exec(redis.MakeRedisConn(nil), strings.ToLower(fields[0]), args)
+	if !res.ISOK() {
+		return string(res.ToErrorByte())
+	}
+	return string(resp.Encode(res, resp.RESP2))
+}
+
+type cmdCase struct {
+	cmd  string
+	want string
+}
+
+func runCmdCases(t *testing.T, db *redis.RedisDB, cases []cmdCase) {
+	for _, c := range cases {
+		if got := execCmd(db, c.cmd); got != c.want {
+			t.Errorf("%s = %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestListPushPop(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"LPUSHX list a", ":0\r\n"},
+		{"RPUSH list b c", ":2\r\n"},
+		{"LPUSH list a z", ":4\r\n"},
+		{"RPUSHX list d", ":5\r\n"},
+		{"LRANGE list 0 -1", "*5\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"LPOP list", "$1\r\nz\r\n"},
+		{"RPOP list", "$1\r\nd\r\n"},
+		{"LPOP list 2", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"RPOP list 5", "*1\r\n$1\r\nc\r\n"},
+		{"LLEN list", ":0\r\n"},
+		{"LPOP list", "$-1\r\n"},
+		{"LPOP list 1", "*-1\r\n"},
+		{"LPOP list -1", "-ERR value is out of range, must be positive\r\n"},
+		{"LPUSH list", "-ERR wrong number of arguments for 'lpush' command\r\n"},
+	})
+
+	if _, exist := db.Dataset.Get("list"); exist {
+		t.Errorf("empty list should be removed")
+	}
+}
+
+func TestListIndexAndRange(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"RPUSH list a b c d", ":4\r\n"},
+		{"LINDEX list 0", "$1\r\na\r\n"},
+		{"LINDEX list -1", "$1\r\nd\r\n"},
+		{"LINDEX list 4", "$-1\r\n"},
+		{"LINDEX list x", "-ERR value is not an integer or out of range\r\n"},
+		{"LSET list -2 C", "+OK\r\n"},
+		{"LSET list 10 C", "-ERR index out of range\r\n"},
+		{"LSET nokey 0 C", "-ERR no such key\r\n"},
+		{"LRANGE list 1 2", "*2\r\n$1\r\nb\r\n$1\r\nC\r\n"},
+		{"LRANGE list -100 100", "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nC\r\n$1\r\nd\r\n"},
+		{"LRANGE list 3 1", "*0\r\n"},
+		{"LRANGE nokey 0 -1", "*0\r\n"},
+		{"LTRIM list 1 -2", "+OK\r\n"},
+		{"LRANGE list 0 -1", "*2\r\n$1\r\nb\r\n$1\r\nC\r\n"},
+		{"LTRIM list 5 10", "+OK\r\n"},
+		{"LLEN list", ":0\r\n"},
+	})
+}
+
+func TestListInsertRemAndPos(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"RPUSH list a b c a b c a", ":7\r\n"},
+		{"LINSERT list BEFORE b x", ":8\r\n"},
+		{"LINSERT list after c y", ":9\r\n"},
+		{"LINSERT list before nothing y", ":-1\r\n"},
+		{"LINSERT nokey before a y", ":0\r\n"},
+		{"LINSERT list middle a y", "-ERR syntax error\r\n"},
+		{"LRANGE list 0 4", "*5\r\n$1\r\na\r\n$1\r\nx\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\ny\r\n"},
+		{"LPOS list a", ":0\r\n"},
+		{"LPOS list a RANK 2", ":5\r\n"},
+		{"LPOS list a RANK -1", ":8\r\n"},
+		{"LPOS list a COUNT 0", "*3\r\n:0\r\n:5\r\n:8\r\n"},
+		{"LPOS list a RANK -1 COUNT 2", "*2\r\n:8\r\n:5\r\n"},
+		{"LPOS list a COUNT 0 MAXLEN 6", "*2\r\n:0\r\n:5\r\n"},
+		{"LPOS list z", "$-1\r\n"},
+		{"LPOS list a RANK 0", "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match\r\n"},
+		{"LPOS list a COUNT", "-ERR syntax error\r\n"},
+		{"LREM list -1 a", ":1\r\n"},
+		{"LREM list 0 b", ":2\r\n"},
+		{"LRANGE list 0 -1", "*6\r\n$1\r\na\r\n$1\r\nx\r\n$1\r\nc\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nc\r\n"},
+	})
+}
+
+func TestListMove(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"RPUSH src a b c", ":3\r\n"},
+		{"RPOPLPUSH src dst", "$1\r\nc\r\n"},
+		{"LMOVE src dst LEFT RIGHT", "$1\r\na\r\n"},
+		{"LRANGE dst 0 -1", "*2\r\n$1\r\nc\r\n$1\r\na\r\n"},
+		{"LMOVE dst dst LEFT RIGHT", "$1\r\nc\r\n"},
+		{"LRANGE dst 0 -1", "*2\r\n$1\r\na\r\n$1\r\nc\r\n"},
+		{"LMOVE src dst UP RIGHT", "-ERR syntax error\r\n"},
+		{"RPOPLPUSH src dst", "$1\r\nb\r\n"},
+		{"RPOPLPUSH src dst", "$-1\r\n"},
+		{"LLEN dst", ":3\r\n"},
+	})
+}
+
+func TestListWrongType(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	db.Dataset.Put("string", "value")
+	wrongType := "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+
+	runCmdCases(t, db, []cmdCase{
+		{"LPUSH string a", wrongType},
+		{"RPOP string", wrongType},
+		{"LLEN string", wrongType},
+		{"LRANGE string 0 -1", wrongType},
+		{"RPUSH list a", ":1\r\n"},
+		{"LMOVE list string LEFT LEFT", wrongType},
+		{"LLEN list", ":1\r\n"},
+		{"GET list", wrongType},
+	})
+}
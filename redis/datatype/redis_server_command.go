@@ -2,10 +2,12 @@ package datatype
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/glob"
 	"github.com/chenjiayao/goredistraning/redis"
 	"github.com/chenjiayao/goredistraning/redis/resp"
 	"github.com/chenjiayao/goredistraning/redis/validate"
@@ -14,6 +16,15 @@ import (
 func init() {
 	redis.RegisterExecCommand(redis.Auth, ExecAuth, validate.ValidateAuthFunc)
 	redis.RegisterExecCommand(redis.Select, ExecSelect, validate.ValidateSelectFunc)
+	redis.RegisterExecCommand(redis.Bgrewriteaof, ExecBgRewriteAof, validate.ValidateBgRewriteAof)
+	redis.RegisterExecCommand(redis.Save, ExecSave, validate.ValidateSave)
+	redis.RegisterExecCommand(redis.Bgsave, ExecBgSave, validate.ValidateBgSave)
+	redis.RegisterExecCommand(redis.Lastsave, ExecLastSave, validate.ValidateLastSave)
+	redis.RegisterExecCommand(redis.Hello, ExecHello, validate.ValidateHello)
+	redis.RegisterExecCommand(redis.Config, ExecConfig, validate.ValidateConfig)
+	redis.RegisterExecCommand(redis.Keys, ExecKeys, validate.ValidateKeys)
+	redis.RegisterExecCommand(redis.Flushdb, ExecFlushdb, validate.ValidateFlush)
+	redis.RegisterExecCommand(redis.Flushall, ExecFlushall, validate.ValidateFlush)
 }
 
 func ExecAuth(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
@@ -32,3 +43,165 @@ func ExecSelect(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respo
 	conn.SetSelectedDBIndex(dbIndex)
 	return resp.OKSimpleResponse
 }
+
+func ExecBgRewriteAof(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	if redis.ServerInstance == nil {
+		return resp.MakeErrorResponse("ERR server is not running")
+	}
+	err := redis.ServerInstance.BgRewriteAof()
+	if err != nil {
+		return resp.MakeErrorResponse(err.Error())
+	}
+	return resp.MakeSimpleResponse("Background append only file rewriting started")
+}
+
+// save 执行期间持有 server 的写锁，其他命令都不能执行
+func ExecSave(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	if redis.ServerInstance == nil {
+		return resp.MakeErrorResponse("ERR server is not running")
+	}
+	err := redis.ServerInstance.Save()
+	if err != nil {
+		return resp.MakeErrorResponse(err.Error())
+	}
+	return resp.OKSimpleResponse
+}
+
+func ExecBgSave(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	if redis.ServerInstance == nil {
+		return resp.MakeErrorResponse("ERR server is not running")
+	}
+	err := redis.ServerInstance.BgSave()
+	if err != nil {
+		return resp.MakeErrorResponse(err.Error())
+	}
+	return resp.MakeSimpleResponse("Background saving started")
+}
+
+func ExecLastSave(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	if redis.ServerInstance == nil {
+		return resp.MakeErrorResponse("ERR server is not running")
+	}
+	return resp.MakeNumberResponse(redis.ServerInstance.LastSave())
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+// 切换协议版本，同时可以认证和设置客户端名称，返回服务端的信息
+func ExecHello(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	protocol := conn.GetProtocol()
+	if len(args) > 0 {
+		protocol, _ = strconv.Atoi(string(args[0]))
+		if protocol != resp.RESP2 && protocol != resp.RESP3 {
+			return resp.MakeErrorResponse("NOPROTO unsupported protocol version")
+		}
+	}
+
+	name := ""
+	setName := false
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			username := string(args[i+1])
+			password := string(args[i+2])
+			if username != "default" || config.Config.RequirePass != password {
+				return resp.MakeErrorResponse("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			conn.SetPassword(password)
+			i += 2
+		case "setname":
+			name = string(args[i+1])
+			setName = true
+			i++
+		}
+	}
+
+	if config.Config.RequirePass != conn.GetPassword() {
+		return resp.MakeErrorResponse("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	if setName {
+		conn.SetName(name)
+	}
+	conn.SetProtocol(protocol)
+
+	keys := []response.Response{
+		resp.MakeBulkResponse([]byte("server")),
+		resp.MakeBulkResponse([]byte("version")),
+		resp.MakeBulkResponse([]byte("proto")),
+		resp.MakeBulkResponse([]byte("id")),
+		resp.MakeBulkResponse([]byte("mode")),
+		resp.MakeBulkResponse([]byte("role")),
+		resp.MakeBulkResponse([]byte("modules")),
+	}
+	values := []response.Response{
+		resp.MakeBulkResponse([]byte("redis")),
+		resp.MakeBulkResponse([]byte(redis.Version)),
+		resp.MakeNumberResponse(int64(protocol)),
+		resp.MakeNumberResponse(conn.GetID()),
+		resp.MakeBulkResponse([]byte("standalone")),
+		resp.MakeBulkResponse([]byte("master")),
+		resp.MakeArrayResponse(nil),
+	}
+	return resp.MakeMapResponse(keys, values)
+}
+
+// CONFIG GET parameter [parameter ...]
+// parameter 支持 glob 风格的匹配，不区分大小写，返回所有匹配的配置项
+func ExecConfig(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	subCommand := strings.ToLower(string(args[0]))
+	if subCommand != "get" {
+		return resp.MakeErrorResponse("ERR unknown subcommand '" + string(args[0]) + "'. Try CONFIG GET.")
+	}
+
+	names, values := config.Items()
+	matched := make(map[string]bool)
+	keys := make([]response.Response, 0)
+	vals := make([]response.Response, 0)
+	for _, pattern := range args[1:] {
+		p := string(pattern)
+		for i, name := range names {
+			if matched[name] {
+				continue
+			}
+			if glob.MatchNoCase(p, name) {
+				matched[name] = true
+				keys = append(keys, resp.MakeBulkResponse([]byte(name)))
+				vals = append(vals, resp.MakeBulkResponse([]byte(values[i])))
+			}
+		}
+	}
+	return resp.MakeMapResponse(keys, vals)
+}
+
+// keys pattern，返回所有匹配 pattern 的 key，已经过期的 key 不会返回
+// 需要遍历整个 db，key 很多的时候应该使用 scan
+func ExecKeys(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	pattern := string(args[0])
+	//和 redis 一样，* 直接返回所有的 key（glob 中 * 不能匹配空字符串）
+	allKeys := pattern == "*"
+
+	keys := make([][]byte, 0)
+	db.Dataset.ForEach(func(key string, val interface{}) bool {
+		if (allKeys || glob.Match(pattern, key)) && !isExpired(db, key) {
+			keys = append(keys, []byte(key))
+		}
+		return true
+	})
+	return resp.MakeMultiResponse(keys)
+}
+
+// flushdb [ASYNC|SYNC]，清空当前 db，ASYNC 和 SYNC 的效果一样，都是同步清空
+func ExecFlushdb(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	db.Flush()
+	return resp.OKSimpleResponse
+}
+
+// flushall [ASYNC|SYNC]，清空所有 db
+func ExecFlushall(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	for i := 0; i < config.Config.Databases; i++ {
+		if other := db.GetDB(i); other != nil {
+			other.Flush()
+		}
+	}
+	return resp.OKSimpleResponse
+}
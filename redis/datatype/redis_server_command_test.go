@@ -0,0 +1,130 @@
+package datatype
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+func TestExecHello(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	conn := redis.MakeRedisConn(nil)
+
+	res := ExecHello(conn, db, [][]byte{[]byte("3")})
+	if !res.ISOK() {
+		t.Fatalf("ExecHello(3) = %s", string(res.ToErrorByte()))
+	}
+	if conn.GetProtocol() != resp.RESP3 {
+		t.Errorf("conn protocol = %d, want 3", conn.GetProtocol())
+	}
+	got := string(resp.Encode(res, conn.GetProtocol()))
+	if !strings.HasPrefix(got, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n") {
+		t.Errorf("ExecHello(3) = %q, want a RESP3 map", got)
+	}
+
+	res = ExecHello(conn, db, [][]byte{[]byte("4")})
+	if res.ISOK() || !strings.HasPrefix(string(res.ToErrorByte()), "-NOPROTO") {
+		t.Errorf("ExecHello(4) should return NOPROTO error")
+	}
+
+	res = ExecHello(conn, db, [][]byte{[]byte("2"), []byte("setname"), []byte("client")})
+	if !res.ISOK() || conn.GetProtocol() != resp.RESP2 || conn.GetName() != "client" {
+		t.Errorf("ExecHello(2 setname client) should switch back to RESP2 and set name")
+	}
+}
+
+func TestExecHello_Auth(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.RequirePass = "secret"
+	defer config.LoadDefaultConfig()
+
+	db := redis.NewDBInstance(0)
+	conn := redis.MakeRedisConn(nil)
+
+	res := ExecHello(conn, db, [][]byte{[]byte("3")})
+	if res.ISOK() || !strings.HasPrefix(string(res.ToErrorByte()), "-NOAUTH") {
+		t.Errorf("ExecHello(3) without auth should return NOAUTH error")
+	}
+
+	res = ExecHello(conn, db, [][]byte{[]byte("3"), []byte("AUTH"), []byte("default"), []byte("wrong")})
+	if res.ISOK() || !strings.HasPrefix(string(res.ToErrorByte()), "-WRONGPASS") {
+		t.Errorf("ExecHello(3 auth default wrong) should return WRONGPASS error")
+	}
+
+	res = ExecHello(conn, db, [][]byte{[]byte("3"), []byte("AUTH"), []byte("default"), []byte("secret")})
+	if !res.ISOK() || conn.GetProtocol() != resp.RESP3 {
+		t.Errorf("ExecHello(3 auth default secret) should authenticate and switch to RESP3")
+	}
+}
+
+func TestExecConfig(t *testing.T) {
+	config.LoadDefaultConfig()
+	res := ExecConfig(nil, nil, [][]byte{[]byte("get"), []byte("port")})
+	want := "*2\r\n$4\r\nport\r\n$4\r\n3101\r\n"
+	if got := string(res.ToContentByte()); got != want {
+		t.Errorf("ExecConfig(get port) = %q, want %q", got, want)
+	}
+
+	want = "%1\r\n$4\r\nport\r\n$4\r\n3101\r\n"
+	if got := string(resp.Encode(res, resp.RESP3)); got != want {
+		t.Errorf("ExecConfig(get port) in RESP3 = %q, want %q", got, want)
+	}
+
+	res = ExecConfig(nil, nil, [][]byte{[]byte("get"), []byte("append*")})
+	if got := string(res.ToContentByte()); !strings.HasPrefix(got, "*6\r\n") {
+		t.Errorf("ExecConfig(get append*) = %q, want 3 items", got)
+	}
+
+	//pattern 不区分大小写
+	res = ExecConfig(nil, nil, [][]byte{[]byte("get"), []byte("P[O]R?")})
+	want = "*2\r\n$4\r\nport\r\n$4\r\n3101\r\n"
+	if got := string(res.ToContentByte()); got != want {
+		t.Errorf("ExecConfig(get P[O]R?) = %q, want %q", got, want)
+	}
+}
+
+func TestExecKeys(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	for _, key := range []string{"foo_a", "foo_b", "foo_c", "key_x", "key_y", "key_z", "*", "a?b"} {
+		execCmd(db, "SET "+key+" v")
+	}
+	execCmd(db, "SET foo_expired v")
+	db.TtlMap.Put("foo_expired", int64(1000))
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"foo*", []string{"foo_a", "foo_b", "foo_c"}},
+		{"*", []string{"*", "a?b", "foo_a", "foo_b", "foo_c", "key_x", "key_y", "key_z"}},
+		{"key_[xy]", []string{"key_x", "key_y"}},
+		{"key_[^x]", []string{"key_y", "key_z"}},
+		{"key_[w-y]", []string{"key_x", "key_y"}},
+		{"\\*", []string{"*"}},
+		{"a\\?b", []string{"a?b"}},
+		{"nothing*", []string{}},
+	}
+	for _, tt := range tests {
+		reply := execCmd(db, "KEYS "+tt.pattern)
+		lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+		got := make([]string, 0)
+		for i := 2; i < len(lines); i += 2 {
+			got = append(got, lines[i])
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("KEYS %s = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+
+	runCmdCases(t, db, []cmdCase{
+		{"KEYS", "-ERR wrong number of arguments for 'keys' command\r\n"},
+		{"KEYS a b", "-ERR wrong number of arguments for 'keys' command\r\n"},
+	})
+}
@@ -1,130 +1,460 @@
 package datatype
 
 import (
+	"math"
+	"strconv"
+
+	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/interface/response"
 	"github.com/chenjiayao/goredistraning/lib/set"
 	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
 	"github.com/chenjiayao/goredistraning/redis/resp"
 	"github.com/chenjiayao/goredistraning/redis/validate"
 )
 
-// TODO set 中很多操作达不到 redis 的时间复杂度，这里先做功能实现，后续再考虑性能优化
-
 /**
 SADD
+SREM
 SCARD
 SMEMBERS
 SISMEMBER
-
-
+SMISMEMBER
+SPOP
+SRANDMEMBER
+SMOVE
 SDIFF
 SDIFFSTORE
 SINTER
 SINTERSTORE
-SMOVE
-SPOP
-SRANDMEMBER
-SREM
+SINTERCARD
 SUNION
 SUNIONSTORE
 SSCAN
 */
 func init() {
-	redis.RegisterExecCommand(redis.Sdiff, ExecSdiff, validate.ValidateSdiff)
-	redis.RegisterExecCommand(redis.Sismember, ExecSismember, validate.ValidateSismember)
-	redis.RegisterExecCommand(redis.Spop, ExecSpop, validate.ValidateSpop)
 	redis.RegisterExecCommand(redis.Sadd, ExecSadd, validate.ValidateSadd)
+	redis.RegisterExecCommand(redis.Srem, ExecSrem, validate.ValidateSrem)
 	redis.RegisterExecCommand(redis.Scard, ExecScard, validate.ValidateScard)
 	redis.RegisterExecCommand(redis.Smembers, ExecSmembers, validate.ValidateSmembers)
+	redis.RegisterExecCommand(redis.Sismember, ExecSismember, validate.ValidateSismember)
+	redis.RegisterExecCommand(redis.Smismember, ExecSmismember, validate.ValidateSmismember)
+	redis.RegisterExecCommand(redis.Spop, ExecSpop, validate.ValidateSpop)
+	redis.RegisterExecCommand(redis.Srandmember, ExecSrandmember, validate.ValidateSrandmember)
+	redis.RegisterExecCommand(redis.Smove, ExecSmove, validate.ValidateSmove)
+	redis.RegisterExecCommand(redis.Sdiff, ExecSdiff, validate.ValidateSdiff)
+	redis.RegisterExecCommand(redis.Sdiffstore, ExecSdiffstore, validate.ValidateSdiffstore)
+	redis.RegisterExecCommand(redis.Sinter, ExecSinter, validate.ValidateSinter)
+	redis.RegisterExecCommand(redis.Sinterstore, ExecSinterstore, validate.ValidateSinterstore)
+	redis.RegisterExecCommand(redis.Sintercard, ExecSintercard, validate.ValidateSintercard)
+	redis.RegisterExecCommand(redis.Sunion, ExecSunion, validate.ValidateSunion)
+	redis.RegisterExecCommand(redis.Sunionstore, ExecSunionstore, validate.ValidateSunionstore)
+	redis.RegisterExecCommand(redis.Sscan, ExecSscan, validate.ValidateSscan)
+}
+
+//SADD runoobkey redis，返回新增的 member 个数
+func ExecSadd(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if s == nil {
+		s = set.MakeSet(config.Config.SetMaxIntsetEntries)
+		db.Dataset.Put(key, s)
+	}
 
+	added := 0
+	for _, v := range args[1:] {
+		added += s.Add(string(v))
+	}
+	return resp.MakeNumberResponse(int64(added))
 }
 
-const (
-	size = 2 >> 64
-)
+// srem key member [member ...]，返回删除的 member 个数
+func ExecSrem(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
-func ExecSdiff(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if s == nil {
+		return resp.MakeNumberResponse(0)
+	}
 
-	return nil
+	removed := 0
+	for _, v := range args[1:] {
+		removed += s.Del(string(v))
+	}
+	removeSetIfEmpty(db, key, s)
+	return resp.MakeNumberResponse(int64(removed))
 }
 
-func ExecSismember(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+func ExecScard(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 	key := string(args[0])
-	s := getSet(conn, db, key)
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
 	if s == nil {
 		return resp.MakeNumberResponse(0)
 	}
+	return resp.MakeNumberResponse(int64(s.Len()))
+}
+
+func ExecSmembers(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if s == nil {
+		return resp.MakeSetResponse(nil)
+	}
+	return makeSetMembersResponse(s)
+}
 
-	exist := s.Exist(key)
-	if exist {
+func ExecSismember(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if s != nil && s.Exist(string(args[1])) {
 		return resp.MakeNumberResponse(1)
 	}
 	return resp.MakeNumberResponse(0)
 }
 
+// smismember key member [member ...]，按顺序返回每个 member 是否存在
+func ExecSmismember(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	res := make([]response.Response, len(args)-1)
+	for i, member := range args[1:] {
+		if s != nil && s.Exist(string(member)) {
+			res[i] = resp.MakeNumberResponse(1)
+		} else {
+			res[i] = resp.MakeNumberResponse(0)
+		}
+	}
+	return resp.MakeArrayResponse(res)
+}
+
+// spop key [count]
+// 没有 count 时返回一个 member，有 count 时返回最多 count 个不重复的 member
+// 弹出的 member 是随机的，aof 中记录成 srem
 func ExecSpop(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 	key := string(args[0])
-	s := getSet(conn, db, key)
-	if s == nil {
-		return resp.NullMultiResponse
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
 	}
 
-	return nil
+	if len(args) == 1 {
+		if s == nil {
+			return resp.NullBulkResponse
+		}
+		member := s.RandomDistinctMembers(1)[0]
+		s.Del(member)
+		removeSetIfEmpty(db, key, s)
+		propagate(conn, [][]byte{[]byte(redis.Srem), args[0], []byte(member)})
+		return resp.MakeBulkResponse([]byte(member))
+	}
+
+	count, _ := strconv.ParseInt(string(args[1]), 10, 64)
+	if s == nil || count == 0 {
+		return resp.MakeSetResponse(nil)
+	}
+	members := s.RandomDistinctMembers(int(count))
+	res := make([]response.Response, len(members))
+	sremCmd := [][]byte{[]byte(redis.Srem), args[0]}
+	for i, member := range members {
+		s.Del(member)
+		res[i] = resp.MakeBulkResponse([]byte(member))
+		sremCmd = append(sremCmd, []byte(member))
+	}
+	removeSetIfEmpty(db, key, s)
+	propagate(conn, sremCmd)
+	return resp.MakeSetResponse(res)
 }
 
-//SADD runoobkey redis
-func ExecSadd(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+// srandmember key [count]
+// count 为正数时返回最多 count 个不重复的 member，为负数时返回 -count 个可能重复的 member
+func ExecSrandmember(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
-	setValue := getSetOrInitSet(conn, db, string(args[0]))
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
 
-	for _, v := range args[1:] {
-		setValue.Add(string(v))
+	if len(args) == 1 {
+		if s == nil {
+			return resp.NullBulkResponse
+		}
+		return resp.MakeBulkResponse([]byte(s.RandomDistinctMembers(1)[0]))
 	}
 
-	db.Dataset.Put(string(args[0]), setValue)
+	count, _ := strconv.ParseInt(string(args[1]), 10, 64)
+	if s == nil || count == 0 {
+		return resp.MakeMultiResponse([][]byte{})
+	}
+
+	var members []string
+	if count > 0 {
+		members = s.RandomDistinctMembers(int(count))
+	} else {
+		if count < -math.MaxInt32 {
+			return resp.MakeErrorResponse("ERR value is out of range")
+		}
+		members = s.RandomMembers(int(-count))
+	}
+	res := make([][]byte, len(members))
+	for i, member := range members {
+		res[i] = []byte(member)
+	}
+	return resp.MakeMultiResponse(res)
+}
+
+// smove source destination member，member 移动成功返回 1
+func ExecSmove(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	source := string(args[0])
+	destination := string(args[1])
+	member := string(args[2])
+	db.LockKeys(source, destination)
+	defer db.UnLockKeys(source, destination)
+
+	src, errResp := getSet(db, source)
+	if errResp != nil {
+		return errResp
+	}
+	dst, errResp := getSet(db, destination)
+	if errResp != nil {
+		return errResp
+	}
+	if src == nil || !src.Exist(member) {
+		return resp.MakeNumberResponse(0)
+	}
+	if source == destination {
+		return resp.MakeNumberResponse(1)
+	}
+
+	src.Del(member)
+	removeSetIfEmpty(db, source, src)
+	if dst == nil {
+		dst = set.MakeSet(config.Config.SetMaxIntsetEntries)
+		db.Dataset.Put(destination, dst)
+	}
+	dst.Add(member)
 	return resp.MakeNumberResponse(1)
 }
 
-func ExecScard(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+// sdiff key [key ...]
+func ExecSdiff(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperation(db, args, diffSets)
+}
+
+// sinter key [key ...]
+func ExecSinter(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperation(db, args, set.Intersect)
+}
+
+// sunion key [key ...]
+func ExecSunion(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperation(db, args, set.Union)
+}
+
+// sdiffstore destination key [key ...]，返回结果集的元素个数
+func ExecSdiffstore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperationStore(db, args, diffSets)
+}
+
+func ExecSinterstore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperationStore(db, args, set.Intersect)
+}
+
+func ExecSunionstore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return execSetOperationStore(db, args, set.Union)
+}
+
+// sintercard numkeys key [key ...] [LIMIT limit]
+// 返回交集的元素个数，limit 不为 0 时数到 limit 个就停止
+func ExecSintercard(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	numKeys, _ := strconv.Atoi(string(args[0]))
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	limit := 0
+	if len(args) > numKeys+1 {
+		limit, _ = strconv.Atoi(string(args[numKeys+2]))
+	}
+
+	db.LockKeys(keys...)
+	defer db.UnLockKeys(keys...)
+
+	sets, errResp := getSets(db, keys)
+	if errResp != nil {
+		return errResp
+	}
 
+	smallest := sets[0]
+	for _, s := range sets[1:] {
+		if s.Len() < smallest.Len() {
+			smallest = s
+		}
+	}
+	count := 0
+	smallest.ForEach(func(member string) bool {
+		for _, s := range sets {
+			if !s.Exist(member) {
+				return true
+			}
+		}
+		count++
+		return limit == 0 || count < limit
+	})
+	return resp.MakeNumberResponse(int64(count))
+}
+
+// sscan key cursor [MATCH pattern] [COUNT count]
+func ExecSscan(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 	key := string(args[0])
-	s := getSetOrInitSet(conn, db, key)
-	return resp.MakeNumberResponse(int64(s.Len()))
+	options := parseScanOptions(args[1:])
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	s, errResp := getSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if s == nil {
+		return makeScanResponse(0, [][]byte{})
+	}
+
+	members, next := s.Scan(options.cursor, options.count)
+
+	items := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if options.match(member) {
+			items = append(items, []byte(member))
+		}
+	}
+	return makeScanResponse(next, items)
 }
 
-func ExecSmembers(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+func diffSets(sets ...*set.Set) *set.Set {
+	return set.Diff(sets[0], sets[1:]...)
+}
+
+// 对多个 key 执行集合运算，不存在的 key 当作空集合
+func execSetOperation(db *redis.RedisDB, args [][]byte, operation func(sets ...*set.Set) *set.Set) response.Response {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	db.LockKeys(keys...)
+	defer db.UnLockKeys(keys...)
+
+	sets, errResp := getSets(db, keys)
+	if errResp != nil {
+		return errResp
+	}
+	return makeSetMembersResponse(operation(sets...))
+}
+
+// 集合运算的结果保存到 destination 中，结果为空时删除 destination
+// 和 redis 一样覆盖 destination 原来的值以及过期时间
+func execSetOperationStore(db *redis.RedisDB, args [][]byte, operation func(sets ...*set.Set) *set.Set) response.Response {
+	destination := string(args[0])
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+	db.LockKeys(append(keys, destination)...)
+	defer db.UnLockKeys(append(keys, destination)...)
 
-	setValue := getSetOrInitSet(conn, db, string(args[0]))
-	if setValue.Len() == 0 {
-		// TODO 返回空数组
-		// return resp.make
-		return resp.MakeArrayResponse(nil)
+	sets, errResp := getSets(db, keys)
+	if errResp != nil {
+		return errResp
+	}
+	res := operation(sets...)
+	db.Remove(destination)
+	if res.Len() > 0 {
+		db.Dataset.Put(destination, res)
 	}
+	return resp.MakeNumberResponse(int64(res.Len()))
+}
 
-	members := setValue.Members()
-	simpleResponses := make([]response.Response, len(members))
+func makeSetMembersResponse(s *set.Set) response.Response {
+	members := s.Members()
+	memberResponses := make([]response.Response, len(members))
 	for i := 0; i < len(members); i++ {
-		simpleResponses[i] = resp.MakeSimpleResponse(string(members[i]))
+		memberResponses[i] = resp.MakeBulkResponse(members[i])
 	}
-	return resp.MakeArrayResponse(simpleResponses)
+	return resp.MakeSetResponse(memberResponses)
 }
 
-//如果 key 不存在，会新建一个 set
-func getSetOrInitSet(conn conn.Conn, db *redis.RedisDB, key string) *set.Set {
-	s := getSet(conn, db, key)
-	if s == nil {
-		return set.MakeSet(size)
+// 获取多个 key 对应的 set，不存在的 key 返回空 set，有 key 不是 set 类型时返回 WRONGTYPE 错误
+func getSets(db *redis.RedisDB, keys []string) ([]*set.Set, response.Response) {
+	sets := make([]*set.Set, len(keys))
+	for i, key := range keys {
+		s, errResp := getSet(db, key)
+		if errResp != nil {
+			return nil, errResp
+		}
+		if s == nil {
+			s = set.MakeSet(config.Config.SetMaxIntsetEntries)
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// key 不存在时返回 nil，key 不是 set 类型时返回 WRONGTYPE 错误
+func getSet(db *redis.RedisDB, key string) (*set.Set, response.Response) {
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return nil, nil
+	}
+	s, ok := v.(*set.Set)
+	if !ok {
+		return nil, resp.MakeErrorResponse(rediserr.WRONG_TYPE_ERROR.Error())
 	}
-	return s
+	return s, nil
 }
 
-func getSet(conn conn.Conn, db *redis.RedisDB, key string) *set.Set {
-	d, exist := db.Dataset.Get(key)
-	if exist {
-		setValue := d.(*set.Set)
-		return setValue
+func removeSetIfEmpty(db *redis.RedisDB, key string, s *set.Set) {
+	if s.Len() == 0 {
+		db.Remove(key)
 	}
-	return nil
 }
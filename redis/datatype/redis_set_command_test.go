@@ -1,14 +1,19 @@
 package datatype
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/helper"
 	"github.com/chenjiayao/goredistraning/lib/set"
 	"github.com/chenjiayao/goredistraning/redis"
 )
 
 func TestExecSadd(t *testing.T) {
+	config.LoadDefaultConfig()
 	db := redis.NewDBInstance(0)
 
 	insertValue := [][]byte{
@@ -27,6 +32,7 @@ func TestExecSadd(t *testing.T) {
 	vals := setValue.Members()
 
 	ss := helper.BbyteToSString(vals)
+	sort.Strings(ss) //set 是无序的
 	if ss[0] != "value1" {
 		t.Errorf("ss[0] = %s, want = %s", ss[0], "value1")
 	}
@@ -39,3 +45,125 @@ func TestExecSadd(t *testing.T) {
 		t.Errorf("ss[0] = %s, want = %s", ss[2], "value3")
 	}
 }
+
+func TestSetAddRemove(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SADD s a b c", ":3\r\n"},
+		{"SADD s a d", ":1\r\n"},
+		{"SREM s a x", ":1\r\n"},
+		{"SCARD s", ":3\r\n"},
+		{"SCARD missing", ":0\r\n"},
+		{"SISMEMBER s b", ":1\r\n"},
+		{"SISMEMBER s s", ":0\r\n"},
+		{"SMISMEMBER s b x d", "*3\r\n:1\r\n:0\r\n:1\r\n"},
+		{"SMISMEMBER missing b", "*1\r\n:0\r\n"},
+		{"SMEMBERS missing", "*0\r\n"},
+		{"SREM s b c d", ":3\r\n"},
+		{"SADD s", "-ERR wrong number of arguments for 'sadd' command\r\n"},
+		{"SET string value", "+OK\r\n"},
+		{"SADD string a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"SISMEMBER string a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+
+	if _, exist := db.Dataset.Get("s"); exist {
+		t.Errorf("empty set should be removed")
+	}
+}
+
+func TestSetPopAndRandom(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SADD s a", ":1\r\n"},
+		{"SRANDMEMBER s", "$1\r\na\r\n"},
+		{"SRANDMEMBER s 5", "*1\r\n$1\r\na\r\n"},
+		{"SRANDMEMBER s -3", "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\na\r\n"},
+		{"SRANDMEMBER s 0", "*0\r\n"},
+		{"SRANDMEMBER missing", "$-1\r\n"},
+		{"SRANDMEMBER s x", "-ERR value is not an integer or out of range\r\n"},
+		{"SPOP s", "$1\r\na\r\n"},
+		{"SPOP s", "$-1\r\n"},
+		{"SPOP s 2", "*0\r\n"},
+		{"SPOP s -1", "-ERR value is out of range, must be positive\r\n"},
+		{"SADD s a b c", ":3\r\n"},
+		{"SCARD s", ":3\r\n"},
+	})
+
+	res := execCmd(db, "SPOP s 2")
+	if !strings.HasPrefix(res, "*2\r\n") {
+		t.Errorf("SPOP s 2 = %q", res)
+	}
+	if res := execCmd(db, "SCARD s"); res != ":1\r\n" {
+		t.Errorf("SCARD after SPOP = %q", res)
+	}
+	execCmd(db, "SPOP s 10")
+	if _, exist := db.Dataset.Get("s"); exist {
+		t.Errorf("empty set should be removed")
+	}
+}
+
+func TestSetMoveAndOperations(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SADD s1 a b c d", ":4\r\n"},
+		{"SADD s2 c d e", ":3\r\n"},
+		{"SADD s3 d", ":1\r\n"},
+		{"SINTER s1 s2 s3", "*1\r\n$1\r\nd\r\n"},
+		{"SINTER s1 missing", "*0\r\n"},
+		{"SDIFF s2 s1", "*1\r\n$1\r\ne\r\n"},
+		{"SUNION s3 missing", "*1\r\n$1\r\nd\r\n"},
+		{"SINTERSTORE dst s1 s2", ":2\r\n"},
+		{"SISMEMBER dst c", ":1\r\n"},
+		{"SDIFFSTORE dst s1 s2", ":2\r\n"},
+		{"SISMEMBER dst a", ":1\r\n"},
+		{"SUNIONSTORE dst s1 s2", ":5\r\n"},
+		{"SET ttl x", "+OK\r\n"},
+		{"EXPIRE ttl 1000", ":1\r\n"},
+		{"SUNIONSTORE ttl s1", ":4\r\n"},
+		{"TTL ttl", ":-1\r\n"},
+		{"SINTERSTORE dst s1 missing", ":0\r\n"},
+		{"SCARD dst", ":0\r\n"},
+		{"SINTERCARD 2 s1 s2", ":2\r\n"},
+		{"SINTERCARD 2 s1 s2 LIMIT 1", ":1\r\n"},
+		{"SINTERCARD 0 s1", "-ERR numkeys should be greater than 0\r\n"},
+		{"SINTERCARD 3 s1 s2", "-ERR Number of keys can't be greater than number of args\r\n"},
+		{"SINTERCARD 1 s1 LIMIT -1", "-ERR LIMIT can't be negative\r\n"},
+		{"SMOVE s1 s3 a", ":1\r\n"},
+		{"SMOVE s1 s3 a", ":0\r\n"},
+		{"SMOVE s1 new b", ":1\r\n"},
+		{"SISMEMBER new b", ":1\r\n"},
+		{"SCARD s1", ":2\r\n"},
+		{"SET string value", "+OK\r\n"},
+		{"SMOVE s1 string c", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"SUNION s1 string", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+}
+
+func TestSetScan(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SSCAN missing 0", "*2\r\n$1\r\n0\r\n*0\r\n"},
+		//intset 编码一次返回所有的 member
+		{"SADD ints 3 1 2", ":3\r\n"},
+		{"SSCAN ints 0 COUNT 1", "*2\r\n$1\r\n0\r\n*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+	})
+
+	for i := 0; i < 50; i++ {
+		execCmd(db, fmt.Sprintf("SADD s m%d", i))
+	}
+	members := scanAll(t, db, "SSCAN s %d COUNT 5")
+	unique := make(map[string]struct{})
+	for _, member := range members {
+		unique[member] = struct{}{}
+	}
+	if len(members) != 50 || len(unique) != 50 {
+		t.Errorf("SSCAN returned %d members, %d unique, want 50", len(members), len(unique))
+	}
+	if members := scanAll(t, db, "SSCAN s %d MATCH m4*"); len(members) != 11 {
+		t.Errorf("SSCAN MATCH m4* returned %v", members)
+	}
+}
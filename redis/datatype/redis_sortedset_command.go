@@ -0,0 +1,503 @@
+package datatype
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/skiplist"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+	"github.com/chenjiayao/goredistraning/redis/validate"
+)
+
+/**
+ZADD
+ZSCORE
+ZINCRBY
+ZRANK
+ZREVRANK
+ZCOUNT
+ZCARD
+ZRANGE
+ZREVRANGE
+ZRANGEBYSCORE
+ZREVRANGEBYSCORE
+ZREM
+ZREMRANGEBYSCORE
+ZREMRANGEBYRANK
+ZREMRANGEBYLEX
+ZSCAN
+*/
+func init() {
+	redis.RegisterExecCommand(redis.Zadd, ExecZAdd, validate.ValidateZAdd)
+	redis.RegisterExecCommand(redis.Zscore, ExecZScore, validate.ValidateZScore)
+	redis.RegisterExecCommand(redis.Zincrby, ExecZIncrBy, validate.ValidateZIncrBy)
+	redis.RegisterExecCommand(redis.Zrank, ExecZRank, validate.ValidateZRank)
+	redis.RegisterExecCommand(redis.Zrevrank, ExecZRevRank, validate.ValidateZRevRank)
+	redis.RegisterExecCommand(redis.Zcount, ExecZCount, validate.ValidateZCount)
+	redis.RegisterExecCommand(redis.Zcard, ExecZCard, validate.ValidateZCard)
+	redis.RegisterExecCommand(redis.Zrange, ExecZRange, validate.ValidateZRange)
+	redis.RegisterExecCommand(redis.Zrevrange, ExecZRevRange, validate.ValidateZRevRange)
+	redis.RegisterExecCommand(redis.Zrangebyscore, ExecZRangeByScore, validate.ValidateZRangeByScore)
+	redis.RegisterExecCommand(redis.Zrevrangebyscore, ExecZRevRangeByScore, validate.ValidateZRevRangeByScore)
+	redis.RegisterExecCommand(redis.Zrem, ExecZRem, validate.ValidateZRem)
+	redis.RegisterExecCommand(redis.Zremrangebyscore, ExecZRemRangeByScore, validate.ValidateZRemRangeByScore)
+	redis.RegisterExecCommand(redis.Zremrangebyrank, ExecZRemRangeByRank, validate.ValidateZRemRangeByRank)
+	redis.RegisterExecCommand(redis.Zremrangebylex, ExecZRemRangeByLex, validate.ValidateZRemRangeByLex)
+	redis.RegisterExecCommand(redis.Zscan, ExecZScan, validate.ValidateZScan)
+}
+
+// zadd key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+// 1. NX：只添加新的 member；XX：只更新已经存在的 member
+// 2. GT/LT：只有新的 score 比原来的大/小时才更新，不影响新增 member
+// 3. CH：返回新增和 score 被修改的 member 个数，默认只返回新增的个数
+// 4. INCR：和 zincrby 一样，返回新的 score，操作被 NX/XX/GT/LT 阻止时返回 nil
+func ExecZAdd(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	options := make(map[string]bool)
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option != "nx" && option != "xx" && option != "gt" && option != "lt" && option != "ch" && option != "incr" {
+			break
+		}
+		options[option] = true
+	}
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getOrCreateSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	defer removeSortedSetIfEmpty(db, key, z)
+
+	var added, changed int64
+	var score float64
+	applied := false // INCR 的 score 和 member 是否被写入
+	for ; i < len(args); i += 2 {
+		score, _ = strconv.ParseFloat(string(args[i]), 64)
+		member := string(args[i+1])
+
+		current, exist := z.Score(member)
+		if !exist {
+			if options["xx"] {
+				continue
+			}
+			z.Add(member, score)
+			added++
+			applied = true
+			continue
+		}
+
+		if options["nx"] {
+			continue
+		}
+		if options["incr"] {
+			score += current
+			if math.IsNaN(score) {
+				return resp.MakeErrorResponse("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if (options["gt"] && score <= current) || (options["lt"] && score >= current) {
+			continue
+		}
+		applied = true
+		if score != current {
+			z.Add(member, score)
+			changed++
+		}
+	}
+
+	if options["incr"] {
+		if !applied {
+			return resp.NullBulkResponse
+		}
+		return resp.MakeDoubleResponse(score)
+	}
+	if options["ch"] {
+		return resp.MakeNumberResponse(added + changed)
+	}
+	return resp.MakeNumberResponse(added)
+}
+
+func ExecZScore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.NullBulkResponse
+	}
+	score, ok := z.Score(string(args[1]))
+	if !ok {
+		return resp.NullBulkResponse
+	}
+	return resp.MakeDoubleResponse(score)
+}
+
+// zincrby key increment member，member 不存在时当成 0
+func ExecZIncrBy(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	increment, _ := strconv.ParseFloat(string(args[1]), 64)
+	member := string(args[2])
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getOrCreateSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	current, _ := z.Score(member)
+	score := current + increment
+	if math.IsNaN(score) {
+		removeSortedSetIfEmpty(db, key, z)
+		return resp.MakeErrorResponse("ERR resulting score is not a number (NaN)")
+	}
+	z.Add(member, score)
+	return resp.MakeDoubleResponse(score)
+}
+
+func ExecZRank(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return zrank(db, args, false)
+}
+
+func ExecZRevRank(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return zrank(db, args, true)
+}
+
+func zrank(db *redis.RedisDB, args [][]byte, reverse bool) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.NullBulkResponse
+	}
+	rank, ok := z.Rank(string(args[1]), reverse)
+	if !ok {
+		return resp.NullBulkResponse
+	}
+	return resp.MakeNumberResponse(rank)
+}
+
+// zcount key min max
+func ExecZCount(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	min, _ := skiplist.ParseScoreBorder(string(args[1]))
+	max, _ := skiplist.ParseScoreBorder(string(args[2]))
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(z.Count(min, max))
+}
+
+func ExecZCard(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	return resp.MakeNumberResponse(z.Len())
+}
+
+// zrange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+// 有 REV 参数时，BYSCORE 和 BYLEX 的 start 是 max，stop 是 min
+func ExecZRange(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	start, stop := string(args[1]), string(args[2])
+	by := ""
+	reverse := false
+	withScores := false
+	offset, limit := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); option {
+		case "byscore", "bylex":
+			by = option
+		case "rev":
+			reverse = true
+		case "withscores":
+			withScores = true
+		case "limit":
+			offset, _ = strconv.ParseInt(string(args[i+1]), 10, 64)
+			limit, _ = strconv.ParseInt(string(args[i+2]), 10, 64)
+			i += 2
+		}
+	}
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil || offset < 0 {
+		return resp.MakeMultiResponse([][]byte{})
+	}
+
+	var elements []skiplist.Element
+	switch by {
+	case "byscore":
+		min, max := parseScoreRange(start, stop, reverse)
+		elements = z.Range(min, max, offset, limit, reverse)
+	case "bylex":
+		min, max := parseLexRange(start, stop, reverse)
+		elements = z.Range(min, max, offset, limit, reverse)
+	default:
+		startIndex, _ := strconv.ParseInt(start, 10, 64)
+		stopIndex, _ := strconv.ParseInt(stop, 10, 64)
+		startIndex, stopIndex, ok := normalizeRankRange(startIndex, stopIndex, z.Len())
+		if !ok {
+			return resp.MakeMultiResponse([][]byte{})
+		}
+		elements = z.RangeByRank(startIndex, stopIndex, reverse)
+	}
+	return makeElementsResponse(conn, elements, withScores)
+}
+
+// zrevrange key start stop [WITHSCORES] ---> zrange key start stop REV [WITHSCORES]
+func ExecZRevRange(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return ExecZRange(conn, db, appendArgs(args, "rev"))
+}
+
+// zrangebyscore key min max [WITHSCORES] [LIMIT offset count] ---> zrange key min max BYSCORE ...
+func ExecZRangeByScore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return ExecZRange(conn, db, appendArgs(args, "byscore"))
+}
+
+// zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count] ---> zrange key max min BYSCORE REV ...
+func ExecZRevRangeByScore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	return ExecZRange(conn, db, appendArgs(args, "byscore", "rev"))
+}
+
+func appendArgs(args [][]byte, extra ...string) [][]byte {
+	res := make([][]byte, 0, len(args)+len(extra))
+	res = append(res, args...)
+	for _, arg := range extra {
+		res = append(res, []byte(arg))
+	}
+	return res
+}
+
+// zrem key member [member ...]，返回删除的 member 个数
+func ExecZRem(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		if z.Remove(string(member)) {
+			removed++
+		}
+	}
+	removeSortedSetIfEmpty(db, key, z)
+	return resp.MakeNumberResponse(removed)
+}
+
+// zremrangebyscore key min max
+func ExecZRemRangeByScore(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	min, max := parseScoreRange(string(args[1]), string(args[2]), false)
+	return zremRange(db, string(args[0]), func(z *sortedset.SortedSet) int64 {
+		return z.RemoveRange(min, max)
+	})
+}
+
+// zremrangebylex key min max
+func ExecZRemRangeByLex(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	min, max := parseLexRange(string(args[1]), string(args[2]), false)
+	return zremRange(db, string(args[0]), func(z *sortedset.SortedSet) int64 {
+		return z.RemoveRange(min, max)
+	})
+}
+
+// zremrangebyrank key start stop
+func ExecZRemRangeByRank(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	start, _ := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, _ := strconv.ParseInt(string(args[2]), 10, 64)
+	return zremRange(db, string(args[0]), func(z *sortedset.SortedSet) int64 {
+		start, stop, ok := normalizeRankRange(start, stop, z.Len())
+		if !ok {
+			return 0
+		}
+		return z.RemoveRangeByRank(start, stop)
+	})
+}
+
+func zremRange(db *redis.RedisDB, key string, remove func(z *sortedset.SortedSet) int64) response.Response {
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return resp.MakeNumberResponse(0)
+	}
+	removed := remove(z)
+	removeSortedSetIfEmpty(db, key, z)
+	return resp.MakeNumberResponse(removed)
+}
+
+// 参数已经校验过了，reverse 为 true 时 start 是 max，stop 是 min
+func parseScoreRange(start, stop string, reverse bool) (skiplist.ScoreBorder, skiplist.ScoreBorder) {
+	if reverse {
+		start, stop = stop, start
+	}
+	min, _ := skiplist.ParseScoreBorder(start)
+	max, _ := skiplist.ParseScoreBorder(stop)
+	return min, max
+}
+
+func parseLexRange(start, stop string, reverse bool) (skiplist.LexBorder, skiplist.LexBorder) {
+	if reverse {
+		start, stop = stop, start
+	}
+	min, _ := skiplist.ParseLexBorder(start)
+	max, _ := skiplist.ParseLexBorder(stop)
+	return min, max
+}
+
+// 负数排名从尾部开始计算，超出范围的部分截掉，范围为空时返回 false
+func normalizeRankRange(start, stop, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// WITHSCORES 时，RESP2 返回 member 和 score 交替排列的数组，RESP3 中每一对 member 和 score 是一个数组
+func makeElementsResponse(conn conn.Conn, elements []skiplist.Element, withScores bool) response.Response {
+	if !withScores {
+		members := make([][]byte, len(elements))
+		for i, e := range elements {
+			members[i] = []byte(e.Member)
+		}
+		return resp.MakeMultiResponse(members)
+	}
+
+	if conn.GetProtocol() == resp.RESP3 {
+		pairs := make([]response.Response, len(elements))
+		for i, e := range elements {
+			pairs[i] = resp.MakeArrayResponse([]response.Response{
+				resp.MakeBulkResponse([]byte(e.Member)),
+				resp.MakeDoubleResponse(e.Score),
+			})
+		}
+		return resp.MakeArrayResponse(pairs)
+	}
+	items := make([][]byte, 0, len(elements)*2)
+	for _, e := range elements {
+		items = append(items, []byte(e.Member), []byte(resp.FormatFloat(e.Score)))
+	}
+	return resp.MakeMultiResponse(items)
+}
+
+// zscan key cursor [MATCH pattern] [COUNT count]
+// 返回 member 和 score 交替排列的数组
+func ExecZScan(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
+	options := parseScanOptions(args[1:])
+
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return makeScanResponse(0, [][]byte{})
+	}
+
+	members, next := z.Scan(options.cursor, options.count)
+	items := make([][]byte, 0, 2*len(members))
+	for _, member := range members {
+		if !options.match(member) {
+			continue
+		}
+		score, _ := z.Score(member)
+		items = append(items, []byte(member), []byte(resp.FormatFloat(score)))
+	}
+	return makeScanResponse(next, items)
+}
+
+// key 不存在时返回 nil，key 不是 sorted set 类型时返回 WRONGTYPE 错误
+func getSortedSet(db *redis.RedisDB, key string) (*sortedset.SortedSet, response.Response) {
+	v, exist := db.Dataset.Get(key)
+	if !exist {
+		return nil, nil
+	}
+	z, ok := v.(*sortedset.SortedSet)
+	if !ok {
+		return nil, resp.MakeErrorResponse(rediserr.WRONG_TYPE_ERROR.Error())
+	}
+	return z, nil
+}
+
+// key 不存在时创建一个空的 sorted set，调用方在没有写入 member 的时候需要调用 removeSortedSetIfEmpty
+func getOrCreateSortedSet(db *redis.RedisDB, key string) (*sortedset.SortedSet, response.Response) {
+	z, errResp := getSortedSet(db, key)
+	if errResp != nil || z != nil {
+		return z, errResp
+	}
+	z = sortedset.MakeSortedSet()
+	db.Dataset.Put(key, z)
+	return z, nil
+}
+
+func removeSortedSetIfEmpty(db *redis.RedisDB, key string, z *sortedset.SortedSet) {
+	if z.Len() == 0 {
+		db.Remove(key)
+	}
+}
@@ -0,0 +1,133 @@
+package datatype
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+func TestSortedSetAdd(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"ZADD z 1 a 2 b", ":2\r\n"},
+		{"ZADD z NX 5 a 3 c", ":1\r\n"},
+		{"ZADD z XX 4 d", ":0\r\n"},
+		{"ZADD z XX CH 1.5 a", ":1\r\n"},
+		{"ZADD z GT CH 1 a 5 b", ":1\r\n"},
+		{"ZADD z LT 9 c", ":0\r\n"},
+		{"ZSCORE z a", "$3\r\n1.5\r\n"},
+		{"ZSCORE z b", "$1\r\n5\r\n"},
+		{"ZSCORE z x", "$-1\r\n"},
+		{"ZADD z INCR 2 a", "$3\r\n3.5\r\n"},
+		{"ZADD z NX INCR 2 a", "$-1\r\n"},
+		{"ZINCRBY z -0.5 a", "$1\r\n3\r\n"},
+		{"ZINCRBY z 1 new", "$1\r\n1\r\n"},
+		{"ZCARD z", ":4\r\n"},
+		{"ZCARD missing", ":0\r\n"},
+		{"ZADD z", "-ERR wrong number of arguments for 'zadd' command\r\n"},
+		{"ZADD z 1 a 2", "-ERR syntax error\r\n"},
+		{"ZADD z x a", "-ERR value is not a valid float\r\n"},
+		{"ZADD z NX XX 1 a", "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{"ZADD z GT LT 1 a", "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{"ZADD z INCR 1 a 2 b", "-ERR INCR option supports a single increment-element pair\r\n"},
+		{"SET string value", "+OK\r\n"},
+		{"ZADD string 1 a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+}
+
+func TestSortedSetRankAndRange(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"ZADD z 1 a 2 b 3 c 4 d", ":4\r\n"},
+		{"ZRANK z c", ":2\r\n"},
+		{"ZREVRANK z c", ":1\r\n"},
+		{"ZRANK z x", "$-1\r\n"},
+		{"ZCOUNT z (1 3", ":2\r\n"},
+		{"ZCOUNT z -inf +inf", ":4\r\n"},
+		{"ZCOUNT z x 3", "-ERR min or max is not a float\r\n"},
+		{"ZRANGE z 0 -1", "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"ZRANGE z -2 10 WITHSCORES", "*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$1\r\n4\r\n"},
+		{"ZRANGE z 0 1 REV", "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{"ZRANGE z 3 1", "*0\r\n"},
+		{"ZREVRANGE z 0 0 WITHSCORES", "*2\r\n$1\r\nd\r\n$1\r\n4\r\n"},
+		{"ZRANGE z (1 3 BYSCORE", "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"ZRANGE z +inf -inf BYSCORE REV LIMIT 1 2", "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{"ZRANGEBYSCORE z 2 +inf LIMIT 1 -1", "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"ZREVRANGEBYSCORE z 3 (1 WITHSCORES", "*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{"ZRANGE z 0 1 LIMIT 0 1", "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{"ZRANGE missing 0 -1", "*0\r\n"},
+	})
+}
+
+func TestSortedSetLex(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"ZADD z 0 a 0 b 0 c 0 d 0 e", ":5\r\n"},
+		{"ZRANGE z [b (d BYLEX", "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"ZRANGE z + - BYLEX REV LIMIT 0 2", "*2\r\n$1\r\ne\r\n$1\r\nd\r\n"},
+		{"ZRANGE z - + BYLEX WITHSCORES", "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+		{"ZRANGE z b d BYLEX", "-ERR min or max not valid string range item\r\n"},
+		{"ZREMRANGEBYLEX z (a [c", ":2\r\n"},
+		{"ZRANGE z 0 -1", "*3\r\n$1\r\na\r\n$1\r\nd\r\n$1\r\ne\r\n"},
+	})
+}
+
+func TestSortedSetRemove(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"ZADD z 1 a 2 b 3 c 4 d 5 e 6 f", ":6\r\n"},
+		{"ZREM z a x", ":1\r\n"},
+		{"ZREMRANGEBYSCORE z (2 3", ":1\r\n"},
+		{"ZREMRANGEBYRANK z -2 -1", ":2\r\n"},
+		{"ZREMRANGEBYRANK z 5 10", ":0\r\n"},
+		{"ZRANGE z 0 -1", "*2\r\n$1\r\nb\r\n$1\r\nd\r\n"},
+		{"ZREMRANGEBYRANK z 0 -1", ":2\r\n"},
+		{"ZCARD z", ":0\r\n"},
+	})
+
+	if _, exist := db.Dataset.Get("z"); exist {
+		t.Errorf("empty sorted set should be removed")
+	}
+
+	execCmd(db, "ZADD z 1.5 a")
+	conn := redis.MakeRedisConn(nil)
+	conn.SetProtocol(resp.RESP3)
+	res := db.Exec(conn, redis.Zrange, [][]byte{[]byte("z"), []byte("0"), []byte("-1"), []byte("WITHSCORES")})
+	if got := string(resp.Encode(res, resp.RESP3)); got != "*1\r\n*2\r\n$1\r\na\r\n,1.5\r\n" {
+		t.Errorf("ZRANGE WITHSCORES in RESP3 = %q", got)
+	}
+}
+
+func TestSortedSetScan(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"ZSCAN missing 0", "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{"ZADD z 1.5 a", ":1\r\n"},
+		{"ZSCAN z 0", "*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$3\r\n1.5\r\n"},
+		{"ZSCAN z 0 COUNT 0", "-ERR syntax error\r\n"},
+		{"ZSCAN z", "-ERR wrong number of arguments for 'zscan' command\r\n"},
+		{"SET s v", "+OK\r\n"},
+		{"ZSCAN s 0", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	})
+
+	for i := 0; i < 30; i++ {
+		execCmd(db, fmt.Sprintf("ZADD big %d m%d", i, i))
+	}
+	items := scanAll(t, db, "ZSCAN big %d COUNT 4")
+	if len(items) != 60 {
+		t.Fatalf("ZSCAN returned %d items, want 60", len(items))
+	}
+	for i := 0; i < len(items); i += 2 {
+		if "m"+items[i+1] != items[i] {
+			t.Errorf("ZSCAN returned member %s with score %s", items[i], items[i+1])
+		}
+	}
+}
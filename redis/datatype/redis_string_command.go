@@ -2,10 +2,11 @@ package datatype
 
 import (
 	"fmt"
-	"sort"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/chenjiayao/goredistraning/helper"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/interface/response"
 	"github.com/chenjiayao/goredistraning/redis"
@@ -56,15 +57,17 @@ func ExecMSet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respons
 	return resp.OKSimpleResponse
 }
 
+// key 不存在或者不是 string 类型时，对应的元素返回 nil
 func ExecMGet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 
-	res := make([][]byte, 0)
+	res := make([][]byte, 0, len(args))
 	for i := 0; i < len(args); i++ {
-		r := getAsString(conn, db, args[i])
-		if r == "" {
+		v, exist := db.Dataset.Get(string(args[i]))
+		s, ok := v.(string)
+		if !exist || !ok {
 			res = append(res, nil)
 		} else {
-			res = append(res, []byte(r))
+			res = append(res, []byte(s))
 		}
 	}
 	return resp.MakeMultiResponse(res)
@@ -72,33 +75,27 @@ func ExecMGet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respons
 
 func ExecMSetNX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 
-	//  这里加锁之前应该对 args 按照字母顺序排序， 保证每个goroutine 的 keys 加锁顺序一致，不然会导致死锁
+	//  LockKeys 会对 key 排序之后再加锁， 保证每个goroutine 的 keys 加锁顺序一致，不然会导致死锁
 	allKeys := make([]string, 0)
 	for i := 0; i < len(args); i += 2 {
 		allKeys = append(allKeys, string(args[i]))
 	}
-	sort.Slice(allKeys, func(i, j int) bool { return i < j })
-
-	//对所有的 key 加锁
-	for i := 0; i < len(allKeys); i++ {
-		key := allKeys[i]
-		db.LockKey(key)
-		defer db.UnLockKey(key)
-	}
+	db.LockKeys(allKeys...)
+	defer db.UnLockKeys(allKeys...)
 
 	//检查是否有哪个 key 已经存在
-	for i := 0; i < len(args); i += 2 {
-		s := getAsString(conn, db, args[i])
-		if s != "" {
+	for _, key := range allKeys {
+		if _, exist := db.Dataset.Get(key); exist {
 			return resp.MakeNumberResponse(0)
 		}
 	}
 
-	for i := 0; i < len(args); i++ {
-		ExecSet(conn, db, [][]byte{
+	//已经持有所有 key 的锁，不能再调用 ExecSet 加锁
+	for i := 0; i < len(args); i += 2 {
+		execSet(conn, db, [][]byte{
 			args[i],
 			args[i+1],
-		})
+		}, redis.Set)
 	}
 	return resp.MakeNumberResponse(1)
 }
@@ -112,7 +109,7 @@ func ExecGetset(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respo
 	i, exists := db.Dataset.Get(key)
 
 	if !exists {
-		return resp.NullMultiResponse
+		return resp.NullBulkResponse
 	}
 
 	res, ok := i.(string)
@@ -120,71 +117,72 @@ func ExecGetset(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respo
 		return resp.MakeErrorResponse("WRONGTYPE Operation against a key holding the wrong kind of value")
 	}
 
+	//和 set 一样清除 key 原来的过期时间
 	db.Dataset.PutIfExist(key, string(args[1]))
-	return resp.MakeSimpleResponse(res)
+	db.TtlMap.Del(key)
+	return resp.MakeBulkResponse([]byte(res))
 }
 
 // key value [EX seconds] [PX milliseconds] [NX|XX]
 // NX -- Only set the key if it does not already exist.
 // XX -- Only set the key if it already exist.   --->同时覆盖新的 ttl
+// 没有 EX、PX 的时候会清除 key 原来的过期时间
+// 带过期时间的 set 在 aof 中记录成 set + pexpireat，重放的时候不会延长过期时间
 func ExecSet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	key := string(args[0])
 
-	ttl := UnlimitTTL
-	ttls := fmt.Sprintf("%d", ttl)
+	//NX、XX 的检查和写入需要在同一个锁里面，否则两个并发的 set nx 可能都会成功
+	db.LockKey(key)
+	defer db.UnLockKey(key)
 
-	ss := helper.BbyteToSString(args)
-	exFlagIndex := helper.ContainWithoutCaseSensitive(ss, "EX")
-	if exFlagIndex != -1 {
-		ttlStr := string(args[exFlagIndex+1])
-		ttli, _ := strconv.ParseInt(ttlStr, 10, 64)
-		ttls = fmt.Sprintf("%d", ttli*1000)
-	}
+	return execSet(conn, db, args, redis.Set)
+}
 
-	pxFlagIndex := helper.ContainWithoutCaseSensitive(ss, "PX")
-	if pxFlagIndex != -1 {
-		ttls = string(args[pxFlagIndex+1])
-	}
+// 调用方需要持有 key 的锁，cmdName 用于错误信息
+func execSet(conn conn.Conn, db *redis.RedisDB, args [][]byte, cmdName string) response.Response {
 
 	key := string(args[0])
 	value := string(args[1])
 
-	//不存在 key 就 insert
-	if helper.ContainWithoutCaseSensitive(ss, "NX") != -1 {
-		ok := db.Dataset.PutIfNotExist(key, value)
-		if ok {
-			SetKeyTTL(conn, db, [][]byte{
-				args[0],
-				[]byte(ttls),
-			})
-		} else {
-			return resp.NullMultiResponse
+	now := time.Now().UnixMilli()
+	expiredAt := UnlimitTTL
+	nx, xx := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "ex":
+			seconds, _ := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if seconds > (math.MaxInt64-now)/1000 {
+				return resp.MakeErrorResponse(fmt.Sprintf("ERR invalid expire time in '%s' command", cmdName))
+			}
+			expiredAt = now + seconds*1000
+			i++
+		case "px":
+			milliseconds, _ := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if milliseconds > math.MaxInt64-now {
+				return resp.MakeErrorResponse(fmt.Sprintf("ERR invalid expire time in '%s' command", cmdName))
+			}
+			expiredAt = now + milliseconds
+			i++
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
 		}
 	}
 
-	//不存在key就 insert
-	if helper.ContainWithoutCaseSensitive(ss, "XX") != -1 {
-		ok := db.Dataset.PutIfExist(key, value)
-		if ok {
-			SetKeyTTL(conn, db, [][]byte{
-				args[0],
-				[]byte(ttls),
-			})
-			return resp.OKSimpleResponse
-		} else {
-			return resp.NullMultiResponse
-		}
+	_, exist := db.Dataset.Get(key)
+	if (nx && exist) || (xx && !exist) {
+		return resp.NullMultiResponse
 	}
 
-	ok := db.Dataset.Put(key, value)
-
-	if ok {
-		ExecTTL(conn, db, [][]byte{
-			args[0],
-			[]byte(ttls),
-		})
+	db.Dataset.Put(key, value)
+	if expiredAt == UnlimitTTL {
+		db.TtlMap.Del(key)
 		return resp.OKSimpleResponse
 	}
-	return resp.NullMultiResponse
+	db.TtlMap.Put(key, expiredAt)
+	propagate(conn, [][]byte{[]byte(redis.Set), args[0], args[1]}, makePExpireAtCmd(args[0], expiredAt))
+	return resp.OKSimpleResponse
 }
 
 // setnx key value ---> set key value nx
@@ -201,7 +199,11 @@ func ExecSetEX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respon
 		[]byte("ex"),
 		args[1],
 	}
-	return ExecSet(conn, db, setArgs)
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	return execSet(conn, db, setArgs, redis.Setex)
 }
 
 // psetex key milliseconds value --> set key value px milliseconds
@@ -212,7 +214,11 @@ func ExecPSetEX(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respo
 		[]byte("px"),
 		args[1],
 	}
-	return ExecSet(conn, db, setArgs)
+	key := string(args[0])
+	db.LockKey(key)
+	defer db.UnLockKey(key)
+
+	return execSet(conn, db, setArgs, redis.Psetex)
 }
 
 /**
@@ -220,20 +226,18 @@ get 执行之前要考虑 redis 的过期策略
 	redis 的过期策略分为两种方式
 		1. 定期删除：每次间隔一定时间再 ttlDict 中扫描，清除过期的 key
 		2. 惰性删除：访问一个 key 之前，判断是否已经过期，如果已经过期那么直接删除，并且返回 null
+	两种方式都在 redis 包中实现（见 redis_expire.go），执行到这里时过期的 key 已经被删除了
 */
 func ExecGet(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
-
-	//key 不存在，或者已经到过期时间了
-	if ExecTTL(conn, db, [][]byte{args[0]}) < -1 {
-		// TODO 删除 key
-		return resp.NullMultiResponse
+	v, exist := db.Dataset.Get(string(args[0]))
+	if !exist {
+		return resp.NullBulkResponse
 	}
-
-	s := getAsString(conn, db, args[0])
-	if s == "" {
-		return resp.NullMultiResponse
+	s, ok := v.(string)
+	if !ok {
+		return resp.MakeErrorResponse("WRONGTYPE Operation against a key holding the wrong kind of value")
 	}
-	return resp.MakeSimpleResponse(s)
+	return resp.MakeBulkResponse([]byte(s))
 }
 
 func getAsString(conn conn.Conn, db *redis.RedisDB, key []byte) string {
@@ -2,6 +2,7 @@ package datatype
 
 import (
 	"bytes"
+	"sync"
 	"testing"
 
 	"github.com/chenjiayao/goredistraning/lib/dict"
@@ -32,8 +33,8 @@ func TestExecSet(t *testing.T) {
 	}
 
 	ttl := ExecTTL(nil, db, [][]byte{[]byte("key")})
-	if ttl != -1 {
-		t.Errorf("set key  ttl = -1, but got = %d", ttl)
+	if string(ttl.ToContentByte()) != ":-1\r\n" {
+		t.Errorf("set key  ttl = -1, but got = %q", ttl.ToContentByte())
 	}
 }
 
@@ -48,7 +49,7 @@ func TestExecGet(t *testing.T) {
 		[]byte(key),
 	})
 
-	want := string(resp.MakeSimpleResponse("value").ToContentByte())
+	want := "$5\r\nvalue\r\n"
 	if !bytes.Equal(res.ToContentByte(), []byte(want)) {
 		t.Errorf("ExecGet = %s, want %s", string(res.ToContentByte()), want)
 	}
@@ -87,12 +88,77 @@ func TestExecGetset(t *testing.T) {
 		[]byte("key"),
 		[]byte(newValue),
 	})
-	want := resp.MakeSimpleResponse(value)
-	if string(string(want.ToContentByte())) != string(res.ToContentByte()) {
-		t.Errorf("execgetSet = %s, want = %s", string(res.ToContentByte()), "+value")
+	want := "$5\r\nvalue\r\n"
+	if want != string(res.ToContentByte()) {
+		t.Errorf("execgetSet = %q, want = %q", string(res.ToContentByte()), want)
 	}
 	s := getAsString(nil, db, []byte(key))
 	if newValue != s {
 		t.Errorf("execgetset store %s , but get %s", "newvalue", s)
 	}
 }
+
+func TestExecMGet(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	db.Dataset.Put("key1", "value1")
+	db.Dataset.Put("empty", "")
+
+	res := ExecMGet(nil, db, [][]byte{
+		[]byte("key1"),
+		[]byte("not-exist"),
+		[]byte("empty"),
+	})
+	want := "*3\r\n$6\r\nvalue1\r\n$-1\r\n$0\r\n\r\n"
+	if string(res.ToContentByte()) != want {
+		t.Errorf("ExecMGet = %q, want %q", string(res.ToContentByte()), want)
+	}
+}
+
+func TestExecMSetNX(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"MSETNX b 1 a 2", ":1\r\n"},
+		{"GET a", "$1\r\n2\r\n"},
+		{"SADD s x", ":1\r\n"},
+		{"MSETNX c 3 s 4", ":0\r\n"},
+		{"GET c", "$-1\r\n"},
+	})
+}
+
+// getset 会清除 key 原来的过期时间
+func TestExecGetsetClearTTL(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	runCmdCases(t, db, []cmdCase{
+		{"SET k v EX 100", "+OK\r\n"},
+		{"GETSET k v2", "$1\r\nv\r\n"},
+		{"TTL k", ":-1\r\n"},
+	})
+}
+
+// 并发的 setnx 只有一个能成功
+func TestExecSetNXConcurrent(t *testing.T) {
+	db := redis.NewDBInstance(0)
+	for round := 0; round < 100; round++ {
+		var wg sync.WaitGroup
+		results := make([]string, 8)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = execCmd(db, "SETNX k v")
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, res := range results {
+			if res == "+OK\r\n" {
+				succeeded++
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("%d concurrent SETNX succeeded, want 1", succeeded)
+		}
+		execCmd(db, "DEL k")
+	}
+}
@@ -15,6 +15,7 @@ func init() {
 	redis.RegisterExecCommand(redis.Discard, ExecDiscard, validate.ValidateDiscard)
 	redis.RegisterExecCommand(redis.Watch, ExecWatch, validate.ValidateWatch)
 	redis.RegisterExecCommand(redis.Exec, ExecExec, validate.ValidateExec)
+	redis.RegisterExecCommand(redis.Unwatch, ExecUnwatch, validate.ValidateUnwatch)
 
 }
 
@@ -23,33 +24,39 @@ func ExecMulti(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respon
 	return resp.OKSimpleResponse
 }
 
+// 放弃事务，同时取消 watch 的所有 key
 func ExecDiscard(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
 	conn.Discard()
-	db.RemoveAllWatchKey()
+	conn.Unwatch()
 	return resp.OKSimpleResponse
 }
 
+// 事务中有命令校验失败时返回 EXECABORT，watch 的 key 被修改时返回 nil，都不会执行事务中的命令
+// 不管事务是否执行，exec 之后都会清空事务中的命令并且取消 watch
+// 事务中某个命令执行失败时，其他命令照常执行，失败的命令在回复中对应的位置返回错误，和 redis 一致
 func ExecExec(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
-	db.RemoveAllWatchKey()
-	conn.SetMultiState(0)
-	if conn.GetDirtyCAS() {
-		return resp.NullMultiResponse
-	}
+	defer conn.Discard()
 
 	if conn.GetMultiState() == int(redis.InMultiStateButHaveError) {
+		conn.Unwatch()
 		return resp.MakeErrorResponse("EXECABORT Transaction discarded because of previous errors.")
 	}
+	if conn.GetDirtyCAS() {
+		conn.Unwatch()
+		return resp.NullArrayResponse
+	}
+	//开始执行之后事务中的命令修改 watch 的 key 不会影响事务
+	conn.Unwatch()
 
 	multiCmds := conn.GetMultiCmds()
 
+	//exec 中的阻塞命令不会阻塞
+	conn.SetMultiState(int(redis.InExecState))
+
 	responseContent := make([]response.Response, len(multiCmds))
 
 	for index, cmd := range multiCmds {
-		cmdResponse := db.Exec(conn, string(cmd[0]), cmd[1:])
-		if !cmdResponse.ISOK() {
-			return resp.MakeErrorResponse("EXECABORT Transaction discarded because of previous errors.")
-		}
-		responseContent[index] = cmdResponse
+		responseContent[index] = db.Exec(conn, string(cmd[0]), cmd[1:])
 	}
 	return resp.MakeArrayResponse(responseContent)
 }
@@ -58,6 +65,9 @@ func ExecExec(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respons
 // 不管是否已经执行 multi，watch 之后key 被修改，那么事务就不会被执行
 // exec 和 discard 执行之后， watch 的 key 被清空
 func ExecWatch(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	if conn.IsInMultiState() {
+		return resp.MakeErrorResponse("ERR WATCH inside MULTI is not allowed")
+	}
 	watchKeys := helper.BbyteToSString(args)
 	for i := 0; i < len(watchKeys); i++ {
 		watchKey := watchKeys[i]
@@ -66,7 +76,8 @@ func ExecWatch(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Respon
 	return resp.OKSimpleResponse
 }
 
-func ExecUnwatch(connn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
-	db.RemoveAllWatchKey()
+// 取消当前客户端 watch 的所有 key，不影响其他客户端
+func ExecUnwatch(conn conn.Conn, db *redis.RedisDB, args [][]byte) response.Response {
+	conn.Unwatch()
 	return resp.OKSimpleResponse
 }
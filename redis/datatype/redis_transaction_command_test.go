@@ -0,0 +1,207 @@
+package datatype
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+// 在同一个连接上执行命令，事务和 watch 的状态保存在连接中
+func execConnCmd(conn *redis.RedisConn, db *redis.RedisDB, cmdLine string) string {
+	fields := strings.Fields(cmdLine)
+	args := make([][]byte, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		args = append(args, []byte(field))
+	}
+
+	res := db.Exec(conn, strings.ToLower(fields[0]), args)
+	if !res.ISOK() {
+		return string(res.ToErrorByte())
+	}
+	return string(resp.Encode(res, resp.RESP2))
+}
+
+func runConnCmdCases(t *testing.T, conn *redis.RedisConn, db *redis.RedisDB, cases []cmdCase) {
+	t.Helper()
+	for _, c := range cases {
+		if got := execConnCmd(conn, db, c.cmd); got != c.want {
+			t.Errorf("%s = %q, want %q", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestExecAbortAndQueueReset(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	conn := redis.MakeRedisConn(nil)
+	runConnCmdCases(t, conn, db, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"SET a 1", "+QUEUED\r\n"},
+		{"SET b", "-ERR wrong number of arguments for 'set' command\r\n"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{"GET a", "$-1\r\n"},
+
+		//上一个事务的命令不会在下一个事务中再次执行
+		{"MULTI", "+OK\r\n"},
+		{"SET a 1", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"RPUSH l x", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n:1\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"RPUSH l y", "+QUEUED\r\n"},
+		{"DISCARD", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"LLEN l", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n:1\r\n"},
+
+		//执行失败的命令不影响其他命令
+		{"MULTI", "+OK\r\n"},
+		{"LPUSH a x", "+QUEUED\r\n"},
+		{"RPUSH l z", "+QUEUED\r\n"},
+		{"EXEC", "*2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n:2\r\n"},
+
+		{"MULTI", "+OK\r\n"},
+		{"WATCH a", "-ERR WATCH inside MULTI is not allowed\r\n"},
+		{"EXEC", "*0\r\n"},
+	})
+}
+
+func TestWatchPerConnection(t *testing.T) {
+	config.LoadDefaultConfig()
+	db := redis.NewDBInstance(0)
+	c1, c2 := redis.MakeRedisConn(nil), redis.MakeRedisConn(nil)
+
+	//unwatch 只取消自己的 watch
+	execConnCmd(c1, db, "WATCH a")
+	execConnCmd(c2, db, "WATCH a")
+	runConnCmdCases(t, c1, db, []cmdCase{{"UNWATCH", "+OK\r\n"}})
+	execCmd(db, "SET a 1")
+	runConnCmdCases(t, c1, db, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"GET a", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n$1\r\n1\r\n"},
+	})
+	runConnCmdCases(t, c2, db, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"GET a", "+QUEUED\r\n"},
+		{"EXEC", "*-1\r\n"},
+	})
+
+	//exec 之后只取消自己的 watch，并且不再受之前 watch 的 key 影响
+	execConnCmd(c1, db, "WATCH a")
+	execConnCmd(c2, db, "WATCH a")
+	runConnCmdCases(t, c1, db, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"EXEC", "*0\r\n"},
+	})
+	execCmd(db, "SET a 2")
+	if c1.GetDirtyCAS() {
+		t.Errorf("c1 should not be dirty after EXEC")
+	}
+	if !c2.GetDirtyCAS() {
+		t.Errorf("c2 should be dirty after a is modified")
+	}
+
+	//discard 同时清除 dirty 标记
+	runConnCmdCases(t, c2, db, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"DISCARD", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"EXEC", "*0\r\n"},
+		{"UNWATCH extra", "-ERR wrong number of arguments for 'unwatch' command\r\n"},
+	})
+}
+
+// 所有写命令访问的 key、过期、flushdb 以及 flushall 都会让 watch 失效
+func TestWatchInvalidatedByWrites(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := redis.NewDBs()
+	db0, db1 := rds.DBs[0], rds.DBs[1]
+
+	tests := []struct {
+		db      *redis.RedisDB
+		watched string
+		setup   string
+		cmd     string
+	}{
+		{db0, "y", "", "MSET x 1 y 2"},
+		{db0, "dst", "SADD src a", "SDIFFSTORE dst src"},
+		{db0, "ldst", "RPUSH lsrc a", "LMOVE lsrc ldst LEFT LEFT"},
+		{db0, "k", "SET k 1", "FLUSHDB"},
+		{db1, "k", "SET k 1", "FLUSHALL"},
+	}
+	for _, tt := range tests {
+		if tt.setup != "" {
+			execCmd(tt.db, tt.setup)
+		}
+		conn := redis.MakeRedisConn(nil)
+		execConnCmd(conn, tt.db, "WATCH "+tt.watched)
+		execCmd(db0, tt.cmd)
+		if !conn.GetDirtyCAS() {
+			t.Errorf("%s should invalidate WATCH on %s", tt.cmd, tt.watched)
+		}
+		conn.Unwatch()
+	}
+
+	//flushdb 只影响 watch 了存在的 key 的客户端
+	conn := redis.MakeRedisConn(nil)
+	execConnCmd(conn, db0, "WATCH missing")
+	execCmd(db0, "FLUSHDB")
+	if conn.GetDirtyCAS() {
+		t.Errorf("FLUSHDB should not invalidate WATCH on a missing key")
+	}
+	conn.Unwatch()
+
+	//没有修改 key 的写命令不会让 watch 失效，也不计入 dirty
+	execCmd(db0, "SET k 1")
+	execCmd(db0, "SADD s a")
+	execConnCmd(conn, db0, "WATCH k s missing")
+	dirty := rds.Dirty()
+	for _, cmd := range []string{"DEL missing", "SET k 2 NX", "SET missing 1 XX", "SADD s a",
+		"EXPIRE missing 10", "LPOP missing", "LPUSHX missing a", "HDEL missing f", "ZREM missing a"} {
+		execCmd(db0, cmd)
+		if conn.GetDirtyCAS() {
+			t.Fatalf("%s should not invalidate WATCH", cmd)
+		}
+	}
+	if rds.Dirty() != dirty {
+		t.Errorf("no-op writes should not increase dirty, got %d want %d", rds.Dirty(), dirty)
+	}
+	execCmd(db0, "SADD s b")
+	if !conn.GetDirtyCAS() {
+		t.Errorf("SADD s b should invalidate WATCH on s")
+	}
+	conn.Unwatch()
+
+	//watch 之后过期的 key，即使还没有被删除，exec 也会失败
+	execCmd(db0, "SET k 1 PX 10")
+	runConnCmdCases(t, conn, db0, []cmdCase{{"WATCH k", "+OK\r\n"}})
+	time.Sleep(20 * time.Millisecond)
+	runConnCmdCases(t, conn, db0, []cmdCase{
+		{"MULTI", "+OK\r\n"},
+		{"GET k", "+QUEUED\r\n"},
+		{"EXEC", "*-1\r\n"},
+	})
+
+	//过期删除同样会让 watch 失效
+	execCmd(db0, "SET k 1 PX 10")
+	execConnCmd(conn, db0, "WATCH k")
+	time.Sleep(20 * time.Millisecond)
+	execCmd(db0, "GET k")
+	if !conn.GetDirtyCAS() {
+		t.Errorf("lazy expire should invalidate WATCH on k")
+	}
+	conn.Unwatch()
+
+	runCmdCases(t, db0, []cmdCase{
+		{"FLUSHDB ASYNC", "+OK\r\n"},
+		{"FLUSHALL sync", "+OK\r\n"},
+		{"FLUSHDB foo", "-ERR syntax error\r\n"},
+		{"FLUSHALL async sync", "-ERR syntax error\r\n"},
+	})
+}
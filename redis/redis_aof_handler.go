@@ -1,73 +1,558 @@
 package redis
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/chenjiayao/goredistraning/config"
-	"github.com/chenjiayao/goredistraning/interface/response"
-	"github.com/chenjiayao/goredistraning/interface/server"
+	"github.com/chenjiayao/goredistraning/lib/atomic"
+	"github.com/chenjiayao/goredistraning/lib/hash"
 	"github.com/chenjiayao/goredistraning/lib/logger"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
 	"github.com/chenjiayao/goredistraning/lib/unboundedchan"
+	"github.com/chenjiayao/goredistraning/parser"
 	"github.com/chenjiayao/goredistraning/redis/resp"
 )
 
 // redis aof 属于写后日志，先写内存，再写日志
 type AofHandler struct {
 	aofChan     *unboundedchan.UnboundedChan
-	redisServer server.Server
-	aofFile     io.Writer
+	redisServer *RedisServer
+	aofFile     *os.File
+
+	// 最后一条写入 aof 文件的命令所在的 db，只在写 aof 的协程中访问
+	// 新的命令所在的 db 和它不一致时，需要先写入一条 select 命令
+	currentDBIndex int
+
+	// aof 重写相关，除了 rewriting 之外都只在写 aof 的协程中访问
+	rewriting     atomic.Boolean
+	rewriteBuffer []*aofPayload // 重写期间执行的命令，重写完成之后追加到新的 aof 文件中
+	aofSize       int64         // 当前 aof 文件大小
+	aofBaseSize   int64         // 启动或者上一次重写之后 aof 文件的大小，用来判断是否需要自动重写
+	rewriteWait   sync.WaitGroup
+
+	fsyncPolicy string
+	dirty       bool // 上一次 fsync 之后是否有新的写入，只在写 aof 的协程中访问
+
+	lock     sync.Mutex // 保护 closed，保证关闭 aofChan 之后不会再有重写开始
+	closed   bool
+	started  bool
+	stopped  chan struct{} // 写 aof 的协程退出之后关闭
+	tickers  sync.WaitGroup
+	stopTick chan struct{} // 关闭 everysec 的定时 fsync 协程
+}
+
+// 写入 aof chan 中的数据
+type aofPayload struct {
+	dbIndex int
+	cmd     [][]byte
+	done    chan struct{} // appendfsync always 时，命令 fsync 之后关闭，通知客户端可以返回了
+}
+
+// appendfsync everysec 时，每秒发送一次，由写 aof 的协程执行 fsync
+type fsyncPayload struct{}
+
+// 快照已经生成，之后的命令需要缓存起来，在重写完成之后追加到新的 aof 文件中
+type rewriteStartPayload struct{}
+
+// 快照已经写入临时文件
+type rewriteFinishPayload struct {
+	file    *os.File //写入失败时为 nil
+	dbIndex int      //临时文件中最后 select 的 db
 }
 
 func (h *AofHandler) StartAof() {
+	h.started = true
 	go func() {
-		for cmd := range h.aofChan.Out {
-			h.writeToAofFile(cmd)
+		defer close(h.stopped)
+		for payload := range h.aofChan.Out {
+			h.handlePayload(payload)
 		}
 	}()
+
+	if h.fsyncPolicy == config.AppendfsyncEverysec {
+		h.tickers.Add(1)
+		go h.fsyncEverySecond()
+	}
+}
+
+func (h *AofHandler) fsyncEverySecond() {
+	defer h.tickers.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.aofChan.In <- &fsyncPayload{}
+		case <-h.stopTick:
+			return
+		}
+	}
 }
 
-func (h *AofHandler) writeToAofFile(cmd [][]byte) {
-	if !h.isWriteCmd(cmd[0]) {
+func (h *AofHandler) handlePayload(payload interface{}) {
+	switch p := payload.(type) {
+	case *aofPayload:
+		h.writeToAofFile(p)
+		if p.done != nil {
+			h.fsync()
+			close(p.done)
+		}
+	case *fsyncPayload:
+		h.fsync()
+	case *rewriteStartPayload:
+		h.rewriteBuffer = make([]*aofPayload, 0)
+	case *rewriteFinishPayload:
+		h.finishRewrite(p)
+	}
+}
+
+func (h *AofHandler) writeToAofFile(payload *aofPayload) {
+	if !h.isWriteCmd(payload.cmd[0]) {
 		return
 	}
 
-	simpleResponse := resp.MakeMultiResponse(cmd)
-	asArrayResponse := resp.MakeArrayResponse([]response.Response{simpleResponse})
-	asBytes := asArrayResponse.ToContentByte()
-	_, err := h.aofFile.Write(asBytes)
+	dbIndex, n, err := writePayload(h.aofFile, h.currentDBIndex, payload)
+	h.aofSize += n
+	h.dirty = true
 	if err != nil {
 		logger.Info("write aof failed :", err.Error())
+		return
+	}
+	h.currentDBIndex = dbIndex
+
+	if h.rewriteBuffer != nil {
+		h.rewriteBuffer = append(h.rewriteBuffer, payload)
+	}
+	h.tryAutoRewrite()
+}
+
+// 把命令写入 w，如果命令所在的 db 和 currentDBIndex 不一致，先写入一条 select 命令
+// 返回写入之后选中的 db 以及写入的字节数
+func writePayload(w io.Writer, currentDBIndex int, payload *aofPayload) (int, int64, error) {
+	written := int64(0)
+	if payload.dbIndex != currentDBIndex {
+		n, err := writeCmd(w, [][]byte{
+			[]byte(Select),
+			[]byte(strconv.Itoa(payload.dbIndex)),
+		})
+		written += int64(n)
+		if err != nil {
+			return currentDBIndex, written, err
+		}
+	}
+	n, err := writeCmd(w, payload.cmd)
+	written += int64(n)
+	return payload.dbIndex, written, err
+}
+
+// 命令以 bulk string 数组的形式写入：*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
+func writeCmd(w io.Writer, cmd [][]byte) (int, error) {
+	asBytes := resp.MakeMultiResponse(cmd).ToContentByte()
+	return w.Write(asBytes)
+}
+
+func (h *AofHandler) fsync() {
+	if !h.dirty {
+		return
 	}
+	err := h.aofFile.Sync()
+	if err != nil {
+		logger.Error("fsync aof failed: ", err.Error())
+		return
+	}
+	h.dirty = false
 }
 
-func (h *AofHandler) LogCmd(cmd [][]byte) {
-	h.aofChan.In <- cmd
+// 记录在 dbIndex 上执行的命令
+// appendfsync always 时返回一个 chan，命令 fsync 到磁盘之后会被关闭，调用方需要等待它关闭之后再回复客户端
+// 其他策略返回 nil
+func (h *AofHandler) LogCmd(dbIndex int, cmd [][]byte) <-chan struct{} {
+	payload := &aofPayload{
+		dbIndex: dbIndex,
+		cmd:     cmd,
+	}
+	if h.fsyncPolicy == config.AppendfsyncAlways {
+		payload.done = make(chan struct{})
+	}
+	h.aofChan.In <- payload
+	return payload.done
 }
 
+// 等待正在进行的重写完成，把 aofChan 中剩余的命令写入文件，fsync 之后关闭文件
 func (h *AofHandler) EndAof() {
-	defer close(h.aofChan.In)
-	for cmd := range h.aofChan.Out {
-		h.writeToAofFile(cmd)
+	h.lock.Lock()
+	h.closed = true
+	h.lock.Unlock()
+
+	h.rewriteWait.Wait()
+	close(h.stopTick)
+	h.tickers.Wait()
+	close(h.aofChan.In)
+	if h.started {
+		<-h.stopped
+	} else {
+		for payload := range h.aofChan.Out {
+			h.handlePayload(payload)
+		}
 	}
+
+	h.dirty = true
+	h.fsync()
+	h.aofFile.Close()
 }
 
-func MakeAofHandler(server server.Server) *AofHandler {
+// 在后台重写 aof 文件
+// 1. 暂停所有命令的执行，生成所有 db 的快照（只遍历 key，value 通过 copy-on-write 共享），然后通知写 aof 的协程开始缓存之后的命令
+// 2. 根据快照生成能够重建数据的最少命令，写入临时文件
+// 3. 写 aof 的协程把缓存的命令追加到临时文件中，然后用临时文件替换掉原来的 aof 文件
+func (h *AofHandler) BgRewrite() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return errors.New("ERR server is shutting down")
+	}
+	if !h.rewriting.CompareAndSwap(false, true) {
+		return errors.New("ERR Background append only file rewriting already in progress")
+	}
+	h.rewriteWait.Add(1)
+	go h.rewrite()
+	return nil
+}
+
+func (h *AofHandler) rewrite() {
+	defer h.rewriteWait.Done()
+	h.redisServer.lock.Lock()
+	snapshots := h.redisServer.rds.snapshot()
+	h.aofChan.In <- &rewriteStartPayload{}
+	h.redisServer.lock.Unlock()
+
+	aofFileName := config.Config.AppendFilename
+	tmpFileName := filepath.Join(filepath.Dir(aofFileName), fmt.Sprintf("temp-rewriteaof-bg-%d.aof", os.Getpid()))
+	file, dbIndex, err := writeSnapshotToAof(tmpFileName, snapshots)
+	h.redisServer.rds.release(snapshots)
+	if err != nil {
+		logger.Error("rewrite aof failed: ", err.Error())
+		os.Remove(tmpFileName)
+		h.aofChan.In <- &rewriteFinishPayload{}
+		return
+	}
+	h.aofChan.In <- &rewriteFinishPayload{
+		file:    file,
+		dbIndex: dbIndex,
+	}
+}
+
+// 开启了 aof 但是还没有 aof 文件时（比如从 rdb 启动之后才打开 appendonly），启动时同步地把当前的数据写入 aof 文件
+// 否则下次启动时会加载只有新命令的 aof 文件，rdb 中的数据就丢失了
+func writeAofBase(aofFileName string, rds *RedisDBs) error {
+	tmpFileName := filepath.Join(filepath.Dir(aofFileName), fmt.Sprintf("temp-rewriteaof-%d.aof", os.Getpid()))
+	snapshots := rds.snapshot()
+	defer rds.release(snapshots)
+
+	file, _, err := writeSnapshotToAof(tmpFileName, snapshots)
+	if err != nil {
+		os.Remove(tmpFileName)
+		return err
+	}
+	file.Close()
+	return os.Rename(tmpFileName, aofFileName)
+}
+
+// 把快照写入 filename 中，返回打开的文件（以 append 方式打开，后续可以直接追加命令）和最后 select 的 db
+func writeSnapshotToAof(filename string, snapshots []*dbSnapshot) (*os.File, int, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	writer := bufio.NewWriter(file)
+	dbIndex := -1
+	for _, snapshot := range snapshots {
+		for _, entry := range snapshot.entries {
+			for _, cmd := range rewriteCmds(entry) {
+				dbIndex, _, err = writePayload(writer, dbIndex, &aofPayload{
+					dbIndex: snapshot.index,
+					cmd:     cmd,
+				})
+				if err != nil {
+					file.Close()
+					return nil, -1, err
+				}
+			}
+		}
+	}
+
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return nil, -1, err
+	}
+	return file, dbIndex, nil
+}
+
+// 每条 sadd、rpush、hset、zadd 命令最多包含的元素个数，避免单条命令过大
+const aofRewriteItemsPerCmd = 64
+
+// 生成能够重建 entry 的命令
+func rewriteCmds(entry *snapshotEntry) [][][]byte {
+	cmds := make([][][]byte, 0)
+	key := []byte(entry.key)
+
+	switch val := entry.value.(type) {
+	case string:
+		cmds = append(cmds, [][]byte{[]byte(Set), key, []byte(val)})
+	case *set.Set:
+		members := val.Members()
+		for start := 0; start < len(members); start += aofRewriteItemsPerCmd {
+			end := start + aofRewriteItemsPerCmd
+			if end > len(members) {
+				end = len(members)
+			}
+			cmd := append([][]byte{[]byte(Sadd), key}, members[start:end]...)
+			cmds = append(cmds, cmd)
+		}
+	case *quicklist.QuickList:
+		for start := 0; start < val.Len(); start += aofRewriteItemsPerCmd {
+			end := start + aofRewriteItemsPerCmd
+			if end > val.Len() {
+				end = val.Len()
+			}
+			cmd := [][]byte{[]byte(Rpush), key}
+			for _, element := range val.Range(start, end-1) {
+				cmd = append(cmd, []byte(element))
+			}
+			cmds = append(cmds, cmd)
+		}
+	case *hash.Hash:
+		var cmd [][]byte
+		val.ForEach(func(field, value string) bool {
+			if cmd == nil {
+				cmd = [][]byte{[]byte(Hset), key}
+			}
+			cmd = append(cmd, []byte(field), []byte(value))
+			if len(cmd)-2 >= aofRewriteItemsPerCmd*2 {
+				cmds = append(cmds, cmd)
+				cmd = nil
+			}
+			return true
+		})
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	case *sortedset.SortedSet:
+		var cmd [][]byte
+		val.ForEach(func(member string, score float64) bool {
+			if cmd == nil {
+				cmd = [][]byte{[]byte(Zadd), key}
+			}
+			//'g' 格式的最短表示可以被 ParseFloat 精确地解析回来，包括 +Inf 和 -Inf
+			cmd = append(cmd, []byte(strconv.FormatFloat(score, 'g', -1, 64)), []byte(member))
+			if len(cmd)-2 >= aofRewriteItemsPerCmd*2 {
+				cmds = append(cmds, cmd)
+				cmd = nil
+			}
+			return true
+		})
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	if entry.expireAt != -1 && len(cmds) > 0 {
+		cmds = append(cmds, [][]byte{
+			[]byte(Pexpireat),
+			key,
+			[]byte(strconv.FormatInt(entry.expireAt, 10)),
+		})
+	}
+	return cmds
+}
+
+// 把重写期间缓存的命令追加到临时文件中，然后替换掉原来的 aof 文件
+func (h *AofHandler) finishRewrite(p *rewriteFinishPayload) {
+	defer func() {
+		h.rewriteBuffer = nil
+		h.rewriting.Set(false)
+	}()
+
+	if p.file == nil {
+		return
+	}
+
+	writer := bufio.NewWriter(p.file)
+	dbIndex := p.dbIndex
+	var err error
+	for _, payload := range h.rewriteBuffer {
+		dbIndex, _, err = writePayload(writer, dbIndex, payload)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = p.file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(p.file.Name(), config.Config.AppendFilename)
+	}
+	if err != nil {
+		logger.Error("rewrite aof failed: ", err.Error())
+		p.file.Close()
+		os.Remove(p.file.Name())
+		return
+	}
+
+	h.aofFile.Close()
+	h.aofFile = p.file
+	h.currentDBIndex = dbIndex
+	h.aofSize = fileSize(p.file)
+	h.aofBaseSize = h.aofSize
+	logger.Info("background aof rewrite finished successfully")
+}
+
+// aof 文件比上次重写之后增长超过 auto-aof-rewrite-percentage，并且大于 auto-aof-rewrite-min-size 时自动重写
+func (h *AofHandler) tryAutoRewrite() {
+	percentage := int64(config.Config.AutoAofRewritePercentage)
+	if percentage <= 0 || h.rewriting.Get() || h.aofSize < config.Config.AutoAofRewriteMinSize {
+		return
+	}
+
+	base := h.aofBaseSize
+	if base == 0 {
+		base = 1
+	}
+	growth := (h.aofSize - base) * 100 / base
+	if growth >= percentage {
+		logger.Info(fmt.Sprintf("starting automatic rewriting of aof on %d%% growth", growth))
+		h.BgRewrite()
+	}
+}
+
+func fileSize(file *os.File) int64 {
+	info, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func MakeAofHandler(redisServer *RedisServer) *AofHandler {
 	handler := &AofHandler{
 		aofChan:     unboundedchan.MakeUnboundedChan(20),
-		redisServer: server,
+		redisServer: redisServer,
+
+		currentDBIndex: -1, //已有的 aof 文件最后选中的 db 未知，第一条命令之前总是写入 select
+
+		fsyncPolicy: parseFsyncPolicy(config.Config.Appendfsync),
+		stopped:     make(chan struct{}),
+		stopTick:    make(chan struct{}),
 	}
 	aofFileName := config.Config.AppendFilename
-	file, err := os.OpenFile(aofFileName, os.O_APPEND|os.O_WRONLY, 0664)
+	file, err := os.OpenFile(aofFileName, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0664)
 
 	//TODO 这里优化 aof 文件判断
 	if err != nil {
 		panic(err)
 	}
 	handler.aofFile = file
+	handler.aofSize = fileSize(file)
+	handler.aofBaseSize = handler.aofSize
 	return handler
 }
 
+// 没有配置或者配置错误时使用默认的 everysec
+func parseFsyncPolicy(policy string) string {
+	policy = strings.ToLower(policy)
+	switch policy {
+	case config.AppendfsyncAlways, config.AppendfsyncNo:
+		return policy
+	default:
+		return config.AppendfsyncEverysec
+	}
+}
+
+// 只有写命令以及包裹事务的 multi、exec 需要写入 aof
+// select 由 aof handler 根据 db 的变化自己写入，读命令和服务端命令重放时没有意义，auth 和 hello 中还包含密码
 func (h *AofHandler) isWriteCmd(cmdName []byte) bool {
-	return true
+	name := strings.ToLower(string(cmdName))
+	if name == Multi || name == Exec {
+		return true
+	}
+	_, is := WriteCommands[name]
+	return is
+}
+
+// 启动时加载 aof 文件：使用和 socket 相同的解析逻辑读出命令，然后在对应的 db 中重新执行一遍
+// aof 中记录了 select 命令，所以这里使用一个 RedisConn 来保存当前选中的 db
+// 如果文件最后一条命令不完整（比如写到一半宕机了）：
+// aof-load-truncated yes：丢弃这条命令，并且把文件截断到最后一条完整命令的位置
+// aof-load-truncated no：返回错误，server 不启动
+func LoadAof(aofFileName string, rds *RedisDBs) error {
+	file, err := os.Open(aofFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	fakeConn := MakeRedisConn(nil) //只用来保存 select 的 db 和事务状态，不会往里面写数据
+	decoder := parser.MakeDecoder(file)
+
+	cmdCount := 0
+	for {
+		offset := decoder.Offset()
+		cmd, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			if !config.Config.AofLoadTruncated {
+				return fmt.Errorf("aof file %s is truncated at offset %d, command %d", aofFileName, offset, cmdCount+1)
+			}
+			logger.Info(fmt.Sprintf("aof file %s is truncated at offset %d, the last command is discarded", aofFileName, offset))
+			return os.Truncate(aofFileName, offset)
+		}
+
+		if err != nil {
+			return fmt.Errorf("bad aof file %s format at offset %d, command %d: %s", aofFileName, offset, cmdCount+1, err.Error())
+		}
+
+		if len(cmd) == 0 {
+			continue
+		}
+		cmdCount++
+
+		cmdName := strings.ToLower(string(cmd[0]))
+		db := rds.DBs[fakeConn.GetSelectedDBIndex()]
+		res := db.Exec(fakeConn, cmdName, cmd[1:])
+		fakeConn.takePropagated()
+		//select 失败之后后面的命令会写入错误的 db，不能继续加载
+		if errRes, ok := res.(resp.RedisErrorResponse); ok && cmdName == Select {
+			return fmt.Errorf("bad aof file %s at offset %d, command %d: %s", aofFileName, offset, cmdCount, errRes.Err.Error())
+		}
+		if res != nil && !res.ISOK() {
+			logger.Info(fmt.Sprintf("replay aof command %d failed: %s", cmdCount, string(res.ToErrorByte())))
+		}
+	}
+	logger.Info(fmt.Sprintf("load %d commands from aof file %s", cmdCount, aofFileName))
+	return nil
 }
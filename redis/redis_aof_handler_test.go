@@ -0,0 +1,350 @@
+package redis_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+	_ "github.com/chenjiayao/goredistraning/redis/datatype"
+)
+
+func writeAofFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "aof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, "appendonly.aof")
+	err = ioutil.WriteFile(filename, []byte(content), 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadAof(t *testing.T) {
+	config.LoadDefaultConfig()
+	filename := writeAofFile(t, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"+
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n3\r\n"+
+		"*3\r\n$3\r\nset\r\n$4\r\nkey3\r\n$6\r\nvalue3\r\n")
+
+	rds := redis.NewDBs()
+	err := redis.LoadAof(filename, rds)
+	if err != nil {
+		t.Fatalf("LoadAof() error = %v", err)
+	}
+
+	v, ok := rds.DBs[0].Dataset.Get("key")
+	if !ok || v.(string) != "value" {
+		t.Errorf("db 0 key = %v, want = %s", v, "value")
+	}
+
+	v, ok = rds.DBs[3].Dataset.Get("key3")
+	if !ok || v.(string) != "value3" {
+		t.Errorf("db 3 key3 = %v, want = %s", v, "value3")
+	}
+
+	_, ok = rds.DBs[0].Dataset.Get("key3")
+	if ok {
+		t.Errorf("key3 should be loaded into db 3, but found in db 0")
+	}
+}
+
+func TestLoadAof_NotExist(t *testing.T) {
+	config.LoadDefaultConfig()
+	err := redis.LoadAof(filepath.Join(os.TempDir(), "not-exist.aof"), redis.NewDBs())
+	if err != nil {
+		t.Errorf("LoadAof() error = %v, want nil", err)
+	}
+}
+
+func TestLoadAof_Truncated(t *testing.T) {
+	valid := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	truncated := "*3\r\n$3\r\nSET\r\n$4\r\nkey2\r\n$5\r\nva"
+
+	config.LoadDefaultConfig()
+	config.Config.AofLoadTruncated = false
+	filename := writeAofFile(t, valid+truncated)
+	err := redis.LoadAof(filename, redis.NewDBs())
+	if err == nil {
+		t.Errorf("LoadAof() with aof-load-truncated no should return error")
+	}
+
+	config.Config.AofLoadTruncated = true
+	rds := redis.NewDBs()
+	err = redis.LoadAof(filename, rds)
+	if err != nil {
+		t.Fatalf("LoadAof() error = %v, want nil", err)
+	}
+	if _, ok := rds.DBs[0].Dataset.Get("key"); !ok {
+		t.Errorf("commands before the truncated one should be loaded")
+	}
+	if _, ok := rds.DBs[0].Dataset.Get("key2"); ok {
+		t.Errorf("truncated command should not be loaded")
+	}
+
+	content, _ := ioutil.ReadFile(filename)
+	if string(content) != valid {
+		t.Errorf("aof file should be truncated to %q, but got %q", valid, string(content))
+	}
+}
+
+// select 的 db 超出范围时返回错误，而不是在启动时 panic
+func TestLoadAof_SelectOutOfRange(t *testing.T) {
+	config.LoadDefaultConfig()
+	for _, index := range []string{"16", "-1"} {
+		filename := writeAofFile(t, "*2\r\n$6\r\nSELECT\r\n$"+strconv.Itoa(len(index))+"\r\n"+index+"\r\n"+
+			"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+		if err := redis.LoadAof(filename, redis.NewDBs()); err == nil {
+			t.Errorf("LoadAof() with SELECT %s should return error", index)
+		}
+	}
+}
+
+func TestAofHandler_LogCmd_Appendfsync(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.AppendFilename = writeAofFile(t, "")
+
+	config.Config.Appendfsync = config.AppendfsyncAlways
+	handler := redis.MakeAofHandler(nil)
+	handler.StartAof()
+	synced := handler.LogCmd(0, [][]byte{[]byte("set"), []byte("key"), []byte("value")})
+	if synced == nil {
+		t.Fatalf("LogCmd() with appendfsync always should return a chan")
+	}
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Errorf("LogCmd() with appendfsync always should be synced")
+	}
+	handler.EndAof()
+
+	info, _ := os.Stat(config.Config.AppendFilename)
+	if info.Size() == 0 {
+		t.Errorf("aof file should not be empty after LogCmd")
+	}
+
+	config.Config.Appendfsync = config.AppendfsyncEverysec
+	handler = redis.MakeAofHandler(nil)
+	handler.StartAof()
+	synced = handler.LogCmd(0, [][]byte{[]byte("set"), []byte("key"), []byte("value")})
+	if synced != nil {
+		t.Errorf("LogCmd() with appendfsync everysec should not wait")
+	}
+	handler.EndAof()
+}
+
+func TestAofHandler_LogCmdAndLoad(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.AppendFilename = writeAofFile(t, "")
+
+	handler := redis.MakeAofHandler(nil)
+	handler.StartAof()
+	handler.LogCmd(0, [][]byte{[]byte("set"), []byte("key"), []byte("value\r\n")})
+	handler.LogCmd(3, [][]byte{[]byte("set"), []byte("key"), []byte("value3")})
+	handler.LogCmd(3, [][]byte{[]byte("select"), []byte("0")})
+	handler.LogCmd(0, [][]byte{[]byte("set"), []byte("key0"), []byte("value0")})
+	handler.EndAof()
+
+	rds := redis.NewDBs()
+	err := redis.LoadAof(config.Config.AppendFilename, rds)
+	if err != nil {
+		t.Fatalf("LoadAof() error = %v", err)
+	}
+
+	want := map[int]map[string]string{
+		0: {"key": "value\r\n", "key0": "value0"},
+		3: {"key": "value3"},
+	}
+	for dbIndex, kv := range want {
+		for key, value := range kv {
+			v, _ := rds.DBs[dbIndex].Dataset.Get(key)
+			if v != value {
+				t.Errorf("db %d key %s = %v, want %q", dbIndex, key, v, value)
+			}
+		}
+	}
+	if _, ok := rds.DBs[3].Dataset.Get("key0"); ok {
+		t.Errorf("key0 should be written to db 0")
+	}
+}
+
+// move 和 copy db 在重放时需要能够访问其他 db
+func TestLoadAof_CrossDBCommands(t *testing.T) {
+	config.LoadDefaultConfig()
+	filename := writeAofFile(t, "*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\n1\r\n"+
+		"*5\r\n$4\r\ncopy\r\n$1\r\na\r\n$1\r\nb\r\n$2\r\ndb\r\n$1\r\n2\r\n"+
+		"*3\r\n$4\r\nmove\r\n$1\r\na\r\n$1\r\n1\r\n"+
+		"*2\r\n$3\r\ndel\r\n$1\r\nx\r\n")
+
+	rds := redis.NewDBs()
+	if err := redis.LoadAof(filename, rds); err != nil {
+		t.Fatalf("LoadAof() error = %v", err)
+	}
+	if _, ok := rds.DBs[0].Dataset.Get("a"); ok {
+		t.Errorf("a should be moved out of db 0")
+	}
+	if v, _ := rds.DBs[1].Dataset.Get("a"); v != "1" {
+		t.Errorf("db 1 a = %v, want 1", v)
+	}
+	if v, _ := rds.DBs[2].Dataset.Get("b"); v != "1" {
+		t.Errorf("db 2 b = %v, want 1", v)
+	}
+}
+
+// expire 以绝对时间的 pexpireat 写入 aof，事务在 exec 时用 multi/exec 包裹写入，只有写命令会写入 aof
+func TestRedisServer_AofPropagate(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.Dir = filepath.Dir(writeAofFile(t, ""))
+	config.Config.Save = ""
+	config.Config.Appendonly = true
+	config.Config.Appendfsync = config.AppendfsyncAlways
+	config.Config.AppendFilename = filepath.Join(config.Config.Dir, "propagate.aof")
+
+	server := redis.MakeRedisServer()
+	server.Log()
+	c := connectClient(t)
+	commands := []struct {
+		cmd  string
+		want string
+	}{
+		{"SET a 1", "+OK\r\n"},
+		{"GET a", "$1\r\n1\r\n"},
+		{"KEYS a", "*1\r\n$1\r\na\r\n"},
+		{"EXISTS a", ":1\r\n"},
+		{"CONFIG GET appendonly", "*2\r\n$10\r\nappendonly\r\n$3\r\nyes\r\n"},
+		{"EXPIRE a 100", ":1\r\n"},
+		{"SET c 1", "+OK\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"PEXPIRE c 100000", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n:1\r\n"},
+		{"SET d 1", "+OK\r\n"},
+		{"EXPIRE d -1", ":1\r\n"},
+		{"EXPIRE missing 10", ":0\r\n"},
+	}
+	for _, command := range commands {
+		c.send(command.cmd)
+		c.expect(t, command.want)
+	}
+	server.Close()
+
+	content, err := ioutil.ReadFile(config.Config.AppendFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof := string(content)
+	for _, want := range []string{"$9\r\npexpireat\r\n", "$5\r\nmulti\r\n", "$4\r\nexec\r\n", "$3\r\ndel\r\n$1\r\nd\r\n"} {
+		if !strings.Contains(aof, want) {
+			t.Errorf("aof should contain %q, got %q", want, aof)
+		}
+	}
+	//读命令和服务端命令不会写入 aof
+	for _, unwanted := range []string{"$6\r\nexpire\r\n", "$7\r\npexpire\r\n", "missing",
+		"$3\r\nget\r\n", "$4\r\nkeys\r\n", "$6\r\nexists\r\n", "$6\r\nconfig\r\n"} {
+		if strings.Contains(aof, unwanted) {
+			t.Errorf("aof should not contain %q, got %q", unwanted, aof)
+		}
+	}
+
+	rds := redis.NewDBs()
+	if err := redis.LoadAof(config.Config.AppendFilename, rds); err != nil {
+		t.Fatalf("LoadAof() error = %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := rds.DBs[0].TtlMap.Get(key); !ok {
+			t.Errorf("key %s should have ttl after LoadAof", key)
+		}
+	}
+	if _, ok := rds.DBs[0].Dataset.Get("d"); ok {
+		t.Errorf("key d should be deleted after LoadAof")
+	}
+}
+
+// move、copy db 和 randomkey 删除的过期 key 以 del 写入 key 所在的 db
+func TestRedisServer_AofPropagateExpiredInOtherDB(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.Dir = filepath.Dir(writeAofFile(t, ""))
+	config.Config.Save = ""
+	config.Config.Hz = 1
+	config.Config.Appendonly = true
+	config.Config.Appendfsync = config.AppendfsyncAlways
+	config.Config.AppendFilename = filepath.Join(config.Config.Dir, "expired.aof")
+
+	server := redis.MakeRedisServer()
+	server.Log()
+	c := connectClient(t)
+	for _, cmd := range []string{"SELECT 1", "SET m 1 PX 1", "SELECT 2", "SET r 1 PX 1"} {
+		c.send(cmd)
+		c.expect(t, "+OK\r\n")
+	}
+	time.Sleep(10 * time.Millisecond)
+	commands := []struct {
+		cmd  string
+		want string
+	}{
+		{"RANDOMKEY", "$-1\r\n"},
+		{"SELECT 0", "+OK\r\n"},
+		{"SET m 0", "+OK\r\n"},
+		{"MOVE m 1", ":1\r\n"},
+	}
+	for _, command := range commands {
+		c.send(command.cmd)
+		c.expect(t, command.want)
+	}
+	server.Close()
+
+	content, err := ioutil.ReadFile(config.Config.AppendFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof := string(content)
+	for _, want := range []string{
+		"*2\r\n$3\r\ndel\r\n$1\r\nr\r\n*2\r\n$6\r\nselect\r\n$1\r\n0\r\n",
+		"$6\r\nselect\r\n$1\r\n1\r\n*2\r\n$3\r\ndel\r\n$1\r\nm\r\n",
+	} {
+		if !strings.Contains(aof, want) {
+			t.Errorf("aof should contain %q, got %q", want, aof)
+		}
+	}
+}
+
+// 从 rdb 启动并且开启 aof 时先把 rdb 中的数据写入 aof，之后重启加载 aof 不会丢失 rdb 中的数据
+func TestRedisServer_AofBaseFromRdb(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.Dir = filepath.Dir(writeAofFile(t, ""))
+	config.Config.Save = ""
+
+	server := redis.MakeRedisServer()
+	c := connectClient(t)
+	c.send("RPUSH list a b")
+	c.expect(t, ":2\r\n")
+	c.send("SAVE")
+	c.expect(t, "+OK\r\n")
+	server.Close()
+
+	config.Config.Appendonly = true
+	config.Config.AppendFilename = filepath.Join(config.Config.Dir, "base.aof")
+	server = redis.MakeRedisServer()
+	server.Log()
+	c = connectClient(t)
+	c.send("SET a 1")
+	c.expect(t, "+OK\r\n")
+	server.Close()
+
+	//重启时只从 aof 中加载
+	os.Remove(filepath.Join(config.Config.Dir, config.Config.Dbfilename))
+	server = redis.MakeRedisServer()
+	defer server.Close()
+	c = connectClient(t)
+	c.send("LRANGE list 0 -1")
+	c.expect(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n")
+	c.send("GET a")
+	c.expect(t, "$1\r\n1\r\n")
+}
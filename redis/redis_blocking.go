@@ -0,0 +1,251 @@
+package redis
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/interface/response"
+	redisRequest "github.com/chenjiayao/goredistraning/redis/request"
+)
+
+// 阻塞命令（blpop、brpop、blmove）的实现：
+// 1. 阻塞命令执行时如果所有 key 都没有元素，返回 BlockedResponse，由 Handle 把客户端挂在这些 key 上，释放锁之后等待唤醒或者超时
+// 2. lpush、rpush、lmove 这类命令执行成功之后，如果有客户端阻塞在被修改的 key 上，把 key 记录到执行命令的连接的 readyKeys 中
+// 3. Handle 把命令写入 aof 之后，按照阻塞的先后顺序（FIFO）唤醒阻塞在 readyKeys 上的客户端：
+//    以被唤醒的客户端的身份执行对应的非阻塞命令（比如 blpop ---> lpop），写入 aof，然后把回复交给被唤醒的客户端
+// 4. 在 exec 中执行的阻塞命令不会阻塞，没有元素时直接返回超时的回复
+
+var _ response.Response = &BlockedResponse{}
+
+// 阻塞命令没有可以立即返回的元素时返回它，它不会被发送给客户端，也不会被写入 aof
+type BlockedResponse struct {
+	Keys    []string
+	Timeout time.Duration // 0 表示一直阻塞
+
+	// key 中有元素时，以被阻塞的客户端的身份执行的非阻塞命令，比如 blpop ---> lpop key
+	ServeCmd func(key string) [][]byte
+	// 把非阻塞命令的回复转换成阻塞命令的回复，没有弹出元素时返回 false，客户端继续阻塞
+	MakeReply func(key string, res response.Response) (response.Response, bool)
+	// 超时的回复
+	TimeoutReply response.Response
+}
+
+func (br *BlockedResponse) ToContentByte() []byte {
+	return []byte{}
+}
+
+func (br *BlockedResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+// 阻塞的时候命令还没有执行完成，不能写入 aof
+func (br *BlockedResponse) ISOK() bool {
+	return false
+}
+
+// 有新元素的 key
+type readyKey struct {
+	db  *RedisDB
+	key string
+}
+
+// 阻塞在 key 上的客户端
+type blockedClient struct {
+	conn    *RedisConn
+	db      *RedisDB
+	blocked *BlockedResponse
+	reply   chan response.Response // 被唤醒之后的回复，缓冲区大小为 1，唤醒时不会阻塞
+	// appendfsync always 时唤醒执行的命令 fsync 之后关闭，被唤醒的客户端需要等待它关闭之后再回复
+	// 在发送 reply 之前写入，客户端收到 reply 之后才会读取
+	synced <-chan struct{}
+}
+
+// 执行之后可能让阻塞的客户端被唤醒的命令，返回有新元素的 key
+var keyReadyCommands = map[string]func(args [][]byte) []string{
+	Lpush:     firstArgAsKey,
+	Lpushx:    firstArgAsKey,
+	Rpush:     firstArgAsKey,
+	Rpushx:    firstArgAsKey,
+	Linsert:   firstArgAsKey,
+	Rpoplpush: secondArgAsKey,
+	Lmove:     secondArgAsKey,
+	Blmove:    secondArgAsKey,
+	Rename:    secondArgAsKey,
+	Renamenx:  secondArgAsKey,
+}
+
+func firstArgAsKey(args [][]byte) []string {
+	return []string{string(args[0])}
+}
+
+func secondArgAsKey(args [][]byte) []string {
+	return []string{string(args[1])}
+}
+
+// 写命令执行成功之后调用，如果有客户端阻塞在命令修改的 key 上，记录到执行命令的连接中
+func (rd *RedisDB) signalKeysAsReady(c conn.Conn, cmdName string, args [][]byte) {
+	if atomic.LoadInt64(&rd.blockedCount) == 0 {
+		return
+	}
+	readyKeysOf, ok := keyReadyCommands[cmdName]
+	if !ok {
+		return
+	}
+	for _, key := range readyKeysOf(args) {
+		rd.SignalKeyAsReady(c, key)
+	}
+}
+
+// key 中可能有了新元素，如果有客户端阻塞在 key 上，记录到执行命令的连接中
+// 写入其他 db 的命令（比如 move、copy db）需要自己调用
+func (rd *RedisDB) SignalKeyAsReady(c conn.Conn, key string) {
+	if atomic.LoadInt64(&rd.blockedCount) == 0 {
+		return
+	}
+	redisConn, ok := c.(*RedisConn)
+	if !ok || redisConn == nil {
+		return
+	}
+	redisConn.readyKeys = append(redisConn.readyKeys, readyKey{db: rd, key: key})
+}
+
+// 把客户端挂在 key 上，调用方需要持有 server 的锁
+func (rd *RedisDB) block(conn *RedisConn, blocked *BlockedResponse) *blockedClient {
+	bc := &blockedClient{
+		conn:    conn,
+		db:      rd,
+		blocked: blocked,
+		reply:   make(chan response.Response, 1),
+	}
+
+	rd.blockingLock.Lock()
+	defer rd.blockingLock.Unlock()
+	for _, key := range blocked.Keys {
+		rd.blockingKeys[key] = append(rd.blockingKeys[key], bc)
+	}
+	atomic.AddInt64(&rd.blockedCount, 1)
+	return bc
+}
+
+// 客户端超时或者断开连接时调用，返回 false 说明客户端已经被唤醒了，回复在 bc.reply 中
+func (rd *RedisDB) unblock(bc *blockedClient) bool {
+	rd.blockingLock.Lock()
+	defer rd.blockingLock.Unlock()
+	return rd.removeBlockedClient(bc)
+}
+
+// 从所有 key 的阻塞队列中删除客户端，调用方需要持有 blockingLock
+func (rd *RedisDB) removeBlockedClient(bc *blockedClient) bool {
+	removed := false
+	for _, key := range bc.blocked.Keys {
+		waiters := rd.blockingKeys[key]
+		for i, waiter := range waiters {
+			if waiter == bc {
+				waiters = append(waiters[:i:i], waiters[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(rd.blockingKeys, key)
+		} else {
+			rd.blockingKeys[key] = waiters
+		}
+	}
+	if removed {
+		atomic.AddInt64(&rd.blockedCount, -1)
+	}
+	return removed
+}
+
+// 唤醒阻塞在 client.readyKeys 上的客户端，调用方需要持有 server 的锁，并且已经把 client 执行的命令写入了 aof
+func (redisServer *RedisServer) serveBlockedClients(client *RedisConn) {
+	readyKeys := client.readyKeys
+	client.readyKeys = nil
+	redisServer.serveReadyKeys(readyKeys)
+}
+
+func (redisServer *RedisServer) serveReadyKeys(readyKeys []readyKey) {
+	for len(readyKeys) > 0 {
+		rk := readyKeys[0]
+		readyKeys = redisServer.serveKey(rk.db, rk.key, readyKeys[1:])
+	}
+}
+
+// 按照阻塞的先后顺序唤醒阻塞在 key 上的客户端，直到 key 中没有元素
+// 唤醒时执行的命令（比如 lmove）可能让其他 key 有新元素，追加到 readyKeys 中返回
+// 被阻塞的客户端的 readyKeys 只在持有 blockingLock 时访问，它自己的 goroutine 在被唤醒之前不会访问
+func (redisServer *RedisServer) serveKey(db *RedisDB, key string, readyKeys []readyKey) []readyKey {
+	db.blockingLock.Lock()
+	defer db.blockingLock.Unlock()
+
+	for {
+		waiters := db.blockingKeys[key]
+		if len(waiters) == 0 {
+			return readyKeys
+		}
+
+		bc := waiters[0]
+		cmd := bc.blocked.ServeCmd(key)
+		res := db.Exec(bc.conn, strings.ToLower(string(cmd[0])), cmd[1:])
+		reply, served := bc.blocked.MakeReply(key, res)
+		if !served {
+			return readyKeys
+		}
+		for _, propagated := range bc.conn.takePropagated() {
+			if redisServer.aofHandler != nil {
+				bc.synced = redisServer.aofHandler.LogCmd(propagated.dbIndex, propagated.cmd)
+			}
+		}
+
+		readyKeys = append(readyKeys, bc.conn.readyKeys...)
+		bc.conn.readyKeys = nil
+		db.removeBlockedClient(bc)
+		bc.reply <- reply
+	}
+}
+
+// 等待客户端被唤醒或者超时，调用方不能持有 server 的锁
+// 被唤醒时和 Handle 一样，等待唤醒执行的命令 fsync 之后再返回回复
+// 阻塞期间继续从 requests 中读取请求：
+// 1. 读取出错（比如客户端断开连接）：取消阻塞，返回 closed = true
+// 2. 客户端 pipeline 的下一条命令：暂存到 pending 中，被唤醒之后再执行
+func (redisServer *RedisServer) waitUnblocked(bc *blockedClient, requests <-chan redisRequest.RedisRequet) (res response.Response, pending *redisRequest.RedisRequet, closed bool) {
+	var timeout <-chan time.Time
+	if bc.blocked.Timeout > 0 {
+		timer := time.NewTimer(bc.blocked.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case res = <-bc.reply:
+			bc.waitSynced()
+			return res, pending, false
+		case <-timeout:
+			if bc.db.unblock(bc) {
+				return bc.blocked.TimeoutReply, pending, false
+			}
+			res = <-bc.reply
+			bc.waitSynced()
+			return res, pending, false
+		case request, ok := <-requests:
+			if !ok || request.Err != nil && !isProtocolError(request.Err) {
+				bc.db.unblock(bc)
+				return nil, nil, true
+			}
+			pending = &request
+			requests = nil
+		}
+	}
+}
+
+// appendfsync always：等待唤醒时执行的命令写入磁盘，只能在收到 reply 之后调用
+func (bc *blockedClient) waitSynced() {
+	if bc.synced != nil {
+		<-bc.synced
+	}
+}
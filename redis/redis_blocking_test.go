@@ -0,0 +1,164 @@
+package redis_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+	_ "github.com/chenjiayao/goredistraning/redis/datatype"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// 再建立一个连接到 startServer 启动的 server
+func connectClient(t *testing.T) *testClient {
+	client := handleConn(t, redis.ServerInstance)
+	return &testClient{conn: client, reader: bufio.NewReader(client)}
+}
+
+// net.Pipe 的写入需要等 server 读取，异步发送 inline 命令
+func (c *testClient) send(cmd string) {
+	go c.conn.Write([]byte(cmd + "\r\n"))
+}
+
+func (c *testClient) expect(t *testing.T, want string) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(c.reader, got); err != nil || string(got) != want {
+		t.Fatalf("reply = %q, %v, want %q", got, err, want)
+	}
+}
+
+// 没有回复说明客户端还在阻塞
+func (c *testClient) expectBlocked(t *testing.T) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := c.reader.Peek(1); err == nil {
+		t.Fatalf("client is not blocked")
+	}
+}
+
+func TestBlockingPop_FIFO(t *testing.T) {
+	startServer(t)
+	c1 := connectClient(t)
+	c2 := connectClient(t)
+	c3 := connectClient(t)
+
+	c1.send("BLPOP empty list 0")
+	c1.expectBlocked(t)
+	c2.send("BRPOP list 0")
+	c2.expectBlocked(t)
+
+	//先阻塞的客户端先被唤醒
+	c3.send("RPUSH list a b")
+	c3.expect(t, ":2\r\n")
+	c1.expect(t, "*2\r\n$4\r\nlist\r\n$1\r\na\r\n")
+	c2.expect(t, "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n")
+
+	c3.send("LLEN list")
+	c3.expect(t, ":0\r\n")
+}
+
+// appendfsync always：被唤醒的客户端收到回复时，唤醒执行的 lpop 已经写入 aof 文件
+func TestBlockingPop_AppendfsyncAlways(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.Dir = filepath.Dir(writeAofFile(t, ""))
+	config.Config.Save = ""
+	config.Config.Appendonly = true
+	config.Config.Appendfsync = config.AppendfsyncAlways
+	config.Config.AppendFilename = filepath.Join(config.Config.Dir, "blocking.aof")
+
+	server := redis.MakeRedisServer()
+	server.Log()
+	defer server.Close()
+	c1 := connectClient(t)
+	c2 := connectClient(t)
+
+	c1.send("BLPOP list 0")
+	c1.expectBlocked(t)
+	c2.send("RPUSH list a")
+	c2.expect(t, ":1\r\n")
+	c1.expect(t, "*2\r\n$4\r\nlist\r\n$1\r\na\r\n")
+
+	content, err := ioutil.ReadFile(config.Config.AppendFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "$4\r\nlpop\r\n$4\r\nlist\r\n") {
+		t.Errorf("aof should contain the lpop before the reply, got %q", content)
+	}
+}
+
+func TestBlockingPop_Timeout(t *testing.T) {
+	startServer(t)
+	c1 := connectClient(t)
+
+	c1.send("BLPOP list 0.05")
+	c1.expect(t, "*-1\r\n")
+
+	c1.send("BLMOVE list dst LEFT RIGHT 0.05")
+	c1.expect(t, "$-1\r\n")
+
+	c1.send("BLPOP list -1")
+	c1.expect(t, "-ERR timeout is negative\r\n")
+	c1.send("BLPOP list abc")
+	c1.expect(t, "-ERR timeout is not a float or out of range\r\n")
+}
+
+func TestBlockingPop_InMulti(t *testing.T) {
+	startServer(t)
+	c1 := connectClient(t)
+
+	c1.send("MULTI")
+	c1.expect(t, "+OK\r\n")
+	c1.send("BLPOP list 0")
+	c1.expect(t, "+QUEUED\r\n")
+	c1.send("EXEC")
+	c1.expect(t, "*1\r\n*-1\r\n")
+}
+
+func TestBlockingMove(t *testing.T) {
+	startServer(t)
+	c1 := connectClient(t)
+	c2 := connectClient(t)
+	c3 := connectClient(t)
+
+	c1.send("BLMOVE src dst LEFT RIGHT 0")
+	c1.expectBlocked(t)
+	c2.send("BLPOP dst 0")
+	c2.expectBlocked(t)
+
+	//blmove 把元素移动到 dst 之后，继续唤醒阻塞在 dst 上的客户端
+	c3.send("LPUSH src x")
+	c3.expect(t, ":1\r\n")
+	c1.expect(t, "$1\r\nx\r\n")
+	c2.expect(t, "*2\r\n$3\r\ndst\r\n$1\r\nx\r\n")
+}
+
+func TestBlockingPop_Disconnect(t *testing.T) {
+	startServer(t)
+	c1 := connectClient(t)
+	c2 := connectClient(t)
+
+	c1.send("BLPOP list 0")
+	c1.expectBlocked(t)
+	c1.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	//断开连接的客户端不会再弹出元素
+	c2.send("RPUSH list a")
+	c2.expect(t, ":1\r\n")
+	c2.send("LLEN list")
+	c2.expect(t, ":1\r\n")
+}
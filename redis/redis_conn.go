@@ -2,8 +2,11 @@ package redis
 
 import (
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/redis/resp"
 )
 
 var _ conn.Conn = &RedisConn{}
@@ -14,18 +17,51 @@ const (
 	NotInMultiState MultiState = iota
 	InMultiState
 	InMultiStateButHaveError
+	InExecState // 正在执行 exec，事务中的阻塞命令不会阻塞
 )
 
+// 每个连接的 id，自增
+var connIDGenerator int64
+
+// 回复缓冲区的上限，超过之后立即写入 socket，避免 pipeline 很长的时候占用太多内存
+const maxReplyBufferSize = 64 * 1024
+
 //每个连接需要保存的信息
 type RedisConn struct {
 	conn       net.Conn
 	selectedDB int
 	password   string
 
+	id       int64
+	name     string
+	protocol int // RESP 协议版本，默认 RESP2，客户端可以通过 HELLO 3 切换到 RESP3
+
 	multiState     MultiState
 	multiCmdQueues [][][]byte // 事务命令
 
-	redisDirtyCAS bool //标记当前事务是否被破坏 ----> watch 的 key 是否被更改了
+	redisDirtyCAS int32        //标记当前事务是否被破坏 ----> watch 的 key 是否被更改了，其他客户端的写命令会修改它，原子访问
+	watchedKeys   []watchedKey // watch 的 key，exec、discard、unwatch 以及断开连接的时候从 db 中删除
+
+	replyBuf []byte // 回复缓冲区，客户端 pipeline 的时候多条回复合并成一次 write
+
+	readyKeys []readyKey // 当前命令让哪些 key 有了新元素，命令写入 aof 之后唤醒阻塞在这些 key 上的客户端
+
+	propagated          []propagatedCmd // 当前请求需要写入 aof 的命令，由 RedisDB.Exec 记录，写入 aof 之前通过 takePropagated 取出
+	propagateOverride   [][][]byte // 正在执行的命令写入 aof 时替换成的命令
+	propagateOverridden bool
+}
+
+// 需要写入 aof 的命令以及命令所在的 db
+// 访问其他 db 的命令（比如 move、copy db）删除目标 db 中过期的 key 时，del 需要写入目标 db
+type propagatedCmd struct {
+	dbIndex int
+	cmd     [][]byte
+}
+
+// 连接 watch 的 key 以及 key 所在的 db
+type watchedKey struct {
+	db  *RedisDB
+	key string
 }
 
 func MakeRedisConn(conn net.Conn) *RedisConn {
@@ -35,17 +71,83 @@ func MakeRedisConn(conn net.Conn) *RedisConn {
 		selectedDB:     0,
 		password:       "",
 		multiCmdQueues: make([][][]byte, 0),
+
+		id:       atomic.AddInt64(&connIDGenerator, 1),
+		protocol: resp.RESP2,
 	}
 	return rc
 }
 
-func (rc *RedisConn) DirtyCAS(flag bool) {
+func (rc *RedisConn) GetID() int64 {
+	return rc.id
+}
+
+func (rc *RedisConn) GetName() string {
+	return rc.name
+}
+
+func (rc *RedisConn) SetName(name string) {
+	rc.name = name
+}
+
+func (rc *RedisConn) GetProtocol() int {
+	return rc.protocol
+}
+
+func (rc *RedisConn) SetProtocol(protocol int) {
+	rc.protocol = protocol
+}
 
-	rc.redisDirtyCAS = flag
+// 比如 expire 需要记录成绝对时间的 pexpireat，spop 需要记录成 srem，重放 aof 的时候结果才和执行时一致
+func (rc *RedisConn) Propagate(cmds ...[][]byte) {
+	rc.propagateOverride = cmds
+	rc.propagateOverridden = true
 }
 
+// 记录在 dbIndex 上需要写入 aof 的命令
+func (rc *RedisConn) propagate(dbIndex int, cmds ...[][]byte) {
+	for _, cmd := range cmds {
+		rc.propagated = append(rc.propagated, propagatedCmd{dbIndex: dbIndex, cmd: cmd})
+	}
+}
+
+// 取出当前请求需要写入 aof 的命令，并且清空
+func (rc *RedisConn) takePropagated() []propagatedCmd {
+	cmds := rc.propagated
+	rc.propagated = nil
+	return cmds
+}
+
+func (rc *RedisConn) DirtyCAS(flag bool) {
+	dirty := int32(0)
+	if flag {
+		dirty = 1
+	}
+	atomic.StoreInt32(&rc.redisDirtyCAS, dirty)
+}
+
+// watch 的 key 被修改了，或者已经过期但是还没有被删除，和 redis 的 isWatchedKeyExpired 一致
+// watch 的时候已经过期的 key 会被惰性删除，所以这里过期的 key 一定是 watch 之后才过期的
 func (rc *RedisConn) GetDirtyCAS() bool {
-	return rc.redisDirtyCAS
+	if atomic.LoadInt32(&rc.redisDirtyCAS) == 1 {
+		return true
+	}
+	now := time.Now().UnixMilli()
+	for _, watched := range rc.watchedKeys {
+		if expireAt, ok := watched.db.TtlMap.Get(watched.key); ok && expireAt.(int64) <= now {
+			return true
+		}
+	}
+	return false
+}
+
+// 取消 watch 的所有 key，只删除当前连接在各个 db 中的记录，同时清除 dirty 标记
+func (rc *RedisConn) Unwatch() {
+	for _, watched := range rc.watchedKeys {
+		watched.db.RemoveWatchKey(rc, watched.key)
+	}
+	rc.watchedKeys = nil
+	rc.DirtyCAS(false)
 }
 
 func (rc *RedisConn) Discard() {
@@ -80,12 +182,39 @@ func (rc *RedisConn) SetPassword(password string) {
 	rc.password = password
 }
 
+// 关闭之前先把缓冲区中的回复发送出去，比如协议错误的回复
 func (rc *RedisConn) Close() {
+	rc.Flush()
 	rc.conn.Close()
 }
 
+// 回复先写入缓冲区，调用 Flush 的时候才会真正写入 socket
+// 缓冲区超过 maxReplyBufferSize 会立即写入 socket
 func (rc *RedisConn) Write(data []byte) error {
-	_, err := rc.conn.Write(data)
+	if len(rc.replyBuf)+len(data) <= maxReplyBufferSize {
+		rc.replyBuf = append(rc.replyBuf, data...)
+		return nil
+	}
+
+	err := rc.Flush()
+	if err != nil {
+		return err
+	}
+	if len(data) > maxReplyBufferSize {
+		_, err = rc.conn.Write(data)
+		return err
+	}
+	rc.replyBuf = append(rc.replyBuf, data...)
+	return nil
+}
+
+// 把缓冲区中的回复写入 socket
+func (rc *RedisConn) Flush() error {
+	if len(rc.replyBuf) == 0 {
+		return nil
+	}
+	_, err := rc.conn.Write(rc.replyBuf)
+	rc.replyBuf = rc.replyBuf[:0]
 	return err
 }
 
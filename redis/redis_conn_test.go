@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// 记录 Write 调用次数的 net.Conn
+type countConn struct {
+	net.Conn
+	buf    bytes.Buffer
+	writes int
+}
+
+func (cc *countConn) Write(b []byte) (int, error) {
+	cc.writes++
+	return cc.buf.Write(b)
+}
+
+func (cc *countConn) Close() error {
+	return nil
+}
+
+func TestRedisConn_Write(t *testing.T) {
+	cc := &countConn{}
+	rc := MakeRedisConn(cc)
+
+	for i := 0; i < 10; i++ {
+		if err := rc.Write([]byte("+OK\r\n")); err != nil {
+			t.Fatalf("rc.Write() error = %v", err)
+		}
+	}
+	if cc.writes != 0 {
+		t.Errorf("replies should be buffered before Flush, conn writes = %d", cc.writes)
+	}
+
+	if err := rc.Flush(); err != nil {
+		t.Fatalf("rc.Flush() error = %v", err)
+	}
+	if cc.writes != 1 || cc.buf.Len() != 50 {
+		t.Errorf("rc.Flush() conn writes = %d, len = %d, want 1 write of 50 bytes", cc.writes, cc.buf.Len())
+	}
+
+	//空缓冲区不会写入 socket
+	rc.Flush()
+	if cc.writes != 1 {
+		t.Errorf("flush empty buffer should not write, conn writes = %d", cc.writes)
+	}
+}
+
+func TestRedisConn_WriteMaxBuffer(t *testing.T) {
+	cc := &countConn{}
+	rc := MakeRedisConn(cc)
+
+	rc.Write([]byte("+OK\r\n"))
+	big := bytes.Repeat([]byte("a"), maxReplyBufferSize)
+	rc.Write(big)
+
+	//缓冲区放不下的时候先把已有的回复写出去
+	if cc.writes != 1 || cc.buf.Len() != 5 {
+		t.Errorf("conn writes = %d, len = %d, want 1 write of 5 bytes", cc.writes, cc.buf.Len())
+	}
+	if len(rc.replyBuf) != maxReplyBufferSize {
+		t.Errorf("reply buffer len = %d, want %d", len(rc.replyBuf), maxReplyBufferSize)
+	}
+
+	//超过上限的回复直接写入 socket
+	rc.Write(append(big, 'b'))
+	if cc.writes != 3 || cc.buf.Len() != 5+maxReplyBufferSize*2+1 || len(rc.replyBuf) != 0 {
+		t.Errorf("conn writes = %d, len = %d, want 3 writes", cc.writes, cc.buf.Len())
+	}
+
+	rc.Write([]byte("+OK\r\n"))
+	rc.Close()
+	if cc.writes != 4 {
+		t.Errorf("rc.Close() should flush the reply buffer, conn writes = %d", cc.writes)
+	}
+}
+
+// 1000 条回复每条都写一次 socket 和合并成一次写入的对比
+func BenchmarkRedisConn_Write(b *testing.B) {
+	const pipeline = 1000
+	reply := []byte("+OK\r\n")
+
+	benchmarks := []struct {
+		name       string
+		flushEvery bool
+	}{
+		{name: "flush-every-reply", flushEvery: true},
+		{name: "pipeline", flushEvery: false},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			client, server := tcpPair(b)
+			go io.Copy(ioutil.Discard, client)
+			rc := MakeRedisConn(server)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < pipeline; j++ {
+					rc.Write(reply)
+					if bm.flushEvery {
+						rc.Flush()
+					}
+				}
+				rc.Flush()
+			}
+		})
+	}
+}
+
+// 通过本地回环地址建立一对 tcp 连接
+func tcpPair(b *testing.B) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
@@ -2,7 +2,9 @@ package redis
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/interface/conn"
@@ -22,14 +24,25 @@ var _ db.DB = &RedisDB{}
 type RedisDB struct {
 	Dataset *dict.ConcurrentDict
 	Index   int                  // 数据库 db 编号
-	TtlMap  *dict.ConcurrentDict //保存 key 和过期时间之间的关系
+	TtlMap  *dict.ConcurrentDict //保存 key 和过期时间之间的关系，过期的 key 由惰性删除和 server 的定期删除清理
 
-	//一个协程来定时删除过期的key
-	//一个chan 来关闭「定时删除过期 key 的协程」
 	keyLocks sync.Map
 
 	// 保存了一个 watched_keys 字典， 字典的键是这个数据库被监视的键， 而字典的值则是一个链表， 链表中保存了所有监视这个键的客户端。
-	WatchedKeys sync.Map
+	watchedKeys map[string]*list.List
+	watchLock   sync.Mutex // 不同客户端的 watch、unwatch 以及写命令会同时访问 watchedKeys
+
+	dirty int64 // 执行成功的写命令个数，rdb 根据它判断是否满足 save 规则，原子访问
+
+	// 阻塞在 key 上的客户端，按照阻塞的先后顺序排列
+	blockingKeys map[string][]*blockedClient
+	blockingLock sync.Mutex
+	blockedCount int64 // 阻塞的客户端个数，原子访问，写命令通过它快速判断是否需要唤醒客户端
+
+	dbs *RedisDBs // db 所属的 RedisDBs，move、copy 这类命令需要访问其他 db
+
+	objects    *dict.ConcurrentDict // key 的内存占用、访问时间和访问频率，超过 maxmemory 淘汰 key 时使用
+	usedMemory int64                // 所有 key 估算的内存占用，原子访问
 }
 
 func NewDBInstance(index int) *RedisDB {
@@ -39,7 +52,11 @@ func NewDBInstance(index int) *RedisDB {
 		TtlMap:   dict.NewDict(128),
 		keyLocks: sync.Map{},
 
-		WatchedKeys: sync.Map{},
+		watchedKeys: make(map[string]*list.List),
+
+		blockingKeys: make(map[string][]*blockedClient),
+
+		objects: dict.NewDict(128),
 	}
 	return rd
 }
@@ -82,38 +99,145 @@ func (rd *RedisDB) Exec(conn conn.Conn, cmdName string, args [][]byte) response.
 	//执行命令
 	CommandFunc := command.CommandFunc
 
+	redisConn, _ := conn.(*RedisConn)
+	keys := keysOfCommand(cmdName, args)
+	//惰性删除命令访问的过期 key，写入 aof 的 del 需要在命令之前
+	rd.expireCommandKeys(conn, keys)
+
+	start := 0
+	if redisConn != nil {
+		redisConn.propagateOverride = nil
+		redisConn.propagateOverridden = false
+		start = len(redisConn.propagated)
+	}
+
+	if _, write := WriteCommands[cmdName]; write {
+		rd.copyOnWrite(keys)
+	}
 	resp := CommandFunc(conn, rd, args)
 
+	if redisConn != nil {
+		rd.propagate(redisConn, cmdName, args, resp, start)
+	}
+	rd.updateObjects(cmdName, keys)
+
 	_, is := WriteCommands[cmdName]
 	if !is {
 		return resp
 	}
-
-	key := rd.parseCommandKeyFromArgs(args)
-	if key != "" {
-		rd.setWatchedKeyClientCASDirty(key)
+	//没有修改 key 的写命令（比如 del 不存在的 key、set nx 失败）不会让其他客户端的事务失败，也不计入 save 规则
+	if resp.ISOK() && !isNoopReply(cmdName, resp) {
+		atomic.AddInt64(&rd.dirty, 1)
+		rd.signalKeysAsReady(conn, cmdName, args)
+		for _, key := range keys {
+			rd.SignalModifiedKey(key)
+		}
 	}
 	return resp
 }
 
-// 从命令参数中解析出 key
-func (rd *RedisDB) parseCommandKeyFromArgs(args [][]byte) string {
-	if len(args) == 0 {
-		return ""
+// 写命令的回复说明没有修改任何 key 时返回 true
+// 不在表中的写命令只要执行成功就认为修改了 key，比如 hset、zadd 回复 0 时也可能更新了已有的 field 和 score
+var noopReplies = map[string]func(res response.Response) bool{
+	Set:       isNullReply,
+	Setnx:     isNullReply,
+	Msetnx:    isZeroReply,
+	Getset:    isNullReply,
+	Sadd:      isZeroReply,
+	Srem:      isZeroReply,
+	Smove:     isZeroReply,
+	Spop:      isNullReply,
+	Lpushx:    isZeroReply,
+	Rpushx:    isZeroReply,
+	Lpop:      isNullReply,
+	Rpop:      isNullReply,
+	Rpoplpush: isNullReply,
+	Lmove:     isNullReply,
+	Blpop:     isNullReply,
+	Brpop:     isNullReply,
+	Blmove:    isNullReply,
+	Lrem:      isZeroReply,
+	Linsert: func(res response.Response) bool {
+		//key 不存在时返回 0，pivot 不存在时返回 -1
+		return isZeroReply(res) || string(res.ToContentByte()) == ":-1\r\n"
+	},
+	Expire:           isZeroReply,
+	Pexpire:          isZeroReply,
+	Expireat:         isZeroReply,
+	Pexpireat:        isZeroReply,
+	Persist:          isZeroReply,
+	Del:              isZeroReply,
+	Unlink:           isZeroReply,
+	Renamenx:         isZeroReply,
+	Copy:             isZeroReply,
+	Move:             isZeroReply,
+	Hsetnx:           isZeroReply,
+	Hdel:             isZeroReply,
+	Zadd:             isNullReply,
+	Zrem:             isZeroReply,
+	Zremrangebyscore: isZeroReply,
+	Zremrangebyrank:  isZeroReply,
+	Zremrangebylex:   isZeroReply,
+}
+
+func isNoopReply(cmdName string, res response.Response) bool {
+	isNoop, ok := noopReplies[cmdName]
+	return ok && isNoop(res)
+}
+
+func isZeroReply(res response.Response) bool {
+	return string(res.ToContentByte()) == ":0\r\n"
+}
+
+// nil 或者空数组，比如 key 不存在时的 lpop、spop key count，set nx 失败
+func isNullReply(res response.Response) bool {
+	switch string(res.ToContentByte()) {
+	case "$-1\r\n", "*-1\r\n", "*0\r\n":
+		return true
+	}
+	return false
+}
+
+// 记录命令需要写入 aof 的内容，start 是命令执行之前 propagated 的长度
+// 只记录执行成功的写命令，命令通过 Propagate 指定了写入的内容时（比如 expire 写成 pexpireat）使用指定的内容
+// 读命令以及 save、bgrewriteaof 这类服务端命令不会写入 aof，否则加载 aof 时会重新执行一遍
+func (rd *RedisDB) propagate(redisConn *RedisConn, cmdName string, args [][]byte, res response.Response, start int) {
+	//事务中的命令执行时已经记录在 propagated 中了，用 multi 和 exec 包起来，保证重放时也是原子执行的
+	if cmdName == Exec {
+		if len(redisConn.propagated) > start {
+			cmds := append([]propagatedCmd{{dbIndex: rd.Index, cmd: [][]byte{[]byte(Multi)}}}, redisConn.propagated[start:]...)
+			redisConn.propagated = append(redisConn.propagated[:start], cmds...)
+			redisConn.propagate(rd.Index, [][]byte{[]byte(Exec)})
+		}
+		return
+	}
+	if !res.ISOK() {
+		return
+	}
+	if redisConn.propagateOverridden {
+		redisConn.propagate(rd.Index, redisConn.propagateOverride...)
+		return
+	}
+	if _, write := WriteCommands[cmdName]; !write {
+		return
 	}
-	key := string(args[0])
-	return key
+	redisConn.propagate(rd.Index, append([][]byte{[]byte(cmdName)}, args...))
 }
 
 //将有 watch key 的 client 的 dirtyCAS 设置为 true
 func (rd *RedisDB) setWatchedKeyClientCASDirty(key string) {
+	rd.watchLock.Lock()
+	defer rd.watchLock.Unlock()
 
-	val, exist := rd.WatchedKeys.Load(key)
+	link, exist := rd.watchedKeys[key]
 	if !exist {
 		return
 	}
+	setClientsCASDirty(link)
+}
 
-	link := val.(*list.List)
+// 调用方需要持有 watchLock
+func setClientsCASDirty(link *list.List) {
 	node := link.First()
 	for {
 		if node == nil {
@@ -142,38 +266,125 @@ func (rd *RedisDB) UnLockKey(key string) {
 	defer rd.keyLocks.Delete(key)
 }
 
+// 对多个 key 加锁，key 去重之后按照字典序加锁，保证所有协程的加锁顺序一致，避免死锁
+func (rd *RedisDB) LockKeys(keys ...string) {
+	for _, key := range sortedUniqueKeys(keys) {
+		rd.LockKey(key)
+	}
+}
+
+func (rd *RedisDB) UnLockKeys(keys ...string) {
+	for _, key := range sortedUniqueKeys(keys) {
+		rd.UnLockKey(key)
+	}
+}
+
+func sortedUniqueKeys(keys []string) []string {
+	unique := make(map[string]struct{}, len(keys))
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := unique[key]; ok {
+			continue
+		}
+		unique[key] = struct{}{}
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// 和当前 db 属于同一个 RedisDBs 的编号为 index 的 db，不存在时返回 nil
+func (rd *RedisDB) GetDB(index int) *RedisDB {
+	if index == rd.Index {
+		return rd
+	}
+	if rd.dbs == nil || index < 0 || index >= len(rd.dbs.DBs) {
+		return nil
+	}
+	return rd.dbs.DBs[index]
+}
+
+// key 被修改之后调用，watch 了 key 的客户端执行 exec 时会失败
+// Exec 会标记写命令访问的所有 key，修改了其他 db 中 key 的命令（比如 move、copy db）需要自己调用
+func (rd *RedisDB) SignalModifiedKey(key string) {
+	rd.setWatchedKeyClientCASDirty(key)
+}
+
+// 删除 key 以及它的过期时间和元数据，比如 list 中的元素全部被弹出之后需要删除 key
+func (rd *RedisDB) Remove(key string) {
+	rd.Dataset.Del(key)
+	rd.TtlMap.Del(key)
+	rd.removeObjectMeta(key)
+}
+
+// 客户端 watch key，同时记录在连接中，取消 watch 的时候只删除这个客户端的记录
 func (rd *RedisDB) AddWatchKey(conn conn.Conn, key string) {
+	rd.watchLock.Lock()
+	defer rd.watchLock.Unlock()
 
-	var link *list.List
-	val, exist := rd.WatchedKeys.Load(key)
+	link, exist := rd.watchedKeys[key]
 	if !exist {
 		link = list.MakeList()
-	} else {
-		link = val.(*list.List)
+		rd.watchedKeys[key] = link
+	}
+	if link.Exist(conn) {
+		return
+	}
+	link.InsertLast(conn)
+	if redisConn, ok := conn.(*RedisConn); ok {
+		redisConn.watchedKeys = append(redisConn.watchedKeys, watchedKey{db: rd, key: key})
 	}
-	link.InsertIfNotExist(conn)
-	rd.WatchedKeys.Store(key, link)
 }
 
+// 删除客户端对 key 的 watch，没有客户端 watch 的 key 从字典中删除
 func (rd *RedisDB) RemoveWatchKey(conn conn.Conn, key string) {
-	var link *list.List
-	val, exist := rd.WatchedKeys.Load(key)
+	rd.watchLock.Lock()
+	defer rd.watchLock.Unlock()
+
+	link, exist := rd.watchedKeys[key]
 	if !exist {
-		link = list.MakeList()
-	} else {
-		link = val.(*list.List)
+		return
 	}
 	link.Remove(conn)
+	if link.Len() == 0 {
+		delete(rd.watchedKeys, key)
+	}
 }
 
-func (rd *RedisDB) RemoveAllWatchKey() {
-	rd.WatchedKeys = sync.Map{}
+// 清空 db 中所有的 key，watch 了其中存在的 key 的客户端执行 exec 时会失败
+// 调用方需要独占 server，清空期间不能有其他命令访问 db
+func (rd *RedisDB) Flush() {
+	rd.watchLock.Lock()
+	for key, link := range rd.watchedKeys {
+		if _, exist := rd.Dataset.Get(key); exist {
+			setClientsCASDirty(link)
+		}
+	}
+	rd.watchLock.Unlock()
+
+	rd.Dataset.Clear()
+	rd.TtlMap.Clear()
+	rd.objects.Clear()
+	atomic.StoreInt64(&rd.usedMemory, 0)
 }
 
 ////////////////
 type RedisDBs struct {
 	DBs     []*RedisDB
 	DBCount int
+
+	cowLock      sync.Mutex
+	cowRefs      map[interface{}]int // 被快照引用的 value 以及引用它的快照个数，写命令修改之前需要先拷贝
+	snapshotting int32               // 还没有 release 的快照个数，原子访问，写命令通过它快速判断是否需要拷贝
+}
+
+// 所有 db 执行成功的写命令总数
+func (rds *RedisDBs) Dirty() int64 {
+	dirty := int64(0)
+	for _, db := range rds.DBs {
+		dirty += atomic.LoadInt64(&db.dirty)
+	}
+	return dirty
 }
 
 func NewDBs() *RedisDBs {
@@ -181,10 +392,12 @@ func NewDBs() *RedisDBs {
 	rds := &RedisDBs{
 		DBs:     make([]*RedisDB, dbCount),
 		DBCount: dbCount,
+		cowRefs: make(map[interface{}]int),
 	}
 
 	for i := 0; i < dbCount; i++ {
 		rds.DBs[i] = NewDBInstance(i)
+		rds.DBs[i].dbs = rds
 	}
 	return rds
 }
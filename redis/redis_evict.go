@@ -0,0 +1,202 @@
+package redis
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/interface/response"
+	"github.com/chenjiayao/goredistraning/lib/dict"
+	"github.com/chenjiayao/goredistraning/redis/resp"
+)
+
+// 超过 maxmemory 时淘汰 key：
+// 1. 写命令执行之前检查内存占用，超过 maxmemory 时按照 maxmemory-policy 淘汰 key，直到不再超过
+// 2. 每次淘汰从每个 db 中抽样 maxmemory-samples 个 key，淘汰其中最合适的一个，和 redis 一样是近似的 lru、lfu、ttl
+// 3. 没有可以淘汰的 key（比如 noeviction）时，可能增加内存的命令返回 OOM 错误
+// 淘汰的 key 和过期删除一样以 del 写入 aof
+
+const minMaxmemorySamples = 1 // maxmemory-samples 的下限，和 redis 一致
+
+const oomError = "OOM command not allowed when used memory > 'maxmemory'."
+
+// 命令执行之前检查内存，返回 nil 表示可以执行命令
+// 写命令执行之前超过 maxmemory 时淘汰 key，淘汰之后仍然超过 maxmemory 时拒绝可能增加内存的命令
+func (redisServer *RedisServer) processMaxmemory(redisClient *RedisConn, cmdName string) response.Response {
+	if config.Config.Maxmemory <= 0 {
+		return nil
+	}
+	if _, exist := CommandTables[cmdName]; !exist {
+		return nil
+	}
+	denyOOM := isDenyOOM(redisClient, cmdName)
+	if _, write := WriteCommands[cmdName]; !write && !denyOOM {
+		return nil
+	}
+	if redisServer.performEvictions() || !denyOOM {
+		return nil
+	}
+	//和校验失败一样，事务中的命令被拒绝之后 exec 返回 EXECABORT
+	if redisClient.IsInMultiState() && cmdName != Exec {
+		redisClient.SetMultiState(int(InMultiStateButHaveError))
+	}
+	return resp.MakeErrorResponse(oomError)
+}
+
+// 内存不足时是否拒绝执行命令
+// 1. 事务中排队的命令都会占用内存，除了 exec 和 discard 都拒绝
+// 2. exec 中有可能增加内存的命令时拒绝
+func isDenyOOM(redisClient *RedisConn, cmdName string) bool {
+	if cmdName == Exec {
+		for _, cmd := range redisClient.GetMultiCmds() {
+			if _, ok := DenyOOMCommands[strings.ToLower(string(cmd[0]))]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	if redisClient.IsInMultiState() {
+		return cmdName != Discard
+	}
+	_, ok := DenyOOMCommands[cmdName]
+	return ok
+}
+
+// 按照 maxmemory-policy 淘汰 key，直到估算的内存占用不超过 maxmemory，返回淘汰之后是否不再超过 maxmemory
+// 调用方需要持有 server 的锁
+func (redisServer *RedisServer) performEvictions() bool {
+	maxmemory := config.Config.Maxmemory
+	if maxmemory <= 0 {
+		return true
+	}
+	//多个客户端同时淘汰时只需要一个客户端淘汰就够了
+	redisServer.evictionLock.Lock()
+	defer redisServer.evictionLock.Unlock()
+
+	policy := maxmemoryPolicy()
+	for redisServer.rds.UsedMemory() > maxmemory {
+		db, key, ok := redisServer.evictionCandidate(policy)
+		if !ok {
+			return false
+		}
+		if !db.evict(key) {
+			continue
+		}
+		if redisServer.aofHandler != nil {
+			redisServer.aofHandler.LogCmd(db.Index, makeDelCmd(key))
+		}
+	}
+	return true
+}
+
+// 按照 policy 选出下一个淘汰的 key，没有可以淘汰的 key 时返回 false
+func (redisServer *RedisServer) evictionCandidate(policy string) (*RedisDB, string, bool) {
+	if policy == config.MaxmemoryPolicyNoeviction {
+		return nil, "", false
+	}
+	volatile := strings.HasPrefix(policy, "volatile-")
+
+	//随机淘汰：从 evictNextDB 开始依次找到第一个不为空的 db，随机淘汰其中一个 key
+	if policy == config.MaxmemoryPolicyAllkeysRandom || policy == config.MaxmemoryPolicyVolatileRandom {
+		dbCount := len(redisServer.rds.DBs)
+		for i := 0; i < dbCount; i++ {
+			db := redisServer.rds.DBs[redisServer.evictNextDB]
+			redisServer.evictNextDB = (redisServer.evictNextDB + 1) % dbCount
+			if keys := db.evictionPool(volatile).RandomKeys(1); len(keys) > 0 {
+				return db, keys[0], true
+			}
+		}
+		return nil, "", false
+	}
+
+	//其他策略：每个 db 抽样 maxmemory-samples 个 key，淘汰分数最高的
+	var bestDB *RedisDB
+	bestKey := ""
+	bestScore := int64(math.MinInt64)
+	now := time.Now()
+	for _, db := range redisServer.rds.DBs {
+		for _, key := range db.evictionPool(volatile).RandomDistinctKeys(maxmemorySamples()) {
+			score, ok := db.evictionScore(key, policy, now)
+			if ok && (bestDB == nil || score > bestScore) {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+	}
+	return bestDB, bestKey, bestDB != nil
+}
+
+// volatile 策略只从设置了过期时间的 key 中淘汰
+func (rd *RedisDB) evictionPool(volatile bool) *dict.ConcurrentDict {
+	if volatile {
+		return rd.TtlMap
+	}
+	return rd.Dataset
+}
+
+// key 的淘汰分数，分数越高越先淘汰，key 不存在时返回 false
+// lru：空闲时间越长分数越高，lfu：访问频率越低分数越高，ttl：越早过期分数越高
+func (rd *RedisDB) evictionScore(key string, policy string, now time.Time) (int64, bool) {
+	if policy == config.MaxmemoryPolicyVolatileTTL {
+		expireAt, ok := rd.TtlMap.Get(key)
+		if !ok {
+			return 0, false
+		}
+		return -expireAt.(int64), true
+	}
+
+	v, ok := rd.objects.Get(key)
+	if !ok {
+		//还没有元数据的 key 当作刚刚访问过
+		if _, exist := rd.Dataset.Get(key); !exist {
+			return 0, false
+		}
+		v = newObjectMeta(now)
+	}
+	meta := v.(*objectMeta)
+	if policy == config.MaxmemoryPolicyAllkeysLFU || policy == config.MaxmemoryPolicyVolatileLFU {
+		return int64(255 - int(meta.lfuCounter(now))), true
+	}
+	return int64(meta.idleTime(now)), true
+}
+
+// 淘汰 key，key 已经不存在时返回 false
+func (rd *RedisDB) evict(key string) bool {
+	rd.LockKey(key)
+	defer rd.UnLockKey(key)
+
+	if _, exist := rd.Dataset.Get(key); !exist {
+		return false
+	}
+	rd.Remove(key)
+	rd.SignalModifiedKey(key)
+	return true
+}
+
+// 配置的 maxmemory-policy，没有配置或者不认识的策略当作 noeviction
+func maxmemoryPolicy() string {
+	policy := strings.ToLower(config.Config.MaxmemoryPolicy)
+	switch policy {
+	case config.MaxmemoryPolicyAllkeysLRU, config.MaxmemoryPolicyVolatileLRU,
+		config.MaxmemoryPolicyAllkeysLFU, config.MaxmemoryPolicyVolatileLFU,
+		config.MaxmemoryPolicyAllkeysRandom, config.MaxmemoryPolicyVolatileRandom,
+		config.MaxmemoryPolicyVolatileTTL:
+		return policy
+	default:
+		return config.MaxmemoryPolicyNoeviction
+	}
+}
+
+// 是否是 lfu 策略，object idletime 和 object freq 根据它决定返回哪个计数器
+func IsLFUPolicy() bool {
+	policy := maxmemoryPolicy()
+	return policy == config.MaxmemoryPolicyAllkeysLFU || policy == config.MaxmemoryPolicyVolatileLFU
+}
+
+// 配置的 maxmemory-samples，不能小于 minMaxmemorySamples，没有配置时 parseConfig 使用默认值
+func maxmemorySamples() int {
+	if config.Config.MaxmemorySamples < minMaxmemorySamples {
+		return minMaxmemorySamples
+	}
+	return config.Config.MaxmemorySamples
+}
@@ -0,0 +1,74 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+)
+
+const oomReply = "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+
+// noeviction：超过 maxmemory 之后拒绝可能增加内存的命令，读命令和删除命令正常执行
+func TestMaxmemory_Noeviction(t *testing.T) {
+	startServer(t)
+	c := connectClient(t)
+	c.send("SET a 1")
+	c.expect(t, "+OK\r\n")
+	c.send("RPUSH list x")
+	c.expect(t, ":1\r\n")
+
+	config.Config.Maxmemory = 1
+	config.Config.MaxmemoryPolicy = config.MaxmemoryPolicyNoeviction
+	c.send("SET b 1")
+	c.expect(t, oomReply)
+	c.send("RPUSH list y")
+	c.expect(t, oomReply)
+	c.send("GET a")
+	c.expect(t, "$1\r\n1\r\n")
+	c.send("LPOP list")
+	c.expect(t, "$1\r\nx\r\n")
+
+	//事务中排队的命令都会占用内存，只有 exec 和 discard 不会被拒绝
+	c.send("MULTI")
+	c.expect(t, "+OK\r\n")
+	c.send("GET a")
+	c.expect(t, oomReply)
+	c.send("EXEC")
+	c.expect(t, "-EXECABORT Transaction discarded because of previous errors.\r\n")
+
+	//删除 key 之后不再超过 maxmemory
+	c.send("DEL a")
+	c.expect(t, ":1\r\n")
+	c.send("SET b 1")
+	c.expect(t, "+OK\r\n")
+}
+
+// allkeys-lru：写命令执行之前淘汰最久没有访问的 key
+func TestMaxmemory_AllkeysLRU(t *testing.T) {
+	startServer(t)
+	c := connectClient(t)
+
+	for _, cmd := range []string{"SET key0 value", "SET key1 value", "SET key2 value"} {
+		c.send(cmd)
+		c.expect(t, "+OK\r\n")
+		time.Sleep(2 * time.Millisecond)
+	}
+	c.send("GET key0")
+	c.expect(t, "$5\r\nvalue\r\n")
+	time.Sleep(2 * time.Millisecond)
+
+	//每个 key 估算的内存占用是 len(key) + 96 + len(value) + 16 = 121，最多保留 3 个 key
+	config.Config.Maxmemory = 3 * 121
+	config.Config.MaxmemoryPolicy = config.MaxmemoryPolicyAllkeysLRU
+	config.Config.MaxmemorySamples = 10
+	c.send("SET key3 value")
+	c.expect(t, "+OK\r\n")
+	c.send("SET key4 value")
+	c.expect(t, "+OK\r\n")
+
+	c.send("EXISTS key1")
+	c.expect(t, ":0\r\n")
+	c.send("EXISTS key0 key2 key3 key4")
+	c.expect(t, ":4\r\n")
+}
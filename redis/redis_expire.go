@@ -0,0 +1,247 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/interface/conn"
+)
+
+// 过期 key 的删除有两种方式：
+// 1. 惰性删除：命令执行之前检查命令访问的 key，已经过期的直接删除
+// 2. 定期删除：每秒执行 hz 次，每次从每个 db 的 TtlMap 中随机抽取 key，删除其中已经过期的
+// 两种方式删除 key 之后都会在 aof 中记录 del，重放时不依赖执行 aof 的时间
+
+const (
+	activeExpireCycleKeysPerLoop     = 20  // 每一轮抽取的 key 个数
+	activeExpireCycleAcceptableStale = 25  // 一轮中过期 key 的比例超过这个百分比时，继续抽取下一轮
+	activeExpireCycleSlowTimePerc    = 25  // 每次定期删除最多占用 1/hz 秒的百分比
+	minHz                            = 1   // hz 的下限，和 redis 一致
+	maxHz                            = 500 // hz 的上限，和 redis 一致
+)
+
+// 命令访问的 key，不在这里的命令第一个参数是 key
+var commandKeys = map[string]func(args [][]byte) []string{
+	Multi:        noKeys,
+	Discard:      noKeys,
+	Exec:         noKeys,
+	Auth:         noKeys,
+	Hello:        noKeys,
+	Config:       noKeys,
+	Select:       noKeys,
+	Bgrewriteaof: noKeys,
+	Save:         noKeys,
+	Bgsave:       noKeys,
+	Lastsave:     noKeys,
+	Randomkey:    noKeys,
+	Scan:         noKeys,
+	Keys:         noKeys,
+	Unwatch:      noKeys,
+	Flushdb:      noKeys,
+	Flushall:     noKeys,
+
+	Del:         allArgsAsKeys,
+	Unlink:      allArgsAsKeys,
+	Exists:      allArgsAsKeys,
+	Touch:       allArgsAsKeys,
+	Mget:        allArgsAsKeys,
+	Watch:       allArgsAsKeys,
+	Sdiff:       allArgsAsKeys,
+	Sdiffstore:  allArgsAsKeys,
+	Sinter:      allArgsAsKeys,
+	Sinterstore: allArgsAsKeys,
+	Sunion:      allArgsAsKeys,
+	Sunionstore: allArgsAsKeys,
+
+	Mset:   pairArgsAsKeys,
+	Msetnx: pairArgsAsKeys,
+
+	Rename:    firstTwoArgsAsKeys,
+	Renamenx:  firstTwoArgsAsKeys,
+	Copy:      firstTwoArgsAsKeys,
+	Rpoplpush: firstTwoArgsAsKeys,
+	Lmove:     firstTwoArgsAsKeys,
+	Blmove:    firstTwoArgsAsKeys,
+	Smove:     firstTwoArgsAsKeys,
+
+	//最后一个参数是 timeout
+	Blpop: func(args [][]byte) []string { return argsAsKeys(args[:len(args)-1]) },
+	Brpop: func(args [][]byte) []string { return argsAsKeys(args[:len(args)-1]) },
+
+	//sintercard numkeys key [key ...] [LIMIT limit]
+	Sintercard: func(args [][]byte) []string {
+		numKeys, _ := strconv.Atoi(string(args[0]))
+		return argsAsKeys(args[1 : 1+numKeys])
+	},
+	//object subcommand key
+	Object: func(args [][]byte) []string { return argsAsKeys(args[1:2]) },
+}
+
+func noKeys(args [][]byte) []string {
+	return nil
+}
+
+func allArgsAsKeys(args [][]byte) []string {
+	return argsAsKeys(args)
+}
+
+// mset key value [key value ...]
+func pairArgsAsKeys(args [][]byte) []string {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys
+}
+
+func firstTwoArgsAsKeys(args [][]byte) []string {
+	return argsAsKeys(args[:2])
+}
+
+func argsAsKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys
+}
+
+// 命令访问的 key
+func keysOfCommand(cmdName string, args [][]byte) []string {
+	if keysOf, ok := commandKeys[cmdName]; ok {
+		return keysOf(args)
+	}
+	if len(args) > 0 {
+		return firstArgAsKey(args)
+	}
+	return nil
+}
+
+// 命令执行之前删除命令访问的已经过期的 key
+func (rd *RedisDB) expireCommandKeys(c conn.Conn, keys []string) {
+	if rd.TtlMap.Len() == 0 {
+		return
+	}
+	for _, key := range keys {
+		rd.ExpireIfNeeded(c, key)
+	}
+}
+
+// key 已经过期时删除 key，返回是否删除了
+// 删除的 key 以 del 记录到执行命令的连接中，和命令一起写入 aof，写入的 db 是 key 所在的 db
+// 访问其他 db 中 key 的命令（比如 move、copy db）在加锁之前调用
+func (rd *RedisDB) ExpireIfNeeded(c conn.Conn, key string) bool {
+	rd.LockKey(key)
+	removed := rd.removeIfExpired(key, time.Now().UnixMilli())
+	rd.UnLockKey(key)
+	if !removed {
+		return false
+	}
+	if redisConn, ok := c.(*RedisConn); ok && redisConn != nil {
+		redisConn.propagate(rd.Index, makeDelCmd(key))
+	}
+	return true
+}
+
+// 调用方需要持有 key 的锁
+func (rd *RedisDB) removeIfExpired(key string, now int64) bool {
+	v, ok := rd.TtlMap.Get(key)
+	if !ok || v.(int64) > now {
+		return false
+	}
+	rd.Remove(key)
+	rd.SignalModifiedKey(key)
+	return true
+}
+
+// 定期删除：从 TtlMap 中随机抽取 key 删除已经过期的，过期比例高于 activeExpireCycleAcceptableStale 时继续抽取
+// 超过 deadline 之后停止，返回被删除的 key
+func (rd *RedisDB) activeExpireCycle(deadline time.Time) []string {
+	expired := make([]string, 0)
+	for rd.TtlMap.Len() > 0 {
+		sampled := 0
+		expiredInLoop := 0
+		now := time.Now().UnixMilli()
+		for _, key := range rd.TtlMap.RandomKeys(activeExpireCycleKeysPerLoop) {
+			sampled++
+			rd.LockKey(key)
+			if rd.removeIfExpired(key, now) {
+				expiredInLoop++
+				expired = append(expired, key)
+			}
+			rd.UnLockKey(key)
+		}
+
+		if sampled == 0 || expiredInLoop*100 <= sampled*activeExpireCycleAcceptableStale {
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+	return expired
+}
+
+// 每秒执行 hz 次定期删除，在 Close 中停止
+func (redisServer *RedisServer) startActiveExpireCycle() {
+	interval := time.Second / time.Duration(hz())
+	redisServer.expireStopped.Add(1)
+	go func() {
+		defer redisServer.expireStopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				redisServer.activeExpireCycle(interval * activeExpireCycleSlowTimePerc / 100)
+			case <-redisServer.expireStop:
+				return
+			}
+		}
+	}()
+}
+
+// 依次处理每个 db，所有 db 共用 timeLimit 的执行时间，超时之后下一次从没有处理的 db 开始
+// 执行期间持有 server 的读锁，不会和 save、exec 这类独占 server 的命令交替执行
+func (redisServer *RedisServer) activeExpireCycle(timeLimit time.Duration) {
+	redisServer.lock.RLock()
+	defer redisServer.lock.RUnlock()
+
+	deadline := time.Now().Add(timeLimit)
+	dbCount := len(redisServer.rds.DBs)
+	for i := 0; i < dbCount; i++ {
+		db := redisServer.rds.DBs[redisServer.expireNextDB]
+		redisServer.expireNextDB = (redisServer.expireNextDB + 1) % dbCount
+		for _, key := range db.activeExpireCycle(deadline) {
+			if redisServer.aofHandler != nil {
+				redisServer.aofHandler.LogCmd(db.Index, makeDelCmd(key))
+			}
+		}
+		if time.Now().After(deadline) {
+			return
+		}
+	}
+}
+
+func (redisServer *RedisServer) stopActiveExpireCycle() {
+	close(redisServer.expireStop)
+	redisServer.expireStopped.Wait()
+}
+
+func makeDelCmd(key string) [][]byte {
+	return [][]byte{[]byte(Del), []byte(key)}
+}
+
+// 配置的 hz，和 redis 一样超出范围时使用最近的边界值，没有配置时 parseConfig 使用默认值
+func hz() int {
+	hz := config.Config.Hz
+	if hz < minHz {
+		return minHz
+	}
+	if hz > maxHz {
+		return maxHz
+	}
+	return hz
+}
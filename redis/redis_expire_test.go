@@ -0,0 +1,61 @@
+package redis_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+)
+
+// 没有被访问的过期 key 由定期删除清理，删除的 key 和惰性删除一样以 del 写入 aof
+func TestActiveExpireCycle(t *testing.T) {
+	config.LoadDefaultConfig()
+	config.Config.Dir = filepath.Dir(writeAofFile(t, ""))
+	config.Config.Save = ""
+	config.Config.Appendonly = true
+	config.Config.Appendfsync = config.AppendfsyncAlways
+	config.Config.AppendFilename = filepath.Join(config.Config.Dir, "expire.aof")
+	config.Config.Hz = 100
+
+	server := redis.MakeRedisServer()
+	server.Log()
+	c := connectClient(t)
+	for i := 0; i < 50; i++ {
+		c.send(fmt.Sprintf("SET key%d v PX 10", i))
+		c.expect(t, "+OK\r\n")
+	}
+	c.send("SET persistent v")
+	c.expect(t, "+OK\r\n")
+
+	//不再访问这些 key，等待定期删除写入 aof
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		time.Sleep(20 * time.Millisecond)
+		content, _ := ioutil.ReadFile(config.Config.AppendFilename)
+		if strings.Count(string(content), "$3\r\ndel\r\n") == 50 || time.Now().After(deadline) {
+			break
+		}
+	}
+	server.Close()
+
+	content, err := ioutil.ReadFile(config.Config.AppendFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(content), "$3\r\ndel\r\n"); got != 50 {
+		t.Errorf("aof should contain 50 del, got %d", got)
+	}
+
+	rds := redis.NewDBs()
+	if err := redis.LoadAof(config.Config.AppendFilename, rds); err != nil {
+		t.Fatalf("LoadAof() error = %v", err)
+	}
+	if n := rds.DBs[0].Dataset.Len(); n != 1 {
+		t.Errorf("db 0 should only have the persistent key after LoadAof, got %d keys", n)
+	}
+}
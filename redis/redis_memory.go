@@ -0,0 +1,263 @@
+package redis
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+)
+
+// 内存统计：
+// 1. 每个 key 的内存占用是估算值，集合类型抽样少量元素之后按照元素个数推算，和 redis 的 MEMORY USAGE 类似
+// 2. 写命令执行之后重新估算命令访问的 key，和上一次的估算值之差累加到 db 的 usedMemory 中
+// 3. 删除 key 时减去 key 的估算值，所有 db 的 usedMemory 之和就是和 maxmemory 比较的内存占用
+// 每个 key 同时记录最近一次访问的时间和访问频率，淘汰 key 时使用
+
+const (
+	memorySamples = 5 // 估算集合类型的内存时抽样的元素个数，和 redis 的 MEMORY USAGE 默认值一致
+
+	keyOverhead       = 96  // 每个 key 的固定开销：Dataset 和 objects 中的 entry、string header 以及 objectMeta
+	stringOverhead    = 16  // string header
+	containerOverhead = 64  // list、hash、set、sorted set 结构体本身
+	listEntryOverhead = 16  // quicklist 中每个元素的 string header
+	listpackOverhead  = 4   // listpack 编码的 hash 中每个 field 和 value 的长度信息
+	hashEntryOverhead = 64  // hashtable 编码的 hash 中每个 field 的 map entry 和 string header
+	intsetEntrySize   = 8   // intset 编码的 set 中每个 member 占用的内存
+	setEntryOverhead  = 48  // hashtable 编码的 set 中每个 member 的 map entry 和 string header
+	zsetEntryOverhead = 120 // sorted set 中每个 member 的 score、skiplist 节点以及 dict entry
+)
+
+const (
+	lfuInitVal   = 5  // 新 key 的访问频率计数器，避免新写入的 key 马上被淘汰
+	lfuLogFactor = 10 // 计数器增长的难度，和 redis 的 lfu-log-factor 默认值一致
+	lfuDecayTime = 1  // 没有访问时每过多少分钟计数器减一，和 redis 的 lfu-decay-time 默认值一致
+)
+
+// 不会更新 key 的访问时间和访问频率的命令，和 redis 中使用 LOOKUP_NOTOUCH 的命令一致
+var noTouchCommands = map[string]string{
+	Object:      Object,
+	Type:        Type,
+	Exists:      Exists,
+	TTL:         TTL,
+	Pttl:        Pttl,
+	Expiretime:  Expiretime,
+	Pexpiretime: Pexpiretime,
+	Watch:       Watch,
+}
+
+// key 的元数据，保存在 RedisDB 的 objects 中，只有存在的 key 才有元数据
+type objectMeta struct {
+	size  int64  // 最近一次估算的内存占用，调用方需要持有 key 的锁
+	atime int64  // 最近一次访问的时间，unix 毫秒，原子访问
+	lfu   uint64 // 高 32 位是计数器最近一次递减的时间（unix 分钟），低 8 位是对数计数器，原子访问
+}
+
+func newObjectMeta(now time.Time) *objectMeta {
+	return &objectMeta{
+		atime: now.UnixMilli(),
+		lfu:   makeLFU(now, lfuInitVal),
+	}
+}
+
+// 访问 key 时更新访问时间，访问频率计数器先按照经过的时间衰减，再按照对数增长
+func (meta *objectMeta) access(now time.Time) {
+	atomic.StoreInt64(&meta.atime, now.UnixMilli())
+	atomic.StoreUint64(&meta.lfu, makeLFU(now, lfuLogIncr(meta.lfuCounter(now))))
+}
+
+// 距离最近一次访问的时间
+func (meta *objectMeta) idleTime(now time.Time) time.Duration {
+	idle := now.UnixMilli() - atomic.LoadInt64(&meta.atime)
+	if idle < 0 {
+		return 0
+	}
+	return time.Duration(idle) * time.Millisecond
+}
+
+// 按照经过的时间衰减之后的访问频率计数器，每过 lfuDecayTime 分钟减一
+func (meta *objectMeta) lfuCounter(now time.Time) uint8 {
+	lfu := atomic.LoadUint64(&meta.lfu)
+	counter := int64(lfu & 0xff)
+	periods := (now.Unix()/60 - int64(lfu>>32)) / lfuDecayTime
+	if periods >= counter {
+		return 0
+	}
+	if periods > 0 {
+		counter -= periods
+	}
+	return uint8(counter)
+}
+
+func makeLFU(now time.Time, counter uint8) uint64 {
+	return uint64(now.Unix()/60)<<32 | uint64(counter)
+}
+
+// 对数计数器：计数器越大，增长的概率越低，8 位就可以区分百万级别的访问次数
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	baseval := float64(counter) - lfuInitVal
+	if baseval < 0 {
+		baseval = 0
+	}
+	p := 1.0 / (baseval*lfuLogFactor + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
+// 估算 key 占用的内存，包括 key 本身、value 以及固定开销
+func objectMemory(key string, v interface{}) int64 {
+	size := int64(len(key)) + keyOverhead
+	switch val := v.(type) {
+	case string:
+		size += int64(len(val)) + stringOverhead
+	case *quicklist.QuickList:
+		size += containerOverhead + sampledMemory(int64(val.Len()), func(consumer func(size int64) bool) {
+			val.ForEach(0, func(index int, element string) bool {
+				return consumer(int64(len(element)) + listEntryOverhead)
+			})
+		})
+	case *hash.Hash:
+		overhead := int64(hashEntryOverhead)
+		if val.Encoding() == hash.EncodingListpack {
+			overhead = 2 * listpackOverhead
+		}
+		size += containerOverhead + sampledMemory(int64(val.Len()), func(consumer func(size int64) bool) {
+			val.ForEach(func(field, value string) bool {
+				return consumer(int64(len(field)+len(value)) + overhead)
+			})
+		})
+	case *set.Set:
+		if val.Encoding() == set.EncodingIntset {
+			size += containerOverhead + int64(val.Len())*intsetEntrySize
+			break
+		}
+		size += containerOverhead + sampledMemory(int64(val.Len()), func(consumer func(size int64) bool) {
+			val.ForEach(func(member string) bool {
+				return consumer(int64(len(member)) + setEntryOverhead)
+			})
+		})
+	case *sortedset.SortedSet:
+		size += containerOverhead + sampledMemory(val.Len(), func(consumer func(size int64) bool) {
+			val.ForEach(func(member string, score float64) bool {
+				return consumer(int64(len(member)) + zsetEntryOverhead)
+			})
+		})
+	}
+	return size
+}
+
+// forEach 依次返回每个元素占用的内存，抽样前 memorySamples 个元素，按照平均大小推算 n 个元素的总大小
+func sampledMemory(n int64, forEach func(consumer func(size int64) bool)) int64 {
+	if n == 0 {
+		return 0
+	}
+	sampled, total := int64(0), int64(0)
+	forEach(func(size int64) bool {
+		sampled++
+		total += size
+		return sampled < memorySamples
+	})
+	if sampled == 0 {
+		return 0
+	}
+	return total * n / sampled
+}
+
+// 命令执行之后更新命令访问的 key 的元数据：写命令重新估算内存占用，noTouchCommands 以外的命令更新访问时间和访问频率
+func (rd *RedisDB) updateObjects(cmdName string, keys []string) {
+	_, write := WriteCommands[cmdName]
+	_, noTouch := noTouchCommands[cmdName]
+	if !write && noTouch {
+		return
+	}
+	now := time.Now()
+	for _, key := range keys {
+		rd.LockKey(key)
+		if write {
+			rd.TrackMemory(key)
+		}
+		if !noTouch {
+			if meta := rd.objectMetaOf(key); meta != nil {
+				meta.access(now)
+			}
+		}
+		rd.UnLockKey(key)
+	}
+}
+
+// 重新估算 key 的内存占用，调用方需要持有 key 的锁
+// Exec 会处理写命令访问的 key，修改了其他 db 中 key 的命令（比如 move、copy db）以及加载 rdb 时需要自己调用
+func (rd *RedisDB) TrackMemory(key string) {
+	v, exist := rd.Dataset.Get(key)
+	if !exist {
+		rd.removeObjectMeta(key)
+		return
+	}
+	meta := rd.objectMetaOf(key)
+	size := objectMemory(key, v)
+	atomic.AddInt64(&rd.usedMemory, size-meta.size)
+	meta.size = size
+}
+
+// key 的元数据，key 存在但是还没有元数据时创建，key 不存在时返回 nil，调用方需要持有 key 的锁
+func (rd *RedisDB) objectMetaOf(key string) *objectMeta {
+	if v, ok := rd.objects.Get(key); ok {
+		return v.(*objectMeta)
+	}
+	if _, exist := rd.Dataset.Get(key); !exist {
+		return nil
+	}
+	meta := newObjectMeta(time.Now())
+	rd.objects.Put(key, meta)
+	return meta
+}
+
+// 删除 key 的元数据，同时减去 key 的内存占用，调用方需要持有 key 的锁
+func (rd *RedisDB) removeObjectMeta(key string) {
+	v, ok := rd.objects.Get(key)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&rd.usedMemory, -v.(*objectMeta).size)
+	rd.objects.Del(key)
+}
+
+// key 距离最近一次访问的时间，key 不存在时返回 false，调用方需要持有 key 的锁
+func (rd *RedisDB) ObjectIdleTime(key string) (time.Duration, bool) {
+	meta := rd.objectMetaOf(key)
+	if meta == nil {
+		return 0, false
+	}
+	return meta.idleTime(time.Now()), true
+}
+
+// key 的访问频率计数器，key 不存在时返回 false，调用方需要持有 key 的锁
+func (rd *RedisDB) ObjectFreq(key string) (int, bool) {
+	meta := rd.objectMetaOf(key)
+	if meta == nil {
+		return 0, false
+	}
+	return int(meta.lfuCounter(time.Now())), true
+}
+
+// db 中所有 key 估算的内存占用
+func (rd *RedisDB) UsedMemory() int64 {
+	return atomic.LoadInt64(&rd.usedMemory)
+}
+
+// 所有 db 估算的内存占用，和 maxmemory 比较
+func (rds *RedisDBs) UsedMemory() int64 {
+	used := int64(0)
+	for _, db := range rds.DBs {
+		used += db.UsedMemory()
+	}
+	return used
+}
@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+)
+
+func Test_objectMemory(t *testing.T) {
+	config.LoadDefaultConfig()
+
+	if got, want := objectMemory("key", "value"), int64(3+keyOverhead+5+stringOverhead); got != want {
+		t.Errorf("objectMemory(string) = %d, want %d", got, want)
+	}
+
+	//元素大小相同时抽样的估算值是准确的
+	l := quicklist.MakeQuickList()
+	for i := 0; i < 100; i++ {
+		l.PushBack(strings.Repeat("a", 10))
+	}
+	if got, want := objectMemory("key", l), int64(3+keyOverhead+containerOverhead+100*(10+listEntryOverhead)); got != want {
+		t.Errorf("objectMemory(list) = %d, want %d", got, want)
+	}
+
+	ints := set.MakeSet(512)
+	ints.Add("1")
+	ints.Add("2")
+	if got, want := objectMemory("key", ints), int64(3+keyOverhead+containerOverhead+2*intsetEntrySize); got != want {
+		t.Errorf("objectMemory(intset) = %d, want %d", got, want)
+	}
+
+	//不同类型的 value 都随着元素个数增长
+	values := []func(n int) interface{}{
+		func(n int) interface{} {
+			h := hash.MakeHash(128, 64)
+			for i := 0; i < n; i++ {
+				h.Set(fmt.Sprintf("field%d", i), "value")
+			}
+			return h
+		},
+		func(n int) interface{} {
+			s := set.MakeSet(0)
+			for i := 0; i < n; i++ {
+				s.Add(fmt.Sprintf("member%d", i))
+			}
+			return s
+		},
+		func(n int) interface{} {
+			z := sortedset.MakeSortedSet()
+			for i := 0; i < n; i++ {
+				z.Add(fmt.Sprintf("member%d", i), float64(i))
+			}
+			return z
+		},
+	}
+	for _, makeValue := range values {
+		small, large := objectMemory("key", makeValue(10)), objectMemory("key", makeValue(1000))
+		if large < small*50 {
+			t.Errorf("objectMemory(%T) with 1000 elements = %d, with 10 elements = %d", makeValue(1), large, small)
+		}
+	}
+}
+
+func TestRedisDB_TrackMemory(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := NewDBs()
+	db := rds.DBs[0]
+
+	db.Dataset.Put("a", "value")
+	db.TrackMemory("a")
+	l := quicklist.MakeQuickList()
+	l.PushBack("x")
+	rds.DBs[1].Dataset.Put("list", l)
+	rds.DBs[1].TrackMemory("list")
+	if got, want := rds.UsedMemory(), objectMemory("a", "value")+objectMemory("list", l); got != want {
+		t.Fatalf("UsedMemory() = %d, want %d", got, want)
+	}
+
+	//value 修改之后重新估算，只累加差值
+	db.Dataset.Put("a", strings.Repeat("v", 100))
+	db.TrackMemory("a")
+	if got, want := db.UsedMemory(), objectMemory("a", strings.Repeat("v", 100)); got != want {
+		t.Errorf("UsedMemory() after overwrite = %d, want %d", got, want)
+	}
+
+	db.Remove("a")
+	rds.DBs[1].Remove("list")
+	if got := rds.UsedMemory(); got != 0 {
+		t.Errorf("UsedMemory() after remove = %d, want 0", got)
+	}
+	if _, ok := db.ObjectIdleTime("a"); ok {
+		t.Errorf("ObjectIdleTime() of removed key should return false")
+	}
+}
+
+func Test_objectMeta_lfu(t *testing.T) {
+	now := time.Now()
+	meta := newObjectMeta(now)
+	if got := meta.lfuCounter(now); got != lfuInitVal {
+		t.Fatalf("lfuCounter() of new key = %d, want %d", got, lfuInitVal)
+	}
+
+	//计数器不超过 lfuInitVal 时每次访问都会增长
+	meta.access(now)
+	if got := meta.lfuCounter(now); got != lfuInitVal+1 {
+		t.Errorf("lfuCounter() after access = %d, want %d", got, lfuInitVal+1)
+	}
+
+	//对数增长：lfuLogFactor 为 10 时，访问一千次之后计数器大约是 18
+	for i := 0; i < 1000; i++ {
+		meta.access(now)
+	}
+	if got := meta.lfuCounter(now); got < 10 || got > 30 {
+		t.Errorf("lfuCounter() after 1000 accesses = %d, want about 18", got)
+	}
+
+	//每过 lfuDecayTime 分钟减一
+	counter := meta.lfuCounter(now)
+	if got := meta.lfuCounter(now.Add(3 * lfuDecayTime * time.Minute)); got != counter-3 {
+		t.Errorf("lfuCounter() after 3 decay periods = %d, want %d", got, counter-3)
+	}
+	if got := meta.lfuCounter(now.Add(24 * time.Hour)); got != 0 {
+		t.Errorf("lfuCounter() after a day = %d, want 0", got)
+	}
+
+	if got := meta.idleTime(now.Add(5 * time.Second)); got != 5*time.Second {
+		t.Errorf("idleTime() = %v, want 5s", got)
+	}
+}
+
+// 按照每种策略淘汰 key，直到不超过 maxmemory
+func TestRedisServer_performEvictions(t *testing.T) {
+	config.LoadDefaultConfig()
+	defer config.LoadDefaultConfig()
+
+	now := time.Now()
+	setup := func() *RedisServer {
+		server := &RedisServer{rds: NewDBs()}
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("key%d", i)
+			db := server.rds.DBs[i%2]
+			db.Dataset.Put(key, "value")
+			db.TrackMemory(key)
+			meta := db.objectMetaOf(key)
+			//编号越大的 key 越近访问过、访问越频繁、越晚过期
+			meta.atime = now.Add(time.Duration(i-10) * time.Minute).UnixMilli()
+			meta.lfu = makeLFU(now, uint8(10+i))
+			if i >= 5 {
+				db.TtlMap.Put(key, now.Add(time.Duration(i)*time.Hour).UnixMilli())
+			}
+		}
+		return server
+	}
+	keySize := objectMemory("key0", "value")
+
+	tests := []struct {
+		policy  string
+		evicted []string
+	}{
+		{config.MaxmemoryPolicyAllkeysLRU, []string{"key0", "key1", "key2"}},
+		{config.MaxmemoryPolicyAllkeysLFU, []string{"key0", "key1", "key2"}},
+		{config.MaxmemoryPolicyVolatileLRU, []string{"key5", "key6", "key7"}},
+		{config.MaxmemoryPolicyVolatileLFU, []string{"key5", "key6", "key7"}},
+		{config.MaxmemoryPolicyVolatileTTL, []string{"key5", "key6", "key7"}},
+	}
+	for _, tt := range tests {
+		server := setup()
+		config.Config.MaxmemoryPolicy = tt.policy
+		config.Config.MaxmemorySamples = 10
+		config.Config.Maxmemory = 7 * keySize
+		if !server.performEvictions() {
+			t.Errorf("%s: performEvictions() = false, want true", tt.policy)
+			continue
+		}
+		for _, key := range tt.evicted {
+			if _, exist := server.rds.DBs[0].Dataset.Get(key); exist {
+				t.Errorf("%s: %s should be evicted", tt.policy, key)
+			}
+			if _, exist := server.rds.DBs[1].Dataset.Get(key); exist {
+				t.Errorf("%s: %s should be evicted", tt.policy, key)
+			}
+		}
+		if got := server.rds.UsedMemory(); got != 7*keySize {
+			t.Errorf("%s: UsedMemory() = %d, want %d", tt.policy, got, 7*keySize)
+		}
+	}
+
+	//随机淘汰
+	for _, policy := range []string{config.MaxmemoryPolicyAllkeysRandom, config.MaxmemoryPolicyVolatileRandom} {
+		server := setup()
+		config.Config.MaxmemoryPolicy = policy
+		config.Config.Maxmemory = 7 * keySize
+		if !server.performEvictions() || server.rds.UsedMemory() > 7*keySize {
+			t.Errorf("%s: performEvictions() should evict keys until used memory <= maxmemory", policy)
+		}
+	}
+
+	//volatile 策略没有设置了过期时间的 key 可以淘汰时返回 false
+	server := setup()
+	config.Config.MaxmemoryPolicy = config.MaxmemoryPolicyVolatileLRU
+	config.Config.Maxmemory = 2 * keySize
+	if server.performEvictions() {
+		t.Errorf("performEvictions() = true, want false when no volatile key left")
+	}
+	if got := server.rds.UsedMemory(); got != 5*keySize {
+		t.Errorf("UsedMemory() = %d, want %d, only volatile keys should be evicted", got, 5*keySize)
+	}
+
+	server = setup()
+	config.Config.MaxmemoryPolicy = config.MaxmemoryPolicyNoeviction
+	if server.performEvictions() || server.rds.UsedMemory() != 10*keySize {
+		t.Errorf("performEvictions() should not evict keys with noeviction")
+	}
+}
@@ -0,0 +1,529 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	goatomic "github.com/chenjiayao/goredistraning/lib/atomic"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/logger"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+)
+
+// rdb 文件格式：
+// "GOREDIS" + 4 字节版本号
+// 每个 db：SELECTDB dbIndex，后面跟着这个 db 中所有的 key
+// 每个 key：[EXPIRETIME_MS 8 字节毫秒时间戳] 类型 key value
+// EOF + 8 字节 crc64 校验和（校验范围是校验和之前的所有内容）
+// 长度和整数使用 uvarint 编码，字符串使用 长度 + 内容 编码
+const (
+	rdbMagic   = "GOREDIS"
+	rdbVersion = "0001"
+
+	rdbOpExpireTimeMs = 0xFC
+	rdbOpSelectDB     = 0xFE
+	rdbOpEOF          = 0xFF
+
+	rdbTypeString = 0
+	rdbTypeList   = 1
+	rdbTypeSet    = 2
+	rdbTypeZSet   = 3
+	rdbTypeHash   = 4
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// 负责 rdb 文件的保存：save、bgsave 以及根据 save 规则自动保存
+type RdbHandler struct {
+	redisServer *RedisServer
+
+	saving        goatomic.Boolean
+	lastSave      int64 //上一次保存成功的 unix 时间戳（秒），原子访问
+	lastSaveDirty int64 //上一次保存时数据库的修改次数，原子访问
+	rules         []saveRule
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// save <seconds> <changes>：seconds 秒内至少有 changes 次修改时自动 bgsave
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+func MakeRdbHandler(redisServer *RedisServer) *RdbHandler {
+	return &RdbHandler{
+		redisServer: redisServer,
+		lastSave:    time.Now().Unix(),
+		rules:       parseSaveRules(config.Config.Save),
+		stop:        make(chan struct{}),
+	}
+}
+
+// "3600 1 300 100" ---> [{3600 1} {300 100}]，格式错误的规则直接忽略
+func parseSaveRules(s string) []saveRule {
+	fields := strings.Fields(s)
+	rules := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes <= 0 {
+			logger.Info(fmt.Sprintf("invalid save rule: %s %s", fields[i], fields[i+1]))
+			continue
+		}
+		rules = append(rules, saveRule{
+			seconds: seconds,
+			changes: changes,
+		})
+	}
+	return rules
+}
+
+func rdbFilename() string {
+	return filepath.Join(config.Config.Dir, config.Config.Dbfilename)
+}
+
+// 阻塞式保存，调用方需要持有 redisServer 的写锁
+func (h *RdbHandler) Save() error {
+	if h.saving.Get() {
+		return errors.New("ERR Background save already in progress")
+	}
+	dirty := h.redisServer.rds.Dirty()
+	snapshots := h.redisServer.rds.snapshot()
+	defer h.redisServer.rds.release(snapshots)
+	err := writeRdbFile(rdbFilename(), snapshots)
+	if err != nil {
+		logger.Error("save rdb failed: ", err.Error())
+		return fmt.Errorf("ERR %s", err.Error())
+	}
+	h.saveSucceed(dirty)
+	return nil
+}
+
+// 在后台保存：先暂停所有命令生成快照，之后在后台把快照写入文件
+// 生成快照时只遍历 key，不会拷贝 value，写入文件期间被修改的 value 通过 copy-on-write 拷贝，所以暂停的时间和 value 的大小无关
+func (h *RdbHandler) BgSave() error {
+	if !h.saving.CompareAndSwap(false, true) {
+		return errors.New("ERR Background save already in progress")
+	}
+
+	h.stopped.Add(1)
+	go func() {
+		defer h.stopped.Done()
+		defer h.saving.Set(false)
+
+		h.redisServer.lock.Lock()
+		snapshots := h.redisServer.rds.snapshot()
+		dirty := h.redisServer.rds.Dirty()
+		h.redisServer.lock.Unlock()
+		defer h.redisServer.rds.release(snapshots)
+
+		err := writeRdbFile(rdbFilename(), snapshots)
+		if err != nil {
+			logger.Error("background save rdb failed: ", err.Error())
+			return
+		}
+		h.saveSucceed(dirty)
+		logger.Info("background saving terminated with success")
+	}()
+	return nil
+}
+
+func (h *RdbHandler) saveSucceed(dirty int64) {
+	atomic.StoreInt64(&h.lastSaveDirty, dirty)
+	atomic.StoreInt64(&h.lastSave, time.Now().Unix())
+}
+
+func (h *RdbHandler) LastSave() int64 {
+	return atomic.LoadInt64(&h.lastSave)
+}
+
+// 上一次保存之后数据库的修改次数
+func (h *RdbHandler) changesSinceLastSave() int64 {
+	return h.redisServer.rds.Dirty() - atomic.LoadInt64(&h.lastSaveDirty)
+}
+
+// 每秒检查一次 save 规则，满足任意一条就执行 bgsave
+func (h *RdbHandler) StartSaveCron() {
+	if len(h.rules) == 0 {
+		return
+	}
+
+	h.stopped.Add(1)
+	go func() {
+		defer h.stopped.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.checkSaveRules()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *RdbHandler) checkSaveRules() {
+	if h.saving.Get() {
+		return
+	}
+	changes := h.changesSinceLastSave()
+	elapsed := time.Now().Unix() - h.LastSave()
+	for _, rule := range h.rules {
+		if changes >= rule.changes && elapsed >= rule.seconds {
+			logger.Info(fmt.Sprintf("%d changes in %d seconds. Saving...", changes, rule.seconds))
+			h.BgSave()
+			return
+		}
+	}
+}
+
+// 停止自动保存，等待正在进行的 bgsave 完成
+// 如果配置了 save 规则，并且有未保存的修改，那么关闭之前保存一次
+func (h *RdbHandler) Close() {
+	close(h.stop)
+	h.stopped.Wait()
+
+	if len(h.rules) > 0 && h.changesSinceLastSave() > 0 {
+		h.redisServer.lock.Lock()
+		h.Save()
+		h.redisServer.lock.Unlock()
+	}
+}
+
+// 先写入临时文件，写入成功之后再替换掉原来的 rdb 文件
+func writeRdbFile(filename string, snapshots []*dbSnapshot) error {
+	tmpFilename := filepath.Join(filepath.Dir(filename), fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+	file, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	err = encodeRdb(writer, snapshots)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFilename, filename)
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+	}
+	return err
+}
+
+func encodeRdb(w io.Writer, snapshots []*dbSnapshot) error {
+	hash := crc64.New(crcTable)
+	encoder := &rdbEncoder{
+		w: io.MultiWriter(w, hash),
+	}
+
+	encoder.writeBytes([]byte(rdbMagic + rdbVersion))
+	for _, snapshot := range snapshots {
+		if len(snapshot.entries) == 0 {
+			continue
+		}
+		encoder.writeByte(rdbOpSelectDB)
+		encoder.writeUvarint(uint64(snapshot.index))
+
+		for _, entry := range snapshot.entries {
+			if entry.expireAt != -1 {
+				encoder.writeByte(rdbOpExpireTimeMs)
+				encoder.writeUint64(uint64(entry.expireAt))
+			}
+			encoder.writeEntry(entry)
+		}
+	}
+	encoder.writeByte(rdbOpEOF)
+	if encoder.err != nil {
+		return encoder.err
+	}
+
+	checksum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(checksum, hash.Sum64())
+	_, err := w.Write(checksum)
+	return err
+}
+
+// 写入出错之后，后续的写入都会被忽略，最后检查 err 即可
+type rdbEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *rdbEncoder) writeBytes(b []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(b)
+}
+
+func (e *rdbEncoder) writeByte(b byte) {
+	e.writeBytes([]byte{b})
+}
+
+func (e *rdbEncoder) writeUvarint(v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	e.writeBytes(buf[:n])
+}
+
+func (e *rdbEncoder) writeUint64(v uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	e.writeBytes(buf)
+}
+
+func (e *rdbEncoder) writeString(s []byte) {
+	e.writeUvarint(uint64(len(s)))
+	e.writeBytes(s)
+}
+
+func (e *rdbEncoder) writeEntry(entry *snapshotEntry) {
+	switch val := entry.value.(type) {
+	case string:
+		e.writeByte(rdbTypeString)
+		e.writeString([]byte(entry.key))
+		e.writeString([]byte(val))
+	case *set.Set:
+		e.writeByte(rdbTypeSet)
+		e.writeString([]byte(entry.key))
+		members := val.Members()
+		e.writeUvarint(uint64(len(members)))
+		for _, member := range members {
+			e.writeString(member)
+		}
+	case *quicklist.QuickList:
+		e.writeByte(rdbTypeList)
+		e.writeString([]byte(entry.key))
+		e.writeUvarint(uint64(val.Len()))
+		val.ForEach(0, func(index int, element string) bool {
+			e.writeString([]byte(element))
+			return true
+		})
+	case *hash.Hash:
+		e.writeByte(rdbTypeHash)
+		e.writeString([]byte(entry.key))
+		e.writeUvarint(uint64(val.Len()))
+		val.ForEach(func(field, value string) bool {
+			e.writeString([]byte(field))
+			e.writeString([]byte(value))
+			return true
+		})
+	case *sortedset.SortedSet:
+		e.writeByte(rdbTypeZSet)
+		e.writeString([]byte(entry.key))
+		e.writeUvarint(uint64(val.Len()))
+		val.ForEach(func(member string, score float64) bool {
+			e.writeString([]byte(member))
+			e.writeUint64(math.Float64bits(score))
+			return true
+		})
+	default:
+		logger.Error(fmt.Sprintf("rdb: unknown type of key %s, skipped", entry.key))
+	}
+}
+
+// 启动时加载 rdb 文件，文件不存在时直接返回
+func LoadRdb(filename string, rds *RedisDBs) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = decodeRdb(content, rds)
+	if err != nil {
+		return fmt.Errorf("bad rdb file %s: %s", filename, err.Error())
+	}
+	logger.Info(fmt.Sprintf("load rdb file %s", filename))
+	return nil
+}
+
+func decodeRdb(content []byte, rds *RedisDBs) error {
+	header := rdbMagic + rdbVersion
+	if len(content) < len(header)+1+8 || string(content[:len(header)]) != header {
+		return errors.New("wrong signature")
+	}
+
+	body := content[:len(content)-8]
+	checksum := binary.LittleEndian.Uint64(content[len(content)-8:])
+	if crc64.Checksum(body, crcTable) != checksum {
+		return errors.New("wrong checksum")
+	}
+
+	decoder := &rdbDecoder{
+		r: bytes.NewReader(body[len(header):]),
+	}
+	now := time.Now().UnixNano() / 1e6
+	var db *RedisDB
+	expireAt := int64(-1)
+
+	for {
+		op := decoder.readByte()
+		if decoder.err != nil {
+			return decoder.err
+		}
+
+		switch op {
+		case rdbOpEOF:
+			return nil
+		case rdbOpSelectDB:
+			dbIndex := int(decoder.readUvarint())
+			if decoder.err != nil {
+				return decoder.err
+			}
+			if dbIndex < 0 || dbIndex >= rds.DBCount {
+				return fmt.Errorf("db index %d out of range", dbIndex)
+			}
+			db = rds.DBs[dbIndex]
+		case rdbOpExpireTimeMs:
+			expireAt = int64(decoder.readUint64())
+		default:
+			key := string(decoder.readString())
+			val := decoder.readValue(op)
+			if decoder.err != nil {
+				return decoder.err
+			}
+			if db == nil {
+				return errors.New("key without select db")
+			}
+			if expireAt == -1 || expireAt > now {
+				db.Dataset.Put(key, val)
+				if expireAt != -1 {
+					db.TtlMap.Put(key, expireAt)
+				}
+				db.TrackMemory(key)
+			}
+			expireAt = -1
+		}
+	}
+}
+
+// 读取出错之后，后续的读取都返回零值，最后检查 err 即可
+type rdbDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *rdbDecoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+	return b
+}
+
+func (d *rdbDecoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+	return v
+}
+
+func (d *rdbDecoder) readUint64() uint64 {
+	buf := d.readN(8)
+	if d.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func (d *rdbDecoder) readN(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(d.r.Len()) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	buf := make([]byte, n)
+	io.ReadFull(d.r, buf)
+	return buf
+}
+
+func (d *rdbDecoder) readString() []byte {
+	return d.readN(d.readUvarint())
+}
+
+func (d *rdbDecoder) readValue(typ byte) interface{} {
+	switch typ {
+	case rdbTypeString:
+		return string(d.readString())
+	case rdbTypeList:
+		size := d.readUvarint()
+		l := quicklist.MakeQuickList()
+		for i := uint64(0); i < size && d.err == nil; i++ {
+			l.PushBack(string(d.readString()))
+		}
+		return l
+	case rdbTypeSet:
+		size := d.readUvarint()
+		s := set.MakeSet(config.Config.SetMaxIntsetEntries)
+		for i := uint64(0); i < size && d.err == nil; i++ {
+			s.Add(string(d.readString()))
+		}
+		return s
+	case rdbTypeZSet:
+		size := d.readUvarint()
+		z := sortedset.MakeSortedSet()
+		for i := uint64(0); i < size && d.err == nil; i++ {
+			member := d.readString()
+			score := math.Float64frombits(d.readUint64())
+			z.Add(string(member), score)
+		}
+		return z
+	case rdbTypeHash:
+		size := d.readUvarint()
+		h := hash.MakeHash(config.Config.HashMaxListpackEntries, config.Config.HashMaxListpackValue)
+		for i := uint64(0); i < size && d.err == nil; i++ {
+			field := d.readString()
+			value := d.readString()
+			h.Set(string(field), string(value))
+		}
+		return h
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown value type %d", typ)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+)
+
+func TestRdb_EncodeDecode(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := NewDBs()
+
+	now := time.Now().UnixNano() / 1e6
+	rds.DBs[0].Dataset.Put("string", "value\r\nwith crlf")
+	rds.DBs[0].Dataset.Put("ttl", "value")
+	rds.DBs[0].TtlMap.Put("ttl", now+100000)
+	s := set.MakeSet(2)
+	s.Add("a")
+	s.Add("b")
+	rds.DBs[5].Dataset.Put("set", s)
+	l := quicklist.MakeQuickList()
+	l.PushBack("a")
+	l.PushBack("b")
+	rds.DBs[5].Dataset.Put("list", l)
+	h := hash.MakeHash(128, 64)
+	h.Set("field", "value")
+	rds.DBs[5].Dataset.Put("hash", h)
+	z := sortedset.MakeSortedSet()
+	z.Add("a", 1.5)
+	z.Add("b", math.Inf(-1))
+	rds.DBs[5].Dataset.Put("zset", z)
+
+	var buf bytes.Buffer
+	err := encodeRdb(&buf, rds.snapshot())
+	if err != nil {
+		t.Fatalf("encodeRdb() error = %v", err)
+	}
+
+	loaded := NewDBs()
+	err = decodeRdb(buf.Bytes(), loaded)
+	if err != nil {
+		t.Fatalf("decodeRdb() error = %v", err)
+	}
+
+	v, _ := loaded.DBs[0].Dataset.Get("string")
+	if v != "value\r\nwith crlf" {
+		t.Errorf("string = %v, want %q", v, "value\r\nwith crlf")
+	}
+	ttl, _ := loaded.DBs[0].TtlMap.Get("ttl")
+	if ttl != now+100000 {
+		t.Errorf("ttl expireAt = %v, want %d", ttl, now+100000)
+	}
+	v, ok := loaded.DBs[5].Dataset.Get("set")
+	if !ok || v.(*set.Set).Len() != 2 || !v.(*set.Set).Exist("b") {
+		t.Errorf("set should be loaded into db 5")
+	}
+	v, ok = loaded.DBs[5].Dataset.Get("list")
+	if !ok || v.(*quicklist.QuickList).Len() != 2 || v.(*quicklist.QuickList).Get(1) != "b" {
+		t.Errorf("list should be loaded into db 5")
+	}
+	v, ok = loaded.DBs[5].Dataset.Get("hash")
+	if value, _ := v.(*hash.Hash).Get("field"); !ok || value != "value" {
+		t.Errorf("hash should be loaded into db 5")
+	}
+	v, ok = loaded.DBs[5].Dataset.Get("zset")
+	if score, _ := v.(*sortedset.SortedSet).Score("b"); !ok || !math.IsInf(score, -1) {
+		t.Errorf("sorted set should be loaded into db 5")
+	}
+}
+
+func TestRdb_DecodeCorrupted(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := NewDBs()
+	rds.DBs[0].Dataset.Put("key", "value")
+
+	var buf bytes.Buffer
+	encodeRdb(&buf, rds.snapshot())
+	content := buf.Bytes()
+
+	corrupted := append([]byte{}, content...)
+	corrupted[len(rdbMagic+rdbVersion)+3] ^= 0xFF
+	if err := decodeRdb(corrupted, NewDBs()); err == nil {
+		t.Errorf("decodeRdb() should return error when checksum mismatch")
+	}
+
+	if err := decodeRdb(content[:len(content)-3], NewDBs()); err == nil {
+		t.Errorf("decodeRdb() should return error when file is truncated")
+	}
+}
+
+func TestRdbHandler_Save(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rdb")
+	defer os.RemoveAll(dir)
+
+	config.LoadDefaultConfig()
+	config.Config.Dir = dir
+	server := &RedisServer{rds: NewDBs()}
+	server.rdbHandler = MakeRdbHandler(server)
+
+	server.rds.DBs[0].Dataset.Put("key", "value")
+	server.rds.DBs[0].dirty = 3
+	if server.rdbHandler.changesSinceLastSave() != 3 {
+		t.Errorf("changesSinceLastSave() = %d, want 3", server.rdbHandler.changesSinceLastSave())
+	}
+
+	err := server.Save()
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if server.rdbHandler.changesSinceLastSave() != 0 {
+		t.Errorf("changesSinceLastSave() = %d, want 0 after save", server.rdbHandler.changesSinceLastSave())
+	}
+
+	loaded := NewDBs()
+	err = LoadRdb(filepath.Join(dir, "dump.rdb"), loaded)
+	if err != nil {
+		t.Fatalf("LoadRdb() error = %v", err)
+	}
+	if v, _ := loaded.DBs[0].Dataset.Get("key"); v != "value" {
+		t.Errorf("loaded key = %v, want value", v)
+	}
+}
+
+// bgsave 写入文件之后释放快照，之后的写命令不需要再拷贝 value
+func TestRdbHandler_BgSave(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rdb")
+	defer os.RemoveAll(dir)
+
+	config.LoadDefaultConfig()
+	config.Config.Dir = dir
+	server := &RedisServer{rds: NewDBs()}
+	server.rdbHandler = MakeRdbHandler(server)
+
+	l := quicklist.MakeQuickList()
+	l.PushBack("a")
+	server.rds.DBs[0].Dataset.Put("list", l)
+	if err := server.BgSave(); err != nil {
+		t.Fatalf("BgSave() error = %v", err)
+	}
+	server.rdbHandler.Close()
+	if atomic.LoadInt32(&server.rds.snapshotting) != 0 {
+		t.Errorf("snapshot should be released after BgSave")
+	}
+
+	loaded := NewDBs()
+	if err := LoadRdb(filepath.Join(dir, "dump.rdb"), loaded); err != nil {
+		t.Fatalf("LoadRdb() error = %v", err)
+	}
+	if v, ok := loaded.DBs[0].Dataset.Get("list"); !ok || v.(*quicklist.QuickList).Get(0) != "a" {
+		t.Errorf("list should be saved by BgSave")
+	}
+}
+
+func Test_parseSaveRules(t *testing.T) {
+	rules := parseSaveRules("3600 1 300 abc 60 10000")
+	if len(rules) != 2 || rules[0].seconds != 3600 || rules[1].changes != 10000 {
+		t.Errorf("parseSaveRules() = %v, want [{3600 1} {60 10000}]", rules)
+	}
+}
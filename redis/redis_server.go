@@ -1,17 +1,21 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/interface/response"
 	"github.com/chenjiayao/goredistraning/interface/server"
 	"github.com/chenjiayao/goredistraning/lib/atomic"
+	"github.com/chenjiayao/goredistraning/lib/file"
 	"github.com/chenjiayao/goredistraning/lib/logger"
 	"github.com/chenjiayao/goredistraning/parser"
+	redisRequest "github.com/chenjiayao/goredistraning/redis/request"
 	"github.com/chenjiayao/goredistraning/redis/resp"
 )
 
@@ -22,19 +26,54 @@ type RedisServer struct {
 	closed     atomic.Boolean
 	rds        *RedisDBs
 	aofHandler *AofHandler
+	rdbHandler *RdbHandler
+
+	// 执行命令时持有读锁，需要获取所有 db 快照的时候（比如 bgrewriteaof）持有写锁
+	// ExclusiveCommands 中的命令执行时也持有写锁
+	lock sync.RWMutex
+
+	expireStop    chan struct{} // 关闭之后停止定期删除过期 key
+	expireStopped sync.WaitGroup
+	expireNextDB  int // 下一次定期删除从哪个 db 开始，只在定期删除的协程中访问
+
+	evictionLock sync.Mutex // 同一时间只有一个客户端在淘汰 key
+	evictNextDB  int        // 随机淘汰下一次从哪个 db 开始，持有 evictionLock 时访问
 }
 
+// redis server 是全局单例，bgrewriteaof 这类需要访问整个 server 的命令通过它来操作
+var ServerInstance *RedisServer
+
 ///////////启动 redis 服务，
-// 如果这里有 aof，那么需要加载 aof
+// 如果这里有 aof，那么需要加载 aof，没有 aof 的时候加载 rdb
 func MakeRedisServer() *RedisServer {
 	redisServer := &RedisServer{
-		closed: atomic.Boolean(0),
+		closed:     atomic.Boolean(0),
+		expireStop: make(chan struct{}),
 	}
 
 	redisServer.rds = NewDBs()
+
+	//先把 aof 或者 rdb 中的数据恢复到内存中，再开始接收连接
+	var err error
+	if config.Config.Appendonly && file.Exists(config.Config.AppendFilename) {
+		err = LoadAof(config.Config.AppendFilename, redisServer.rds)
+	} else {
+		err = LoadRdb(rdbFilename(), redisServer.rds)
+		if err == nil && config.Config.Appendonly {
+			err = writeAofBase(config.Config.AppendFilename, redisServer.rds)
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+
 	if config.Config.Appendonly {
 		redisServer.aofHandler = MakeAofHandler(redisServer)
 	}
+	redisServer.rdbHandler = MakeRdbHandler(redisServer)
+	redisServer.rdbHandler.StartSaveCron()
+	redisServer.startActiveExpireCycle()
+	ServerInstance = redisServer
 	return redisServer
 }
 
@@ -49,23 +88,35 @@ func (redisServer *RedisServer) Handle(conn net.Conn) {
 	}
 
 	redisClient := MakeRedisConn(conn)
+	//连接断开之后删除这个客户端 watch 的 key，不影响其他客户端
+	defer redisClient.Unwatch()
 
 	ch := parser.ReadCommand(conn)
-	//chan close 掉之后， range 直接退出
-	for request := range ch {
-		if request.Err != nil {
-			if request.Err == io.EOF {
-				redisServer.closeClient(redisClient)
+	//客户端阻塞期间读取到的下一条命令
+	var pending *redisRequest.RedisRequet
+	for {
+		var request redisRequest.RedisRequet
+		if pending != nil {
+			request, pending = *pending, nil
+		} else {
+			var ok bool
+			//chan close 掉之后直接退出
+			if request, ok = <-ch; !ok {
 				return
 			}
+		}
 
-			errResponse := resp.MakeErrorResponse(request.Err.Error())
-			err := redisClient.Write(errResponse.ToErrorByte()) //返回执行命令失败，close client
-			if err != nil {
-				logger.Info("response failed: " + redisClient.RemoteAddress())
-				redisServer.closeClient(redisClient)
-				return
+		//parser 出错之后就不再解析了，关闭连接
+		if request.Err != nil {
+			if isProtocolError(request.Err) {
+				//协议错误先回复客户端再关闭连接
+				errResponse := resp.MakeErrorResponse(request.Err.Error())
+				redisServer.sendResponse(redisClient, errResponse, false)
+			} else if request.Err == redisRequest.ErrQueryBufferLimit {
+				logger.Info(fmt.Sprintf("closing client %s that reached max query buffer length", redisClient.RemoteAddress()))
 			}
+			redisServer.closeClient(redisClient)
+			return
 		}
 
 		var res response.Response
@@ -75,9 +126,10 @@ func (redisServer *RedisServer) Handle(conn net.Conn) {
 		cmdName := redisServer.parseCommand(request.Args)
 		args := cmd[1:]
 
-		if cmdName != "auth" && !redisServer.isAuthenticated(redisClient) {
+		//hello 可以通过 AUTH 参数认证，是否认证在 hello 命令中判断
+		if cmdName != Auth && cmdName != Hello && !redisServer.isAuthenticated(redisClient) {
 			res = resp.MakeErrorResponse("NOAUTH Authentication required")
-			err := redisServer.sendResponse(redisClient, res)
+			err := redisServer.sendResponse(redisClient, res, request.Pending)
 			if err == io.EOF {
 				break
 			}
@@ -87,28 +139,89 @@ func (redisServer *RedisServer) Handle(conn net.Conn) {
 		selectedDBIndex := redisClient.GetSelectedDBIndex()
 		selectedDB := redisServer.rds.DBs[selectedDBIndex]
 
-		res = selectedDB.Exec(redisClient, cmdName, args)
-		err = redisServer.sendResponse(redisClient, res)
+		//命令的执行和写入 aof chan 需要在同一个读锁内，保证 aof 重写时快照和 aof chan 中的命令一致
+		var synced <-chan struct{}
+		unlock := redisServer.lockForCommand(cmdName)
+		//超过 maxmemory 时先淘汰 key，淘汰的 del 在命令之前写入 aof
+		if res = redisServer.processMaxmemory(redisClient, cmdName); res == nil {
+			res = selectedDB.Exec(redisClient, cmdName, args)
+		}
+		for _, propagated := range redisClient.takePropagated() {
+			if config.Config.Appendonly {
+				synced = redisServer.aofHandler.LogCmd(propagated.dbIndex, propagated.cmd)
+			}
+		}
+		//命令写入 aof 之后再唤醒阻塞的客户端，保证 aof 中 push 在 pop 之前
+		redisServer.serveBlockedClients(redisClient)
+
+		var bc *blockedClient
+		if blocked, ok := res.(*BlockedResponse); ok {
+			bc = selectedDB.block(redisClient, blocked)
+			//挂起之前 key 可能已经有元素了（比如 exec 中 push 之后再阻塞），立即尝试唤醒
+			readyKeys := make([]readyKey, 0, len(blocked.Keys))
+			for _, key := range blocked.Keys {
+				readyKeys = append(readyKeys, readyKey{db: selectedDB, key: key})
+			}
+			redisServer.serveReadyKeys(readyKeys)
+		}
+		unlock()
+
+		//appendfsync always：命令写入磁盘之后才能回复客户端
+		if synced != nil {
+			<-synced
+		}
 
-		if res.ISOK() && config.Config.Appendonly {
-			redisServer.aofHandler.LogCmd(request.Args)
+		if bc != nil {
+			//阻塞之前先把缓冲区中的回复发送出去
+			if redisClient.Flush() == io.EOF {
+				selectedDB.unblock(bc)
+				redisServer.closeClient(redisClient)
+				return
+			}
+			var closed bool
+			res, pending, closed = redisServer.waitUnblocked(bc, ch)
+			if closed {
+				redisServer.closeClient(redisClient)
+				return
+			}
 		}
+
+		err = redisServer.sendResponse(redisClient, res, request.Pending || pending != nil)
 		if err == io.EOF {
 			break
 		}
 	}
 }
 
+func isProtocolError(err error) bool {
+	_, ok := err.(*redisRequest.ProtocolError)
+	return ok
+}
+
+// ExclusiveCommands 中的命令持有写锁，其他命令持有读锁，返回解锁函数
+func (redisServer *RedisServer) lockForCommand(cmdName string) func() {
+	if _, exclusive := ExclusiveCommands[cmdName]; exclusive {
+		redisServer.lock.Lock()
+		return redisServer.lock.Unlock
+	}
+	redisServer.lock.RLock()
+	return redisServer.lock.RUnlock
+}
+
 func (redisServer *RedisServer) isAuthenticated(redisClient *RedisConn) bool {
 	return config.Config.RequirePass == redisClient.GetPassword()
 }
 
-func (redisServer *RedisServer) sendResponse(redisClient *RedisConn, res response.Response) error {
+// 回复先写入连接的缓冲区，pending 为 false 说明 parser 中没有待处理的命令了，把缓冲区中的回复一次性发送出去
+func (redisServer *RedisServer) sendResponse(redisClient *RedisConn, res response.Response, pending bool) error {
 	var err error
 	if _, ok := res.(resp.RedisErrorResponse); ok {
 		err = redisClient.Write(res.ToErrorByte())
 	} else {
-		err = redisClient.Write(res.ToContentByte())
+		err = redisClient.Write(resp.Encode(res, redisClient.GetProtocol()))
+	}
+	if err == nil && !pending {
+		err = redisClient.Flush()
 	}
 	if err == io.EOF {
 		redisServer.closeClient(redisClient)
@@ -128,8 +241,36 @@ func (redisServer *RedisServer) closeClient(client *RedisConn) {
 	client.Close()
 }
 
+// 后台重写 aof 文件
+func (redisServer *RedisServer) BgRewriteAof() error {
+	if redisServer.aofHandler == nil {
+		return errors.New("ERR appendonly is disabled")
+	}
+	return redisServer.aofHandler.BgRewrite()
+}
+
+// 阻塞式保存 rdb，只能在 save 命令中调用（执行时已经持有写锁）
+func (redisServer *RedisServer) Save() error {
+	return redisServer.rdbHandler.Save()
+}
+
+func (redisServer *RedisServer) BgSave() error {
+	return redisServer.rdbHandler.BgSave()
+}
+
+// 上一次成功保存 rdb 的 unix 时间戳
+func (redisServer *RedisServer) LastSave() int64 {
+	return redisServer.rdbHandler.LastSave()
+}
+
 func (redisServer *RedisServer) Close() error {
 	logger.Info("server close....")
-	redisServer.aofHandler.EndAof()
+	redisServer.closed.Set(true)
+	//先停止定期删除，它删除 key 之后还需要写入 aof
+	redisServer.stopActiveExpireCycle()
+	if redisServer.aofHandler != nil {
+		redisServer.aofHandler.EndAof()
+	}
+	redisServer.rdbHandler.Close()
 	return nil
 }
@@ -0,0 +1,114 @@
+package redis_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/redis"
+)
+
+func startServer(tb testing.TB) net.Conn {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	config.LoadDefaultConfig()
+	config.Config.Dir = dir
+	config.Config.Save = ""
+
+	server := redis.MakeRedisServer()
+	tb.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+		//Handle 都已经返回了，恢复测试中修改的配置
+		config.LoadDefaultConfig()
+	})
+	return handleConn(tb, server)
+}
+
+// 在 goroutine 中处理连接，测试结束时关闭连接并且等待 Handle 返回
+// 否则下一个测试修改 config.Config 时，上一个测试的 Handle 和 parser 可能还在读取
+func handleConn(tb testing.TB, server *redis.RedisServer) net.Conn {
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		server.Handle(conn)
+		close(done)
+	}()
+	tb.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return client
+}
+
+func TestRedisServer_Handle_Pipeline(t *testing.T) {
+	client := startServer(t)
+
+	go client.Write([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" +
+		"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n" +
+		"GET key\r\n"))
+
+	reader := bufio.NewReader(client)
+	want := []string{"+OK\r\n", "$5\r\n", "value\r\n", "$5\r\n", "value\r\n"}
+	for _, w := range want {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != w {
+			t.Fatalf("reply = %q, %v, want %q", line, err, w)
+		}
+	}
+}
+
+// 1000 条命令的 pipeline 的吞吐量
+func BenchmarkRedisServer_Pipeline(b *testing.B) {
+	const pipeline = 1000
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+
+	startServer(b)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go redis.ServerInstance.Handle(conn)
+		}
+	}()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+
+	var cmds bytes.Buffer
+	for i := 0; i < pipeline; i++ {
+		cmds.WriteString("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+	}
+	wantReplies := []byte(strings.Repeat("+OK\r\n", pipeline))
+	replies := make([]byte, len(wantReplies))
+	reader := bufio.NewReader(client)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		go client.Write(cmds.Bytes())
+		if _, err := io.ReadFull(reader, replies); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if !bytes.Equal(replies, wantReplies) {
+		b.Fatalf("unexpected replies")
+	}
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/lib/hash"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+	"github.com/chenjiayao/goredistraning/lib/sortedset"
+)
+
+// 某一时刻所有 db 的数据，bgrewriteaof、bgsave 在后台根据快照生成新的文件
+// 快照中的 value 和 db 共享，不会拷贝，写命令修改被快照引用的 value 之前会先拷贝一份放回 db 中（copy-on-write），
+// 所以后续对数据库的修改不会影响到快照，快照写入文件之后需要调用 release
+type dbSnapshot struct {
+	index   int
+	entries []*snapshotEntry
+}
+
+type snapshotEntry struct {
+	key      string
+	value    interface{}
+	expireAt int64 //过期时间（毫秒时间戳），-1 表示永不过期
+}
+
+// 生成所有 db 的快照，调用方需要持有 redisServer 的写锁，保证快照期间没有命令在执行
+// 生成快照只需要遍历所有的 key，不会拷贝 value，暂停命令的时间和 key 的个数成正比，和 value 的大小无关
+// 已经过期的 key 不会出现在快照中
+func (rds *RedisDBs) snapshot() []*dbSnapshot {
+	now := time.Now().UnixNano() / 1e6
+	snapshots := make([]*dbSnapshot, 0, rds.DBCount)
+
+	rds.cowLock.Lock()
+	defer rds.cowLock.Unlock()
+	atomic.AddInt32(&rds.snapshotting, 1)
+
+	for _, db := range rds.DBs {
+		ds := &dbSnapshot{
+			index:   db.Index,
+			entries: make([]*snapshotEntry, 0, db.Dataset.Len()),
+		}
+
+		db.Dataset.ForEach(func(key string, val interface{}) bool {
+			expireAt := int64(-1)
+			if v, ok := db.TtlMap.Get(key); ok {
+				expireAt = v.(int64)
+				if expireAt <= now {
+					return true
+				}
+			}
+			if isMutableValue(val) {
+				rds.cowRefs[val]++
+			}
+			ds.entries = append(ds.entries, &snapshotEntry{
+				key:      key,
+				value:    val,
+				expireAt: expireAt,
+			})
+			return true
+		})
+		snapshots = append(snapshots, ds)
+	}
+	return snapshots
+}
+
+// 快照已经写入文件，不再引用 db 中的 value，之后写命令可以直接修改这些 value
+func (rds *RedisDBs) release(snapshots []*dbSnapshot) {
+	rds.cowLock.Lock()
+	defer rds.cowLock.Unlock()
+
+	for _, snapshot := range snapshots {
+		for _, entry := range snapshot.entries {
+			if !isMutableValue(entry.value) {
+				continue
+			}
+			rds.cowRefs[entry.value]--
+			if rds.cowRefs[entry.value] <= 0 {
+				delete(rds.cowRefs, entry.value)
+			}
+		}
+	}
+	atomic.AddInt32(&rds.snapshotting, -1)
+}
+
+// 写命令修改 key 之前调用，key 的 value 被快照引用时，db 中换成一份拷贝，快照中的 value 不会再被修改
+// 每个 key 在快照写入文件期间最多拷贝一次
+func (rd *RedisDB) copyOnWrite(keys []string) {
+	rds := rd.dbs
+	if rds == nil || atomic.LoadInt32(&rds.snapshotting) == 0 {
+		return
+	}
+	for _, key := range keys {
+		rd.LockKey(key)
+		if v, exist := rd.Dataset.Get(key); exist && rds.isSnapshotted(v) {
+			rd.Dataset.Put(key, CopyValue(v))
+		}
+		rd.UnLockKey(key)
+	}
+}
+
+func (rds *RedisDBs) isSnapshotted(val interface{}) bool {
+	if !isMutableValue(val) {
+		return false
+	}
+	rds.cowLock.Lock()
+	defer rds.cowLock.Unlock()
+	return rds.cowRefs[val] > 0
+}
+
+// string 是不可变的，其他类型的 value 会被写命令直接修改
+func isMutableValue(val interface{}) bool {
+	switch val.(type) {
+	case *set.Set, *quicklist.QuickList, *hash.Hash, *sortedset.SortedSet:
+		return true
+	default:
+		return false
+	}
+}
+
+// 深拷贝 value，string 是不可变的，不需要拷贝，copy 命令也通过它拷贝 value
+func CopyValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *set.Set:
+		return v.Copy()
+	case *quicklist.QuickList:
+		return v.Copy()
+	case *hash.Hash:
+		return v.Copy()
+	case *sortedset.SortedSet:
+		return v.Copy()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/lib/quicklist"
+	"github.com/chenjiayao/goredistraning/lib/set"
+)
+
+func TestRedisDBs_snapshot(t *testing.T) {
+	config.LoadDefaultConfig()
+	rds := NewDBs()
+
+	now := time.Now().UnixNano() / 1e6
+	rds.DBs[0].Dataset.Put("string", "value")
+	rds.DBs[0].Dataset.Put("expired", "value")
+	rds.DBs[0].TtlMap.Put("expired", now-1000)
+	rds.DBs[0].Dataset.Put("ttl", "value")
+	rds.DBs[0].TtlMap.Put("ttl", now+100000)
+
+	s := set.MakeSet(2)
+	s.Add("a")
+	rds.DBs[1].Dataset.Put("set", s)
+
+	snapshots := rds.snapshot()
+	//写命令修改之前先拷贝，db 中的 value 换成拷贝之后再修改
+	rds.DBs[1].copyOnWrite([]string{"set"})
+	v, _ := rds.DBs[1].Dataset.Get("set")
+	if v.(*set.Set) == s {
+		t.Fatalf("value referenced by snapshot should be copied before write")
+	}
+	v.(*set.Set).Add("b")
+
+	if len(snapshots[0].entries) != 2 {
+		t.Fatalf("len(snapshots[0].entries) = %d, want 2, expired key should be skipped", len(snapshots[0].entries))
+	}
+	for _, entry := range snapshots[0].entries {
+		if entry.key == "ttl" && entry.expireAt != now+100000 {
+			t.Errorf("entry ttl expireAt = %d, want %d", entry.expireAt, now+100000)
+		}
+		if entry.key == "string" && entry.expireAt != -1 {
+			t.Errorf("entry string expireAt = %d, want -1", entry.expireAt)
+		}
+	}
+
+	snapshotted := snapshots[1].entries[0].value.(*set.Set)
+	if snapshotted.Len() != 1 {
+		t.Errorf("snapshot set len = %d, want 1, snapshot should not change after write", snapshotted.Len())
+	}
+
+	//release 之后不再拷贝
+	rds.release(snapshots)
+	rds.DBs[1].copyOnWrite([]string{"set"})
+	if got, _ := rds.DBs[1].Dataset.Get("set"); got != v {
+		t.Errorf("value should not be copied after the snapshot is released")
+	}
+	if len(rds.cowRefs) != 0 || rds.snapshotting != 0 {
+		t.Errorf("release() should drop all references, got %d values and %d snapshots", len(rds.cowRefs), rds.snapshotting)
+	}
+}
+
+func Test_rewriteCmds(t *testing.T) {
+	s := set.MakeSet(100)
+	for i := 0; i < 100; i++ {
+		s.Add(string(rune('a' + i)))
+	}
+
+	cmds := rewriteCmds(&snapshotEntry{
+		key:      "set",
+		value:    s,
+		expireAt: 1000,
+	})
+	if len(cmds) != 3 {
+		t.Fatalf("len(rewriteCmds) = %d, want 3", len(cmds))
+	}
+	if string(cmds[0][0]) != Sadd || len(cmds[0]) != 2+aofRewriteItemsPerCmd {
+		t.Errorf("first cmd should be sadd with %d members", aofRewriteItemsPerCmd)
+	}
+	if string(cmds[2][0]) != Pexpireat || string(cmds[2][2]) != "1000" {
+		t.Errorf("last cmd should be pexpireat set 1000, got %s", cmds[2])
+	}
+
+	cmds = rewriteCmds(&snapshotEntry{
+		key:      "string",
+		value:    "value",
+		expireAt: -1,
+	})
+	if len(cmds) != 1 || string(cmds[0][0]) != Set || string(cmds[0][2]) != "value" {
+		t.Errorf("rewriteCmds(string) = %s, want set string value", cmds)
+	}
+
+	l := quicklist.MakeQuickList()
+	for i := 0; i < aofRewriteItemsPerCmd+1; i++ {
+		l.PushBack(string(rune('a' + i)))
+	}
+	cmds = rewriteCmds(&snapshotEntry{
+		key:      "list",
+		value:    l,
+		expireAt: -1,
+	})
+	if len(cmds) != 2 || string(cmds[0][0]) != Rpush || string(cmds[0][2]) != "a" || len(cmds[1]) != 3 {
+		t.Errorf("rewriteCmds(list) = %s, want 2 rpush cmds in order", cmds)
+	}
+}
@@ -6,4 +6,6 @@ var (
 	NOT_INTEGER_ERROR = errors.New("ERR value is not an integer or out of range")
 
 	SYNTAX_ERROR = errors.New("ERR syntax error")
+
+	WRONG_TYPE_ERROR = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
 )
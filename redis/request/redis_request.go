@@ -8,6 +8,8 @@ import (
 type RedisRequet struct {
 	Args [][]byte //args 本质上是一个字符串数组
 	Err  error    //从 socket 读取数据出错
+
+	Pending bool //parser 中还有没有解析的数据，说明客户端在使用 pipeline，回复可以先不发送
 }
 
 func (rr RedisRequet) ToStrings() string {
@@ -19,6 +21,20 @@ func (rr RedisRequet) ToStrings() string {
 	return strings.TrimSpace(builder.String())
 }
 
-var (
-	PROTOCOL_ERROR_REQUEST = RedisRequet{Err: errors.New("protocol error")}
-)
+// 单条请求超过了 client-query-buffer-limit，和 redis 一样直接关闭连接，不回复错误
+var ErrQueryBufferLimit = errors.New("client reached max query buffer length")
+
+// 协议错误，比如引号不匹配、参数长度不合法，回复客户端之后需要关闭连接
+type ProtocolError struct {
+	Msg string
+}
+
+func (pe *ProtocolError) Error() string {
+	return "ERR Protocol error: " + pe.Msg
+}
+
+func MakeProtocolError(msg string) *ProtocolError {
+	return &ProtocolError{
+		Msg: msg,
+	}
+}
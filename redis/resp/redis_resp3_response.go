@@ -0,0 +1,310 @@
+package resp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/chenjiayao/goredistraning/interface/response"
+)
+
+// RESP3 协议，客户端通过 HELLO 3 切换，默认使用 RESP2
+// RESP3 新增的类型在 RESP2 下会降级成对应的 RESP2 类型：
+// map/set/push ---> 数组，double/big number/verbatim ---> bulk string，boolean ---> 整数，null ---> null bulk string
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// 在 RESP3 下编码方式和 RESP2 不一样的 response 需要实现这个接口，ToContentByte 返回的是 RESP2 的编码
+type Resp3Response interface {
+	ToResp3Byte() []byte
+}
+
+// 根据客户端使用的协议版本编码 response
+// 错误在两个版本中的编码一样，比如 exec 的回复中执行失败的命令
+func Encode(res response.Response, protocol int) []byte {
+	if _, ok := res.(RedisErrorResponse); ok {
+		return res.ToErrorByte()
+	}
+	if protocol == RESP3 {
+		if r, ok := res.(Resp3Response); ok {
+			return r.ToResp3Byte()
+		}
+	}
+	return res.ToContentByte()
+}
+
+var NullResponse = RedisNullResponse{}
+
+/////// null：以 "_" 开始，"_\r\n"
+type RedisNullResponse struct{}
+
+func (rnr RedisNullResponse) ToContentByte() []byte {
+	return []byte("$-1" + CRLF)
+}
+
+func (rnr RedisNullResponse) ToResp3Byte() []byte {
+	return []byte("_" + CRLF)
+}
+
+func (rnr RedisNullResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rnr RedisNullResponse) ISOK() bool {
+	return true
+}
+
+var NullArrayResponse = RedisNullArrayResponse{}
+
+/////// null array：RESP2 中以 "*-1\r\n" 表示，比如 key 不存在时的 lpop key count
+type RedisNullArrayResponse struct{}
+
+func (rnar RedisNullArrayResponse) ToContentByte() []byte {
+	return []byte("*-1" + CRLF)
+}
+
+func (rnar RedisNullArrayResponse) ToResp3Byte() []byte {
+	return []byte("_" + CRLF)
+}
+
+func (rnar RedisNullArrayResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rnar RedisNullArrayResponse) ISOK() bool {
+	return true
+}
+
+/////// map：以 "%" 开始，"%1\r\n+key\r\n:1\r\n"
+type RedisMapResponse struct {
+	Keys   []response.Response
+	Values []response.Response
+}
+
+func (rmr RedisMapResponse) ToContentByte() []byte {
+	return rmr.encode("*", len(rmr.Keys)*2, RESP2)
+}
+
+func (rmr RedisMapResponse) ToResp3Byte() []byte {
+	return rmr.encode("%", len(rmr.Keys), RESP3)
+}
+
+func (rmr RedisMapResponse) encode(prefix string, size int, protocol int) []byte {
+	res := []byte(fmt.Sprintf("%s%d%s", prefix, size, CRLF))
+	for i := 0; i < len(rmr.Keys); i++ {
+		res = append(res, Encode(rmr.Keys[i], protocol)...)
+		res = append(res, Encode(rmr.Values[i], protocol)...)
+	}
+	return res
+}
+
+func (rmr RedisMapResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rmr RedisMapResponse) ISOK() bool {
+	return true
+}
+
+// keys 和 values 的长度必须一致
+func MakeMapResponse(keys []response.Response, values []response.Response) response.Response {
+	return RedisMapResponse{
+		Keys:   keys,
+		Values: values,
+	}
+}
+
+/////// set：以 "~" 开始，"~2\r\n$1\r\na\r\n$1\r\nb\r\n"
+type RedisSetResponse struct {
+	Content []response.Response
+}
+
+func (rsr RedisSetResponse) ToContentByte() []byte {
+	return encodeAggregate("*", rsr.Content, RESP2)
+}
+
+func (rsr RedisSetResponse) ToResp3Byte() []byte {
+	return encodeAggregate("~", rsr.Content, RESP3)
+}
+
+func (rsr RedisSetResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rsr RedisSetResponse) ISOK() bool {
+	return true
+}
+
+func MakeSetResponse(content []response.Response) response.Response {
+	return RedisSetResponse{
+		Content: content,
+	}
+}
+
+/////// push：以 ">" 开始，服务端主动推送的消息，比如 pub/sub
+type RedisPushResponse struct {
+	Content []response.Response
+}
+
+func (rpr RedisPushResponse) ToContentByte() []byte {
+	return encodeAggregate("*", rpr.Content, RESP2)
+}
+
+func (rpr RedisPushResponse) ToResp3Byte() []byte {
+	return encodeAggregate(">", rpr.Content, RESP3)
+}
+
+func (rpr RedisPushResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rpr RedisPushResponse) ISOK() bool {
+	return true
+}
+
+func MakePushResponse(content []response.Response) response.Response {
+	return RedisPushResponse{
+		Content: content,
+	}
+}
+
+func encodeAggregate(prefix string, content []response.Response, protocol int) []byte {
+	res := []byte(fmt.Sprintf("%s%d%s", prefix, len(content), CRLF))
+	for _, v := range content {
+		res = append(res, Encode(v, protocol)...)
+	}
+	return res
+}
+
+/////// double：以 "," 开始，",1.23\r\n"，",inf\r\n"，",-inf\r\n"，",nan\r\n"
+type RedisDoubleResponse struct {
+	Value float64
+}
+
+func (rdr RedisDoubleResponse) ToContentByte() []byte {
+	return RedisBulkResponse{Content: []byte(FormatFloat(rdr.Value))}.ToContentByte()
+}
+
+func (rdr RedisDoubleResponse) ToResp3Byte() []byte {
+	return []byte("," + FormatFloat(rdr.Value) + CRLF)
+}
+
+func (rdr RedisDoubleResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rdr RedisDoubleResponse) ISOK() bool {
+	return true
+}
+
+func MakeDoubleResponse(value float64) response.Response {
+	return RedisDoubleResponse{
+		Value: value,
+	}
+}
+
+// 浮点数格式化成 redis 的格式：整数不带小数点，inf、-inf、nan 使用小写
+func FormatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+/////// boolean：以 "#" 开始，"#t\r\n"，"#f\r\n"
+type RedisBooleanResponse struct {
+	Value bool
+}
+
+func (rbr RedisBooleanResponse) ToContentByte() []byte {
+	if rbr.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+func (rbr RedisBooleanResponse) ToResp3Byte() []byte {
+	if rbr.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+func (rbr RedisBooleanResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rbr RedisBooleanResponse) ISOK() bool {
+	return true
+}
+
+func MakeBooleanResponse(value bool) response.Response {
+	return RedisBooleanResponse{
+		Value: value,
+	}
+}
+
+/////// big number：以 "(" 开始，"(3492890328409238509324850943850943825024385\r\n"
+type RedisBigNumberResponse struct {
+	Value string
+}
+
+func (rbnr RedisBigNumberResponse) ToContentByte() []byte {
+	return RedisBulkResponse{Content: []byte(rbnr.Value)}.ToContentByte()
+}
+
+func (rbnr RedisBigNumberResponse) ToResp3Byte() []byte {
+	return []byte("(" + rbnr.Value + CRLF)
+}
+
+func (rbnr RedisBigNumberResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rbnr RedisBigNumberResponse) ISOK() bool {
+	return true
+}
+
+func MakeBigNumberResponse(value string) response.Response {
+	return RedisBigNumberResponse{
+		Value: value,
+	}
+}
+
+/////// verbatim string：以 "=" 开始，"=15\r\ntxt:Some string\r\n"，format 是三个字符，比如 txt、mkd
+type RedisVerbatimResponse struct {
+	Format  string
+	Content []byte
+}
+
+func (rvr RedisVerbatimResponse) ToContentByte() []byte {
+	return RedisBulkResponse{Content: rvr.Content}.ToContentByte()
+}
+
+func (rvr RedisVerbatimResponse) ToResp3Byte() []byte {
+	res := []byte(fmt.Sprintf("=%d%s%s:", len(rvr.Content)+4, CRLF, rvr.Format))
+	res = append(res, rvr.Content...)
+	return append(res, CRLF...)
+}
+
+func (rvr RedisVerbatimResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rvr RedisVerbatimResponse) ISOK() bool {
+	return true
+}
+
+func MakeVerbatimResponse(format string, content []byte) response.Response {
+	return RedisVerbatimResponse{
+		Format:  format,
+		Content: content,
+	}
+}
@@ -0,0 +1,139 @@
+package resp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/chenjiayao/goredistraning/interface/response"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		response response.Response
+		wantV2   string
+		wantV3   string
+	}{
+		{
+			name:     "null",
+			response: NullResponse,
+			wantV2:   "$-1\r\n",
+			wantV3:   "_\r\n",
+		},
+		{
+			name:     "null bulk",
+			response: NullBulkResponse,
+			wantV2:   "$-1\r\n",
+			wantV3:   "_\r\n",
+		},
+		{
+			name:     "null array",
+			response: NullArrayResponse,
+			wantV2:   "*-1\r\n",
+			wantV3:   "_\r\n",
+		},
+		{
+			name:     "bulk array with null element",
+			response: MakeMultiResponse([][]byte{[]byte("a"), nil}),
+			wantV2:   "*2\r\n$1\r\na\r\n$-1\r\n",
+			wantV3:   "*2\r\n$1\r\na\r\n_\r\n",
+		},
+		{
+			name: "map",
+			response: MakeMapResponse(
+				[]response.Response{MakeBulkResponse([]byte("first")), MakeBulkResponse([]byte("second"))},
+				[]response.Response{MakeNumberResponse(1), NullBulkResponse},
+			),
+			wantV2: "*4\r\n$5\r\nfirst\r\n:1\r\n$6\r\nsecond\r\n$-1\r\n",
+			wantV3: "%2\r\n$5\r\nfirst\r\n:1\r\n$6\r\nsecond\r\n_\r\n",
+		},
+		{
+			name:     "set",
+			response: MakeSetResponse([]response.Response{MakeBulkResponse([]byte("a")), MakeNumberResponse(2)}),
+			wantV2:   "*2\r\n$1\r\na\r\n:2\r\n",
+			wantV3:   "~2\r\n$1\r\na\r\n:2\r\n",
+		},
+		{
+			name:     "push",
+			response: MakePushResponse([]response.Response{MakeBulkResponse([]byte("message"))}),
+			wantV2:   "*1\r\n$7\r\nmessage\r\n",
+			wantV3:   ">1\r\n$7\r\nmessage\r\n",
+		},
+		{
+			name:     "double",
+			response: MakeDoubleResponse(1.5),
+			wantV2:   "$3\r\n1.5\r\n",
+			wantV3:   ",1.5\r\n",
+		},
+		{
+			name:     "integer double",
+			response: MakeDoubleResponse(10),
+			wantV2:   "$2\r\n10\r\n",
+			wantV3:   ",10\r\n",
+		},
+		{
+			name:     "inf double",
+			response: MakeDoubleResponse(math.Inf(-1)),
+			wantV2:   "$4\r\n-inf\r\n",
+			wantV3:   ",-inf\r\n",
+		},
+		{
+			name:     "boolean true",
+			response: MakeBooleanResponse(true),
+			wantV2:   ":1\r\n",
+			wantV3:   "#t\r\n",
+		},
+		{
+			name:     "boolean false",
+			response: MakeBooleanResponse(false),
+			wantV2:   ":0\r\n",
+			wantV3:   "#f\r\n",
+		},
+		{
+			name:     "big number",
+			response: MakeBigNumberResponse("3492890328409238509324850943850943825024385"),
+			wantV2:   "$43\r\n3492890328409238509324850943850943825024385\r\n",
+			wantV3:   "(3492890328409238509324850943850943825024385\r\n",
+		},
+		{
+			name:     "verbatim string",
+			response: MakeVerbatimResponse("txt", []byte("Some string")),
+			wantV2:   "$11\r\nSome string\r\n",
+			wantV3:   "=15\r\ntxt:Some string\r\n",
+		},
+		{
+			name: "array of resp3 types",
+			response: MakeArrayResponse([]response.Response{
+				MakeBooleanResponse(true),
+				MakeSetResponse([]response.Response{MakeNumberResponse(1)}),
+			}),
+			wantV2: "*2\r\n:1\r\n*1\r\n:1\r\n",
+			wantV3: "*2\r\n#t\r\n~1\r\n:1\r\n",
+		},
+		{
+			name: "array with error",
+			response: MakeArrayResponse([]response.Response{
+				MakeErrorResponse("ERR value is not an integer or out of range"),
+				MakeNumberResponse(2),
+			}),
+			wantV2: "*2\r\n-ERR value is not an integer or out of range\r\n:2\r\n",
+			wantV3: "*2\r\n-ERR value is not an integer or out of range\r\n:2\r\n",
+		},
+		{
+			name:     "simple string is the same",
+			response: OKSimpleResponse,
+			wantV2:   "+OK\r\n",
+			wantV3:   "+OK\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Encode(tt.response, RESP2)); got != tt.wantV2 {
+				t.Errorf("Encode(RESP2) = %q, want %q", got, tt.wantV2)
+			}
+			if got := string(Encode(tt.response, RESP3)); got != tt.wantV3 {
+				t.Errorf("Encode(RESP3) = %q, want %q", got, tt.wantV3)
+			}
+		})
+	}
+}
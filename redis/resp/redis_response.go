@@ -15,6 +15,7 @@ const (
 
 var (
 	NullMultiResponse = MakeMultiResponse(nil)
+	NullBulkResponse  = MakeBulkResponse(nil)
 	OKSimpleResponse  = MakeSimpleResponse("OK")
 )
 
@@ -68,16 +69,77 @@ func MakeSimpleResponse(content string) response.Response {
 
 }
 
-//////多行数据 $ 开头
+//////单个二进制安全的字符串 $ 开头，如："$5\r\nvalue\r\n"，nil 表示 null："$-1\r\n"
+type RedisBulkResponse struct {
+	Content []byte
+}
+
+func (rbr RedisBulkResponse) ToContentByte() []byte {
+	if rbr.Content == nil {
+		return []byte("$-1" + CRLF)
+	}
+	res := make([]byte, 0, len(rbr.Content)+16)
+	res = append(res, fmt.Sprintf("$%d%s", len(rbr.Content), CRLF)...)
+	res = append(res, rbr.Content...)
+	res = append(res, CRLF...)
+	return res
+}
+
+func (rbr RedisBulkResponse) ToResp3Byte() []byte {
+	if rbr.Content == nil {
+		return NullResponse.ToResp3Byte()
+	}
+	return rbr.ToContentByte()
+}
+
+func (rbr RedisBulkResponse) ToErrorByte() []byte {
+	return []byte{}
+}
+
+func (rbr RedisBulkResponse) ISOK() bool {
+	return true
+}
+
+func MakeBulkResponse(content []byte) response.Response {
+	return RedisBulkResponse{
+		Content: content,
+	}
+}
+
+//////多行数据：由 bulk string 组成的数组，如："*2\r\n$3\r\nkey\r\n$-1\r\n"
+// 数组中的 nil 元素编码为 null bulk string
+// Content 为 nil 时编码为 null bulk string："$-1\r\n"
 type RedisMultiLineResponse struct {
 	Content [][]byte
 }
 
 func (rmls *RedisMultiLineResponse) ToContentByte() []byte {
 	if rmls.Content == nil {
-		return []byte("$-1\r\n")
+		return []byte("$-1" + CRLF)
 	}
-	return []byte{}
+
+	size := 16
+	for _, v := range rmls.Content {
+		size += len(v) + 16
+	}
+	res := make([]byte, 0, size)
+	res = append(res, fmt.Sprintf("*%d%s", len(rmls.Content), CRLF)...)
+	for _, v := range rmls.Content {
+		res = append(res, RedisBulkResponse{Content: v}.ToContentByte()...)
+	}
+	return res
+}
+
+func (rmls *RedisMultiLineResponse) ToResp3Byte() []byte {
+	if rmls.Content == nil {
+		return NullResponse.ToResp3Byte()
+	}
+
+	res := []byte(fmt.Sprintf("*%d%s", len(rmls.Content), CRLF))
+	for _, v := range rmls.Content {
+		res = append(res, RedisBulkResponse{Content: v}.ToResp3Byte()...)
+	}
+	return res
 }
 
 func (rmls *RedisMultiLineResponse) ToErrorByte() []byte {
@@ -133,11 +195,18 @@ func (rar RedisArrayResponse) ToContentByte() []byte {
 	res = append(res, []byte(fmt.Sprintf("*%d%s", len(rar.Content), CRLF))...)
 
 	for _, v := range rar.Content {
-		res = append(res, v.ToContentByte()...)
+		res = append(res, Encode(v, RESP2)...)
 	}
 	return res
 }
 
+func (rar RedisArrayResponse) ToResp3Byte() []byte {
+	if rar.Content == nil {
+		return []byte("*0\r\n")
+	}
+	return encodeAggregate("*", rar.Content, RESP3)
+}
+
 func (rar RedisArrayResponse) ToErrorByte() []byte {
 	return []byte{}
 }
@@ -2,9 +2,115 @@ package resp
 
 import (
 	"testing"
+
+	"github.com/chenjiayao/goredistraning/interface/response"
 )
 
-func TestRedisArrayResponse_ToContentByte(t *testing.T) {
+func TestResponse_ToContentByte(t *testing.T) {
+	tests := []struct {
+		name     string
+		response response.Response
+		want     string
+	}{
+		{
+			name:     "simple string",
+			response: MakeSimpleResponse("OK"),
+			want:     "+OK\r\n",
+		},
+		{
+			name:     "integer",
+			response: MakeNumberResponse(1000),
+			want:     ":1000\r\n",
+		},
+		{
+			name:     "negative integer",
+			response: MakeNumberResponse(-2),
+			want:     ":-2\r\n",
+		},
+		{
+			name:     "bulk string",
+			response: MakeBulkResponse([]byte("hello")),
+			want:     "$5\r\nhello\r\n",
+		},
+		{
+			name:     "empty bulk string",
+			response: MakeBulkResponse([]byte{}),
+			want:     "$0\r\n\r\n",
+		},
+		{
+			name:     "binary bulk string",
+			response: MakeBulkResponse([]byte("a\r\nb\x00")),
+			want:     "$5\r\na\r\nb\x00\r\n",
+		},
+		{
+			name:     "null bulk string",
+			response: NullBulkResponse,
+			want:     "$-1\r\n",
+		},
+		{
+			name:     "null multi",
+			response: NullMultiResponse,
+			want:     "$-1\r\n",
+		},
+		{
+			name:     "multi bulk",
+			response: MakeMultiResponse([][]byte{[]byte("SET"), []byte("key"), []byte("value")}),
+			want:     "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n",
+		},
+		{
+			name:     "multi bulk with null element",
+			response: MakeMultiResponse([][]byte{[]byte("foo"), nil, []byte("bar")}),
+			want:     "*3\r\n$3\r\nfoo\r\n$-1\r\n$3\r\nbar\r\n",
+		},
+		{
+			name:     "empty multi bulk",
+			response: MakeMultiResponse([][]byte{}),
+			want:     "*0\r\n",
+		},
+		{
+			name:     "empty array",
+			response: MakeArrayResponse(nil),
+			want:     "*0\r\n",
+		},
+		{
+			name: "mixed array",
+			response: MakeArrayResponse([]response.Response{
+				MakeNumberResponse(1),
+				MakeBulkResponse([]byte("two")),
+				MakeSimpleResponse("three"),
+				NullBulkResponse,
+			}),
+			want: "*4\r\n:1\r\n$3\r\ntwo\r\n+three\r\n$-1\r\n",
+		},
+		{
+			name: "nested array",
+			response: MakeArrayResponse([]response.Response{
+				MakeMultiResponse([][]byte{[]byte("a"), []byte("b")}),
+				MakeArrayResponse([]response.Response{MakeNumberResponse(3)}),
+			}),
+			want: "*2\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n*1\r\n:3\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(tt.response.ToContentByte())
+			if got != tt.want {
+				t.Errorf("ToContentByte() = %q, want %q", got, tt.want)
+			}
+			if !tt.response.ISOK() {
+				t.Errorf("ISOK() = false, want true")
+			}
+		})
+	}
+}
 
-	// TODO
+func TestRedisErrorResponse_ToErrorByte(t *testing.T) {
+	res := MakeErrorResponse("ERR unknown command")
+	want := "-ERR unknown command\r\n"
+	if got := string(res.ToErrorByte()); got != want {
+		t.Errorf("ToErrorByte() = %q, want %q", got, want)
+	}
+	if res.ISOK() {
+		t.Errorf("error response ISOK() = true, want false")
+	}
 }
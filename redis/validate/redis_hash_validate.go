@@ -0,0 +1,180 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+)
+
+// hset key field value [field value ...]
+func ValidateHSet(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hset)
+	}
+	return nil
+}
+
+// hmset key field value [field value ...]
+func ValidateHMSet(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hmset)
+	}
+	return nil
+}
+
+// hsetnx key field value
+func ValidateHSetNX(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hsetnx)
+	}
+	return nil
+}
+
+// hget key field
+func ValidateHGet(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hget)
+	}
+	return nil
+}
+
+func ValidateHExists(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hexists)
+	}
+	return nil
+}
+
+func ValidateHStrlen(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hstrlen)
+	}
+	return nil
+}
+
+// hdel key field [field ...]
+func ValidateHDel(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hdel)
+	}
+	return nil
+}
+
+// hmget key field [field ...]
+func ValidateHMGet(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hmget)
+	}
+	return nil
+}
+
+func ValidateHLen(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hlen)
+	}
+	return nil
+}
+
+func ValidateHKeys(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hkeys)
+	}
+	return nil
+}
+
+func ValidateHVals(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hvals)
+	}
+	return nil
+}
+
+func ValidateHGetAll(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hgetall)
+	}
+	return nil
+}
+
+// hincrby key field increment
+func ValidateHIncrBy(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hincrby)
+	}
+	return validateIntegers(args[2])
+}
+
+// hincrbyfloat key field increment
+func ValidateHIncrByFloat(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hincrbyfloat)
+	}
+	increment, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return errors.New("ERR value is not a valid float")
+	}
+	return nil
+}
+
+// hrandfield key [count [WITHVALUES]]
+func ValidateHRandField(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 || len(args) > 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hrandfield)
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	if err := validateIntegers(args[1]); err != nil {
+		return err
+	}
+	if len(args) == 3 && strings.ToLower(string(args[2])) != "withvalues" {
+		return rediserr.SYNTAX_ERROR
+	}
+	return nil
+}
+
+// hscan key cursor [MATCH pattern] [COUNT count]
+func ValidateHScan(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Hscan)
+	}
+	return validateScanOptions(args[1:], false)
+}
+
+// cursor [MATCH pattern] [COUNT count]，allowType 为 true 时还支持 [TYPE type]
+func validateScanOptions(args [][]byte, allowType bool) error {
+	_, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return errors.New("ERR invalid cursor")
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return rediserr.SYNTAX_ERROR
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+		case "type":
+			if !allowType {
+				return rediserr.SYNTAX_ERROR
+			}
+		case "count":
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return rediserr.NOT_INTEGER_ERROR
+			}
+			if count < 1 {
+				return rediserr.SYNTAX_ERROR
+			}
+		default:
+			return rediserr.SYNTAX_ERROR
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chenjiayao/goredistraning/config"
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+)
+
+var (
+	errDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	errExpireNXAndOthers = errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+	errExpireGTAndLT     = errors.New("ERR GT and LT options at the same time are not compatible")
+)
+
+// expire key seconds [NX | XX | GT | LT]
+func ValidateExpire(conn conn.Conn, args [][]byte) error {
+	return validateExpire(redis.Expire, args)
+}
+
+func ValidatePExpire(conn conn.Conn, args [][]byte) error {
+	return validateExpire(redis.Pexpire, args)
+}
+
+func ValidateExpireAt(conn conn.Conn, args [][]byte) error {
+	return validateExpire(redis.Expireat, args)
+}
+
+func ValidatePExpireAt(conn conn.Conn, args [][]byte) error {
+	return validateExpire(redis.Pexpireat, args)
+}
+
+func validateExpire(cmdName string, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", cmdName)
+	}
+	if _, err := strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+		return rediserr.NOT_INTEGER_ERROR
+	}
+
+	options := make(map[string]bool)
+	for _, arg := range args[2:] {
+		option := strings.ToLower(string(arg))
+		switch option {
+		case "nx", "xx", "gt", "lt":
+			options[option] = true
+		default:
+			return fmt.Errorf("ERR Unsupported option %s", string(arg))
+		}
+	}
+	if options["nx"] && (options["xx"] || options["gt"] || options["lt"]) {
+		return errExpireNXAndOthers
+	}
+	if options["gt"] && options["lt"] {
+		return errExpireGTAndLT
+	}
+	return nil
+}
+
+// ttl、pttl、persist、expiretime、pexpiretime 的参数都是一个 key
+func ValidateTTL(conn conn.Conn, args [][]byte) error {
+	return validateSingleKey(redis.TTL, args)
+}
+
+func ValidatePTTL(conn conn.Conn, args [][]byte) error {
+	return validateSingleKey(redis.Pttl, args)
+}
+
+func ValidatePersist(conn conn.Conn, args [][]byte) error {
+	return validateSingleKey(redis.Persist, args)
+}
+
+func ValidateExpireTime(conn conn.Conn, args [][]byte) error {
+	return validateSingleKey(redis.Expiretime, args)
+}
+
+func ValidatePExpireTime(conn conn.Conn, args [][]byte) error {
+	return validateSingleKey(redis.Pexpiretime, args)
+}
+
+func validateSingleKey(cmdName string, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", cmdName)
+	}
+	return nil
+}
+
+// scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+func ValidateScan(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Scan)
+	}
+	return validateScanOptions(args, true)
+}
+
+// object encoding key
+func ValidateObject(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Object)
+	}
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "encoding", "idletime", "freq":
+		if len(args) != 2 {
+			return fmt.Errorf("ERR wrong number of arguments for '%s|%s' command", redis.Object, subCommand)
+		}
+		return nil
+	default:
+		return fmt.Errorf("ERR unknown subcommand '%s'. Try OBJECT HELP.", string(args[0]))
+	}
+}
+
+// del key [key ...]
+func ValidateDel(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Del)
+	}
+	return nil
+}
+
+func ValidateUnlink(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Unlink)
+	}
+	return nil
+}
+
+func ValidateExists(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Exists)
+	}
+	return nil
+}
+
+func ValidateTouch(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Touch)
+	}
+	return nil
+}
+
+func ValidateType(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Type)
+	}
+	return nil
+}
+
+// rename key newkey
+func ValidateRename(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Rename)
+	}
+	return nil
+}
+
+func ValidateRenamenx(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Renamenx)
+	}
+	return nil
+}
+
+// copy source destination [DB destination-db] [REPLACE]
+func ValidateCopy(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Copy)
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "replace":
+		case "db":
+			if i+1 >= len(args) {
+				return rediserr.SYNTAX_ERROR
+			}
+			if err := validateDBIndex(args[i+1]); err != nil {
+				return err
+			}
+			i++
+		default:
+			return rediserr.SYNTAX_ERROR
+		}
+	}
+	return nil
+}
+
+// move key db
+func ValidateMove(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Move)
+	}
+	return validateDBIndex(args[1])
+}
+
+func ValidateRandomkey(conn conn.Conn, args [][]byte) error {
+	if len(args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Randomkey)
+	}
+	return nil
+}
+
+func validateDBIndex(arg []byte) error {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return rediserr.NOT_INTEGER_ERROR
+	}
+	if index < 0 || index >= config.Config.Databases {
+		return errDBIndexOutOfRange
+	}
+	return nil
+}
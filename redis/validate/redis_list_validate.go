@@ -1,31 +1,237 @@
 package validate
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
 )
 
+// lpush key element [element ...]
 func ValidateLPush(conn conn.Conn, args [][]byte) error {
 
-	if len(args) < 1 {
+	if len(args) < 2 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lpush)
 	}
 	return nil
 }
 
+func ValidateLPushX(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lpushx)
+	}
+	return nil
+}
+
+func ValidateRPush(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Rpush)
+	}
+	return nil
+}
+
+func ValidateRPushX(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Rpushx)
+	}
+	return nil
+}
+
+// lpop key [count]
 func ValidateLPop(conn conn.Conn, args [][]byte) error {
 
-	if len(args) != 1 {
+	if len(args) != 1 && len(args) != 2 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lpop)
 	}
+	return validatePopCount(args)
+}
+
+func ValidateRPop(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Rpop)
+	}
+	return validatePopCount(args)
+}
+
+func validatePopCount(args [][]byte) error {
+	if len(args) == 1 {
+		return nil
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || count < 0 {
+		return errors.New("ERR value is out of range, must be positive")
+	}
 	return nil
 }
 
+// rpoplpush source destination
+func ValidateRPopLPush(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Rpoplpush)
+	}
+	return nil
+}
+
+// lmove source destination LEFT|RIGHT LEFT|RIGHT
+func ValidateLMove(conn conn.Conn, args [][]byte) error {
+	if len(args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lmove)
+	}
+	for _, where := range args[2:] {
+		w := strings.ToLower(string(where))
+		if w != "left" && w != "right" {
+			return rediserr.SYNTAX_ERROR
+		}
+	}
+	return nil
+}
+
+// lrem key count element
+func ValidateLRem(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lrem)
+	}
+	return validateIntegers(args[1])
+}
+
+func ValidateLLen(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Llen)
+	}
+	return nil
+}
+
+// lindex key index
 func ValidateLIndex(conn conn.Conn, args [][]byte) error {
 	if len(args) != 2 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lindex)
 	}
+	return validateIntegers(args[1])
+}
+
+// lset key index element
+func ValidateLSet(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lset)
+	}
+	return validateIntegers(args[1])
+}
+
+// lrange key start stop
+func ValidateLRange(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lrange)
+	}
+	return validateIntegers(args[1], args[2])
+}
+
+// linsert key BEFORE|AFTER pivot element
+func ValidateLInsert(conn conn.Conn, args [][]byte) error {
+	if len(args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Linsert)
+	}
+	where := strings.ToLower(string(args[1]))
+	if where != "before" && where != "after" {
+		return rediserr.SYNTAX_ERROR
+	}
+	return nil
+}
+
+// ltrim key start stop
+func ValidateLTrim(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Ltrim)
+	}
+	return validateIntegers(args[1], args[2])
+}
+
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func ValidateLPos(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lpos)
+	}
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return rediserr.SYNTAX_ERROR
+		}
+		value, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return rediserr.NOT_INTEGER_ERROR
+		}
+
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if value == 0 {
+				return errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+			}
+		case "count":
+			if value < 0 {
+				return errors.New("ERR COUNT can't be negative")
+			}
+		case "maxlen":
+			if value < 0 {
+				return errors.New("ERR MAXLEN can't be negative")
+			}
+		default:
+			return rediserr.SYNTAX_ERROR
+		}
+	}
+	return nil
+}
+
+// 参数必须都是整数
+func validateIntegers(args ...[]byte) error {
+	for _, arg := range args {
+		_, err := strconv.ParseInt(string(arg), 10, 64)
+		if err != nil {
+			return rediserr.NOT_INTEGER_ERROR
+		}
+	}
+	return nil
+}
+
+// blpop key [key ...] timeout
+func ValidateBLPop(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Blpop)
+	}
+	return validateTimeout(args[len(args)-1])
+}
+
+// brpop key [key ...] timeout
+func ValidateBRPop(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Brpop)
+	}
+	return validateTimeout(args[len(args)-1])
+}
+
+// blmove source destination LEFT|RIGHT LEFT|RIGHT timeout
+func ValidateBLMove(conn conn.Conn, args [][]byte) error {
+	if len(args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Blmove)
+	}
+	err := ValidateLMove(conn, args[:4])
+	if err != nil {
+		return err
+	}
+	return validateTimeout(args[4])
+}
+
+// 阻塞命令的超时时间，单位是秒，可以是小数，0 表示一直阻塞
+func validateTimeout(arg []byte) error {
+	timeout, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return errors.New("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return errors.New("ERR timeout is negative")
+	}
 	return nil
 }
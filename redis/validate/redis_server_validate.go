@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/chenjiayao/goredistraning/config"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
 )
 
 func ValidateAuthFunc(con conn.Conn, args [][]byte) error {
@@ -30,9 +32,93 @@ func ValidateSelectFunc(conn conn.Conn, args [][]byte) error {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Select)
 	}
 	dbIndexStr := string(args[0])
-	_, err := strconv.Atoi(dbIndexStr)
+	dbIndex, err := strconv.Atoi(dbIndexStr)
 	if err != nil {
 		return errors.New("ERR invalid DB index")
 	}
+	if dbIndex < 0 || dbIndex >= config.Config.Databases {
+		return errors.New("ERR DB index is out of range")
+	}
+	return nil
+}
+
+func ValidateBgRewriteAof(conn conn.Conn, args [][]byte) error {
+	if len(args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Bgrewriteaof)
+	}
+	return nil
+}
+
+func ValidateSave(conn conn.Conn, args [][]byte) error {
+	if len(args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Save)
+	}
+	return nil
+}
+
+func ValidateBgSave(conn conn.Conn, args [][]byte) error {
+	if len(args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Bgsave)
+	}
+	return nil
+}
+
+func ValidateLastSave(conn conn.Conn, args [][]byte) error {
+	if len(args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Lastsave)
+	}
+	return nil
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func ValidateHello(conn conn.Conn, args [][]byte) error {
+	if len(args) == 0 {
+		return nil
+	}
+	_, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return errors.New("ERR Protocol version is not an integer or out of range")
+	}
+
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "auth" && i+2 < len(args):
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			i++
+		default:
+			return fmt.Errorf("ERR Syntax error in HELLO option '%s'", string(args[i]))
+		}
+	}
+	return nil
+}
+
+func ValidateConfig(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Config)
+	}
+	return nil
+}
+
+// keys pattern
+func ValidateKeys(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Keys)
+	}
+	return nil
+}
+
+// flushdb [ASYNC|SYNC]，flushall [ASYNC|SYNC]
+func ValidateFlush(conn conn.Conn, args [][]byte) error {
+	if len(args) > 1 {
+		return rediserr.SYNTAX_ERROR
+	}
+	if len(args) == 1 {
+		mode := strings.ToLower(string(args[0]))
+		if mode != "async" && mode != "sync" {
+			return rediserr.SYNTAX_ERROR
+		}
+	}
 	return nil
 }
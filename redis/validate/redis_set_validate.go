@@ -1,40 +1,76 @@
 package validate
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+)
+
+var (
+	errNotPositive    = errors.New("ERR value is out of range, must be positive")
+	errNumKeysNotPos  = errors.New("ERR numkeys should be greater than 0")
+	errNumKeysTooMany = errors.New("ERR Number of keys can't be greater than number of args")
+	errNegativeLimit  = errors.New("ERR LIMIT can't be negative")
 )
 
 func ValidateSadd(conn conn.Conn, args [][]byte) error {
 
 	if len(args) < 2 {
-		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Set)
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sadd)
 	}
 
 	return nil
 }
 
+func ValidateSrem(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Srem)
+	}
+	return nil
+}
+
 func ValidateSmembers(conn conn.Conn, args [][]byte) error {
 
-	if len(args) > 2 {
+	if len(args) != 1 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Smembers)
 	}
 	return nil
 }
 
 func ValidateScard(conn conn.Conn, args [][]byte) error {
-	if len(args) > 2 {
+	if len(args) != 1 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Scard)
 	}
 	return nil
 }
 
+// spop key [count]
 func ValidateSpop(conn conn.Conn, args [][]byte) error {
-	if len(args) > 2 {
+	if len(args) != 1 && len(args) != 2 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Spop)
 	}
+	if len(args) == 2 {
+		count, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || count < 0 {
+			return errNotPositive
+		}
+	}
+	return nil
+}
+
+// srandmember key [count]
+func ValidateSrandmember(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Srandmember)
+	}
+	if len(args) == 2 {
+		return validateIntegers(args[1])
+	}
 	return nil
 }
 
@@ -45,9 +81,101 @@ func ValidateSismember(conn conn.Conn, args [][]byte) error {
 	return nil
 }
 
+func ValidateSmismember(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Smismember)
+	}
+	return nil
+}
+
+// smove source destination member
+func ValidateSmove(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Smove)
+	}
+	return nil
+}
+
 func ValidateSdiff(conn conn.Conn, args [][]byte) error {
 	if len(args) < 1 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sdiff)
 	}
 	return nil
 }
+
+func ValidateSinter(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sinter)
+	}
+	return nil
+}
+
+func ValidateSunion(conn conn.Conn, args [][]byte) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sunion)
+	}
+	return nil
+}
+
+// sdiffstore destination key [key ...]
+func ValidateSdiffstore(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sdiffstore)
+	}
+	return nil
+}
+
+func ValidateSinterstore(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sinterstore)
+	}
+	return nil
+}
+
+func ValidateSunionstore(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sunionstore)
+	}
+	return nil
+}
+
+// sintercard numkeys key [key ...] [LIMIT limit]
+func ValidateSintercard(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sintercard)
+	}
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return rediserr.NOT_INTEGER_ERROR
+	}
+	if numKeys <= 0 {
+		return errNumKeysNotPos
+	}
+	if numKeys > int64(len(args)-1) {
+		return errNumKeysTooMany
+	}
+
+	options := args[numKeys+1:]
+	if len(options) == 0 {
+		return nil
+	}
+	if len(options) != 2 || strings.ToLower(string(options[0])) != "limit" {
+		return rediserr.SYNTAX_ERROR
+	}
+	limit, err := strconv.ParseInt(string(options[1]), 10, 64)
+	if err != nil {
+		return rediserr.NOT_INTEGER_ERROR
+	}
+	if limit < 0 {
+		return errNegativeLimit
+	}
+	return nil
+}
+
+// sscan key cursor [MATCH pattern] [COUNT count]
+func ValidateSscan(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Sscan)
+	}
+	return validateScanOptions(args[1:], false)
+}
@@ -0,0 +1,250 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chenjiayao/goredistraning/interface/conn"
+	"github.com/chenjiayao/goredistraning/lib/skiplist"
+	"github.com/chenjiayao/goredistraning/redis"
+	"github.com/chenjiayao/goredistraning/redis/rediserr"
+)
+
+var (
+	errNotFloat       = errors.New("ERR value is not a valid float")
+	errScoreBorder    = errors.New("ERR min or max is not a float")
+	errLexBorder      = errors.New("ERR min or max not valid string range item")
+	errLimitWithoutBy = errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	errLexWithScores  = errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	errXXAndNX        = errors.New("ERR XX and NX options at the same time are not compatible")
+	errGTLTAndNX      = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	errIncrSinglePair = errors.New("ERR INCR option supports a single increment-element pair")
+	zaddOptions       = map[string]struct{}{"nx": {}, "xx": {}, "gt": {}, "lt": {}, "ch": {}, "incr": {}}
+)
+
+// zadd key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func ValidateZAdd(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zadd)
+	}
+
+	options := make(map[string]bool)
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if _, ok := zaddOptions[option]; !ok {
+			break
+		}
+		options[option] = true
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return rediserr.SYNTAX_ERROR
+	}
+	if options["nx"] && options["xx"] {
+		return errXXAndNX
+	}
+	if (options["gt"] && options["lt"]) || (options["nx"] && (options["gt"] || options["lt"])) {
+		return errGTLTAndNX
+	}
+	if options["incr"] && len(pairs) > 2 {
+		return errIncrSinglePair
+	}
+	for j := 0; j < len(pairs); j += 2 {
+		if err := validateFloat(pairs[j]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zincrby key increment member
+func ValidateZIncrBy(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zincrby)
+	}
+	return validateFloat(args[1])
+}
+
+func ValidateZScore(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zscore)
+	}
+	return nil
+}
+
+func ValidateZRank(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrank)
+	}
+	return nil
+}
+
+func ValidateZRevRank(conn conn.Conn, args [][]byte) error {
+	if len(args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrevrank)
+	}
+	return nil
+}
+
+func ValidateZCard(conn conn.Conn, args [][]byte) error {
+	if len(args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zcard)
+	}
+	return nil
+}
+
+// zcount key min max
+func ValidateZCount(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zcount)
+	}
+	return validateScoreBorders(args[1], args[2])
+}
+
+// zrem key member [member ...]
+func ValidateZRem(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrem)
+	}
+	return nil
+}
+
+// zrange key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func ValidateZRange(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrange)
+	}
+	return validateZRangeOptions(args)
+}
+
+// zrevrange key start stop [WITHSCORES]
+func ValidateZRevRange(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrevrange)
+	}
+	if len(args) == 4 && strings.ToLower(string(args[3])) != "withscores" {
+		return rediserr.SYNTAX_ERROR
+	}
+	return validateZRangeOptions(args)
+}
+
+// zrangebyscore key min max [WITHSCORES] [LIMIT offset count]
+func ValidateZRangeByScore(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrangebyscore)
+	}
+	return validateZRangeOptions(append(append([][]byte{}, args...), []byte("byscore")))
+}
+
+// zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+func ValidateZRevRangeByScore(conn conn.Conn, args [][]byte) error {
+	if len(args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zrevrangebyscore)
+	}
+	return validateZRangeOptions(append(append([][]byte{}, args...), []byte("byscore")))
+}
+
+func validateZRangeOptions(args [][]byte) error {
+	by := ""
+	limit := false
+	withScores := false
+	for i := 3; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "rev":
+		case "byscore", "bylex":
+			by = option
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return rediserr.SYNTAX_ERROR
+			}
+			if err := validateIntegers(args[i+1], args[i+2]); err != nil {
+				return err
+			}
+			limit = true
+			i += 2
+		default:
+			return rediserr.SYNTAX_ERROR
+		}
+	}
+
+	switch by {
+	case "byscore":
+		return validateScoreBorders(args[1], args[2])
+	case "bylex":
+		if withScores {
+			return errLexWithScores
+		}
+		return validateLexBorders(args[1], args[2])
+	default:
+		if limit {
+			return errLimitWithoutBy
+		}
+		return validateIntegers(args[1], args[2])
+	}
+}
+
+// zremrangebyscore key min max
+func ValidateZRemRangeByScore(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zremrangebyscore)
+	}
+	return validateScoreBorders(args[1], args[2])
+}
+
+// zremrangebyrank key start stop
+func ValidateZRemRangeByRank(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zremrangebyrank)
+	}
+	return validateIntegers(args[1], args[2])
+}
+
+// zremrangebylex key min max
+func ValidateZRemRangeByLex(conn conn.Conn, args [][]byte) error {
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zremrangebylex)
+	}
+	return validateLexBorders(args[1], args[2])
+}
+
+// zscan key cursor [MATCH pattern] [COUNT count]
+func ValidateZScan(conn conn.Conn, args [][]byte) error {
+	if len(args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Zscan)
+	}
+	return validateScanOptions(args[1:], false)
+}
+
+func validateFloat(arg []byte) error {
+	value, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(value) {
+		return errNotFloat
+	}
+	return nil
+}
+
+func validateScoreBorders(args ...[]byte) error {
+	for _, arg := range args {
+		if _, err := skiplist.ParseScoreBorder(string(arg)); err != nil {
+			return errScoreBorder
+		}
+	}
+	return nil
+}
+
+func validateLexBorders(args ...[]byte) error {
+	for _, arg := range args {
+		if _, err := skiplist.ParseLexBorder(string(arg)); err != nil {
+			return errLexBorder
+		}
+	}
+	return nil
+}
@@ -1,11 +1,10 @@
 package validate
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
-	"github.com/chenjiayao/goredistraning/helper"
 	"github.com/chenjiayao/goredistraning/interface/conn"
 	"github.com/chenjiayao/goredistraning/redis"
 	"github.com/chenjiayao/goredistraning/redis/rediserr"
@@ -18,48 +17,28 @@ func ValidateSet(conn conn.Conn, args [][]byte) error {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Set)
 	}
 
-	ss := helper.BbyteToSString(args)
-
-	shouldHaveArgsCount := 2
-
-	EXFlagIndex := helper.ContainWithoutCaseSensitive(ss, "EX")
-	PXFlagIndex := helper.ContainWithoutCaseSensitive(ss, "PX")
-	NXFlagIndex := helper.ContainWithoutCaseSensitive(ss, "NX")
-	XXFlagIndex := helper.ContainWithoutCaseSensitive(ss, "XX")
-
-	if NXFlagIndex != -1 && XXFlagIndex != -1 {
-		return rediserr.SYNTAX_ERROR
-	}
-	if PXFlagIndex != -1 && EXFlagIndex != -1 {
-		return rediserr.SYNTAX_ERROR
-	}
-
-	if EXFlagIndex != -1 {
-		ex := ss[EXFlagIndex+1]
-		_, err := strconv.Atoi(ex) //ex 下一个参数得是 integer
-		if err != nil {
-			return errors.New("ERR value is not an integer or out of range")
-		}
-		shouldHaveArgsCount += 2
-	}
-	if PXFlagIndex != -1 {
-		px := ss[EXFlagIndex+1]
-		_, err := strconv.Atoi(px) //px 下一个参数得是 integer
-		if err != nil {
-			return errors.New("ERR value is not an integer or out of range")
+	//选项只会出现在 key 和 value 之后，key 或者 value 本身是 ex、nx 的时候不能当作选项
+	hasExpire := false
+	hasCondition := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "ex", "px":
+			if hasExpire || i+1 >= len(args) {
+				return rediserr.SYNTAX_ERROR
+			}
+			if err := validateExpireTime(redis.Set, args[i+1]); err != nil {
+				return err
+			}
+			hasExpire = true
+			i++
+		case "nx", "xx":
+			if hasCondition {
+				return rediserr.SYNTAX_ERROR
+			}
+			hasCondition = true
+		default:
+			return rediserr.SYNTAX_ERROR
 		}
-		shouldHaveArgsCount += 2
-	}
-
-	if NXFlagIndex != -1 {
-		shouldHaveArgsCount += 1
-	}
-	if XXFlagIndex != -1 {
-		shouldHaveArgsCount += 1
-	}
-
-	if shouldHaveArgsCount != len(ss) {
-		return rediserr.SYNTAX_ERROR
 	}
 	return nil
 }
@@ -71,22 +50,31 @@ func ValidateSetNx(conn conn.Conn, args [][]byte) error {
 	return nil
 }
 
+// setex key seconds value
 func ValidateSetEx(conn conn.Conn, args [][]byte) error {
-	if len(args) != 2 {
-		return rediserr.SYNTAX_ERROR
+	if len(args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Setex)
 	}
-	return nil
+	return validateExpireTime(redis.Setex, args[1])
 }
 
+// psetex key milliseconds value
 func ValidatePSetEx(conn conn.Conn, args [][]byte) error {
 	if len(args) != 3 {
-		return rediserr.SYNTAX_ERROR
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Psetex)
 	}
-	mttl := string(args[1])
-	_, err := strconv.Atoi(mttl)
+	return validateExpireTime(redis.Psetex, args[1])
+}
+
+// 过期时间必须是正整数
+func validateExpireTime(cmdName string, arg []byte) error {
+	ttl, err := strconv.ParseInt(string(arg), 10, 64)
 	if err != nil {
 		return rediserr.NOT_INTEGER_ERROR
 	}
+	if ttl <= 0 {
+		return fmt.Errorf("ERR invalid expire time in '%s' command", cmdName)
+	}
 	return nil
 }
 
@@ -102,7 +90,7 @@ func ValidateMSetNX(conn conn.Conn, args [][]byte) error {
 }
 
 func ValidateMGet(conn conn.Conn, args [][]byte) error {
-	if len(args) != 1 {
+	if len(args) < 1 {
 		return fmt.Errorf("ERR wrong number of arguments for '%s' command", redis.Mget)
 	}
 	return nil